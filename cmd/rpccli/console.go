@@ -0,0 +1,319 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/justoxh/go-toolkit/rpc"
+)
+
+const usage = `Calls:
+  namespace.Method                    call without params
+  namespace.Method {"id": 1}          params as JSON
+  namespace.Method id=1 name="a b"    params as key=value pairs, a.b=1 for nested members
+
+Values of key=value pairs are taken as JSON when they are valid JSON, and as
+strings otherwise or when quoted.
+
+Commands:
+  methods [prefix]                    list the methods of the server
+  help                                show this help
+  exit                                leave the console
+`
+
+// commands are the console commands other than calls.
+var commands = []string{"exit", "help", "methods"}
+
+// console runs calls and commands on a client.
+type console struct {
+	client  *rpc.Client
+	out     io.Writer
+	timeout time.Duration
+
+	methods []rpc.MethodInfo // listed by the metadata service
+}
+
+// loadMethods lists the methods of the server.
+func (c *console) loadMethods() error {
+	var methods []rpc.MethodInfo
+	if err := c.call(rpc.MetadataAPI+".Methods", nil, &methods); err != nil {
+		return err
+	}
+	c.methods = methods
+	return nil
+}
+
+func (c *console) call(method string, params json.RawMessage, reply interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	return c.client.CallContext(ctx, method, params, reply)
+}
+
+// execute runs a line of the console. It reports whether the console
+// must be left.
+func (c *console) execute(line string) (bool, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return false, nil
+	}
+	name, rest := line, ""
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		name, rest = line[:i], strings.TrimSpace(line[i:])
+	}
+
+	switch name {
+	case "exit", "quit":
+		return true, nil
+	case "help":
+		io.WriteString(c.out, usage)
+		return false, nil
+	case "methods":
+		if c.methods == nil {
+			if err := c.loadMethods(); err != nil {
+				return false, err
+			}
+		}
+		for _, m := range c.methods {
+			if strings.HasPrefix(m.Name, rest) {
+				fmt.Fprintf(c.out, "%-32s %s -> %s\n", m.Name, m.Params, m.Reply)
+			}
+		}
+		return false, nil
+	}
+
+	params, err := parseParams(rest)
+	if err != nil {
+		return false, err
+	}
+	return false, c.callAndPrint(name, params)
+}
+
+// callAndPrint calls method and pretty-prints its result.
+func (c *console) callAndPrint(method string, params json.RawMessage) error {
+	var result json.RawMessage
+	if err := c.call(method, params, &result); err != nil {
+		return err
+	}
+	fmt.Fprintln(c.out, indent(result))
+	return nil
+}
+
+// runScript executes the lines of r, echoing them, until the first error.
+func (c *console) runScript(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fmt.Fprintf(c.out, "> %s\n", line)
+		quit, err := c.execute(line)
+		if err != nil {
+			return fmt.Errorf("line %d: %s", n, formatError(err))
+		}
+		if quit {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// complete is the AutoCompleteCallback of the terminal, it completes the
+// command or method name with Tab.
+func (c *console) complete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' {
+		return "", 0, false
+	}
+	prefix := line[:pos]
+	if strings.ContainsAny(prefix, " \t") {
+		return "", 0, false
+	}
+	candidates := c.candidates(prefix)
+	switch len(candidates) {
+	case 0:
+		return "", 0, false
+	case 1:
+		completed := candidates[0]
+		if pos == len(line) {
+			completed += " "
+		}
+		return completed + line[pos:], len(completed), true
+	}
+	if common := commonPrefix(candidates); len(common) > len(prefix) {
+		return common + line[pos:], len(common), true
+	}
+	fmt.Fprintln(c.out, strings.Join(candidates, "  "))
+	return "", 0, false
+}
+
+// candidates returns the commands and methods starting with prefix.
+func (c *console) candidates(prefix string) []string {
+	var candidates []string
+	for _, command := range commands {
+		if strings.HasPrefix(command, prefix) {
+			candidates = append(candidates, command)
+		}
+	}
+	for _, m := range c.methods {
+		if strings.HasPrefix(m.Name, prefix) {
+			candidates = append(candidates, m.Name)
+		}
+	}
+	sort.Strings(candidates)
+	return candidates
+}
+
+func commonPrefix(words []string) string {
+	common := words[0]
+	for _, w := range words[1:] {
+		for !strings.HasPrefix(w, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	return common
+}
+
+// formatError returns the text printed for the error of a call.
+func formatError(err error) string {
+	switch e := rpc.TypedError(err).(type) {
+	case *rpc.ResponseError:
+		return formatErrorObject(e.Err)
+	case *rpc.Error:
+		return formatErrorObject(e)
+	}
+	return "error: " + err.Error()
+}
+
+func formatErrorObject(e *rpc.Error) string {
+	s := fmt.Sprintf("error %d: %s", e.Code, e.Message)
+	if e.Data != nil {
+		data, _ := json.Marshal(e.Data)
+		s += "\n" + indent(data)
+	}
+	return s
+}
+
+func indent(doc []byte) string {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, doc, "", "  "); err != nil {
+		return string(doc)
+	}
+	return buf.String()
+}
+
+// token is a word of the params of a call.
+type token struct {
+	text   string
+	quoted bool // the value has quotes, so it is a string
+}
+
+// parseParams parses the params of a call, as a JSON value or key=value
+// pairs. No params return nil.
+func parseParams(s string) (json.RawMessage, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	if json.Valid([]byte(s)) {
+		return json.RawMessage(s), nil
+	}
+	if s[0] == '{' || s[0] == '[' || s[0] == '"' {
+		var v interface{}
+		err := json.Unmarshal([]byte(s), &v)
+		return nil, fmt.Errorf("bad JSON params: %v", err)
+	}
+	tokens, err := splitParams(s)
+	if err != nil {
+		return nil, err
+	}
+	return pairParams(tokens)
+}
+
+// splitParams splits s into tokens at spaces out of quotes. The quotes
+// around a whole value are removed, the ones within a value are kept, as in
+// tags=["a b"].
+func splitParams(s string) ([]token, error) {
+	var tokens []token
+	var cur strings.Builder
+	var quote rune
+	inToken, quoted, keep := false, false, false
+	for _, r := range s {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+			if keep {
+				cur.WriteRune(r)
+			}
+		case quote != 0:
+			cur.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote, inToken = r, true
+			keep = cur.Len() > 0 && !strings.HasSuffix(cur.String(), "=")
+			if keep {
+				cur.WriteRune(r)
+			} else {
+				quoted = true
+			}
+		case r == ' ' || r == '\t':
+			if inToken {
+				tokens = append(tokens, token{cur.String(), quoted})
+				cur.Reset()
+				inToken, quoted = false, false
+			}
+		default:
+			cur.WriteRune(r)
+			inToken = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quote in params")
+	}
+	if inToken {
+		tokens = append(tokens, token{cur.String(), quoted})
+	}
+	return tokens, nil
+}
+
+// pairParams builds a JSON object from key=value tokens.
+func pairParams(tokens []token) (json.RawMessage, error) {
+	params := make(map[string]interface{})
+	for _, t := range tokens {
+		eq := strings.Index(t.text, "=")
+		if eq <= 0 {
+			return nil, fmt.Errorf("bad param %q, expected key=value", t.text)
+		}
+		key, value := t.text[:eq], t.text[eq+1:]
+		var v interface{} = value
+		if !t.quoted && json.Valid([]byte(value)) {
+			v = json.RawMessage(value)
+		}
+
+		obj, names := params, strings.Split(key, ".")
+		for _, name := range names[:len(names)-1] {
+			next, ok := obj[name]
+			if !ok {
+				next = make(map[string]interface{})
+				obj[name] = next
+			}
+			if obj, ok = next.(map[string]interface{}); !ok {
+				return nil, fmt.Errorf("param %s is not an object", name)
+			}
+		}
+		obj[names[len(names)-1]] = v
+	}
+	return json.Marshal(params)
+}
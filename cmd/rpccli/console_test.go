@@ -0,0 +1,138 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/justoxh/go-toolkit/rpc"
+	"github.com/justoxh/go-toolkit/rpc/rpctest"
+)
+
+type Args struct {
+	A, B int
+	Name struct {
+		First string
+	}
+}
+
+type Arith struct{}
+
+func (Arith) Add(args *Args, reply *int) error {
+	*reply = args.A + args.B
+	return nil
+}
+
+func (Arith) Div(args *Args, reply *int) error {
+	if args.B == 0 {
+		return errors.New("divide by zero")
+	}
+	*reply = args.A / args.B
+	return nil
+}
+
+func (Arith) Echo(args *Args, reply *Args) error {
+	*reply = *args
+	return nil
+}
+
+func Test_ParseParams(t *testing.T) {
+	for in, expected := range map[string]string{
+		``:                              ``,
+		`{"A": 1}`:                      `{"A": 1}`,
+		`[1, 2]`:                        `[1, 2]`,
+		`42`:                            `42`,
+		`A=1 B=x`:                       `{"A":1,"B":"x"}`,
+		`A="1" Name.First='John Smith'`: `{"A":"1","Name":{"First":"John Smith"}}`,
+		`tags=["a","b"] ok=true`:        `{"ok":true,"tags":["a","b"]}`,
+		`a.b=1 a.c=2`:                   `{"a":{"b":1,"c":2}}`,
+	} {
+		params, err := parseParams(in)
+		if err != nil || string(params) != expected {
+			t.Fatalf("%s: expected %s, got %s %v", in, expected, params, err)
+		}
+	}
+	for _, in := range []string{`{"A": }`, `A`, `A="1`, `a=1 a.b=2`} {
+		if _, err := parseParams(in); err == nil {
+			t.Fatalf("%s: expected error", in)
+		}
+	}
+}
+
+func Test_Console(t *testing.T) {
+	for name, newServer := range map[string]func(testing.TB, ...rpc.API) *rpctest.Server{
+		"pipe": rpctest.NewPipeServer,
+		"http": rpctest.NewHTTPServer,
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := newServer(t, rpc.API{Namespace: "arith", Service: Arith{}})
+			var out bytes.Buffer
+			c := &console{client: s.Client(), out: &out, timeout: time.Second}
+
+			script := `
+# comment
+arith.Add A=1 B=2
+arith.Echo {"A": 1, "Name": {"First": "x"}}
+methods arith.
+arith.Div A=1
+arith.Add A=3
+`
+			err := c.runScript(strings.NewReader(script))
+			if err == nil || err.Error() != "line 6: error -32000: divide by zero" {
+				t.Fatalf("bad error %v", err)
+			}
+			expected := `> arith.Add A=1 B=2
+3
+> arith.Echo {"A": 1, "Name": {"First": "x"}}
+{
+  "A": 1,
+  "B": 0,
+  "Name": {
+    "First": "x"
+  }
+}
+> methods arith.
+arith.Add                        *main.Args -> int
+arith.Div                        *main.Args -> int
+arith.Echo                       *main.Args -> main.Args
+> arith.Div A=1
+`
+			if out.String() != expected {
+				t.Fatalf("expected:\n%s\ngot:\n%s", expected, out.String())
+			}
+		})
+	}
+}
+
+func Test_Complete(t *testing.T) {
+	var out bytes.Buffer
+	c := &console{out: &out, methods: []rpc.MethodInfo{{Name: "arith.Add"}, {Name: "arith.Div"}, {Name: "rpc.Methods"}}}
+	for _, tc := range []struct {
+		line, completed string
+		ok              bool
+	}{
+		{"ar", "arith.", true},
+		{"arith.A", "arith.Add ", true},
+		{"me", "methods ", true},
+		{"x", "", false},
+		{"arith.Add A", "", false},
+	} {
+		line, pos, ok := c.complete(tc.line, len(tc.line), '\t')
+		if ok != tc.ok || line != tc.completed || ok && pos != len(line) {
+			t.Fatalf("%s: expected %q, got %q %d %v", tc.line, tc.completed, line, pos, ok)
+		}
+	}
+	if _, _, ok := c.complete("arith.", 6, '\t'); ok || out.String() != "arith.Add  arith.Div\n" {
+		t.Fatalf("expected candidates, got %q", out.String())
+	}
+	if _, _, ok := c.complete("ar", 2, 'x'); ok {
+		t.Fatalf("completed without tab")
+	}
+}
@@ -0,0 +1,146 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+// Command rpccli is a console for calling the methods of a JSON-RPC server.
+//
+//	rpccli [flags] address [namespace.Method [params...]]
+//
+// The address is a http(s):// or ws(s):// URL, a tcp://host:port or
+// host:port address, or an ipc:// path or path of a unix socket. Without a
+// call, rpccli runs the script given by -f, the lines read from a
+// non-terminal standard input, or an interactive console with completion of
+// method names and history. Type help in the console for the call syntax.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/justoxh/go-toolkit/rpc"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+func main() {
+	script := flag.String("f", "", "file of calls to run, one per line")
+	timeout := flag.Duration("timeout", 30*time.Second, "timeout of a call")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: rpccli [flags] address [namespace.Method [params...]]\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	client, err := dial(flag.Arg(0), *timeout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "rpccli:", err)
+		os.Exit(1)
+	}
+	defer client.Close()
+	c := &console{client: client, out: os.Stdout, timeout: *timeout}
+
+	switch {
+	case flag.NArg() > 1:
+		err = runArgs(c, flag.Args()[1:])
+	case *script != "":
+		var f *os.File
+		if f, err = os.Open(*script); err == nil {
+			err = c.runScript(f)
+			f.Close()
+		}
+	case !terminal.IsTerminal(int(os.Stdin.Fd())):
+		err = c.runScript(os.Stdin)
+	default:
+		err = interactive(c, flag.Arg(0))
+	}
+	if err != nil {
+		client.Close()
+		fmt.Fprintln(os.Stderr, "rpccli:", err)
+		os.Exit(1)
+	}
+}
+
+// dial connects to the server at address.
+func dial(address string, timeout time.Duration) (*rpc.Client, error) {
+	switch {
+	case strings.HasPrefix(address, "http://"), strings.HasPrefix(address, "https://"):
+		return rpc.NewHTTPClient(address, &http.Client{Timeout: timeout}), nil
+	case strings.HasPrefix(address, "ws://"), strings.HasPrefix(address, "wss://"):
+		return rpc.DialWebsocket(address, nil)
+	case strings.HasPrefix(address, "ipc://"):
+		return rpc.Dial("unix", strings.TrimPrefix(address, "ipc://"))
+	case strings.HasPrefix(address, "tcp://"):
+		return rpc.Dial("tcp", strings.TrimPrefix(address, "tcp://"))
+	case strings.Contains(address, "/"), strings.HasSuffix(address, ".ipc"):
+		return rpc.Dial("unix", address)
+	}
+	return rpc.Dial("tcp", address)
+}
+
+// runArgs runs the call given on the command line. Each argument is a
+// key=value pair, unless the only one is a JSON value.
+func runArgs(c *console, args []string) error {
+	var params json.RawMessage
+	var err error
+	if len(args) == 2 && json.Valid([]byte(args[1])) {
+		params = []byte(args[1])
+	} else if len(args) > 1 {
+		tokens := make([]token, len(args)-1)
+		for i, arg := range args[1:] {
+			tokens[i] = token{text: arg}
+		}
+		if params, err = pairParams(tokens); err != nil {
+			return err
+		}
+	}
+	if err := c.callAndPrint(args[0], params); err != nil {
+		return fmt.Errorf("%s", formatError(err))
+	}
+	return nil
+}
+
+// interactive runs the console on the terminal.
+func interactive(c *console, address string) error {
+	fd := int(os.Stdin.Fd())
+	state, err := terminal.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer terminal.Restore(fd, state)
+
+	term := terminal.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, address+"> ")
+	term.AutoCompleteCallback = c.complete
+	c.out = term
+	if err := c.loadMethods(); err != nil {
+		fmt.Fprintf(term, "can not list the methods: %s\n", formatError(err))
+	}
+
+	for {
+		line, err := term.ReadLine()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		quit, err := c.execute(line)
+		if err != nil {
+			fmt.Fprintln(term, formatError(err))
+		}
+		if quit {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,72 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+// Command rpcreplay replays the JSON-RPC traffic captured by rpc.Recorder
+// against an endpoint, and reports the responses which differ from the
+// captured ones and the latency changes.
+//
+//	rpcreplay -file capture.jsonl -target http://127.0.0.1:8080 -speed 2
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/justoxh/go-toolkit/rpc"
+)
+
+func main() {
+	file := flag.String("file", "", "JSON Lines file written by rpc.Recorder")
+	targetAddr := flag.String("target", "", "endpoint to replay against, http(s)://host:port/path or tcp://host:port")
+	speed := flag.Float64("speed", 1, "replay speed relative to the capture, 0 sends the calls back to back")
+	timeout := flag.Duration("timeout", 30*time.Second, "timeout of a HTTP call")
+	maxDiffs := flag.Int("max-diffs", 20, "number of diffs listed in the report")
+	flag.Parse()
+
+	code, err := run(*file, *targetAddr, *speed, *timeout, *maxDiffs)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "rpcreplay:", err)
+		code = 2
+	}
+	os.Exit(code)
+}
+
+// run replays the captures of file against targetAddr, and returns the exit
+// code of the command: 1 if some responses differ, 0 otherwise.
+func run(file, targetAddr string, speed float64, timeout time.Duration, maxDiffs int) (int, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	captures, err := loadCaptures(f)
+	if err != nil {
+		return 0, err
+	}
+
+	var t target
+	switch {
+	case strings.HasPrefix(targetAddr, "http://"), strings.HasPrefix(targetAddr, "https://"):
+		t = &httpTarget{url: targetAddr, client: &http.Client{Timeout: timeout}}
+	case strings.HasPrefix(targetAddr, "tcp://"):
+		client, err := rpc.Dial("tcp", strings.TrimPrefix(targetAddr, "tcp://"))
+		if err != nil {
+			return 0, err
+		}
+		defer client.Close()
+		t = &clientTarget{client: client}
+	default:
+		return 0, errNoTarget
+	}
+
+	if report(os.Stdout, replay(captures, t, speed), maxDiffs) > 0 {
+		return 1, nil
+	}
+	return 0, nil
+}
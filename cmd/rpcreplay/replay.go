@@ -0,0 +1,271 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/justoxh/go-toolkit/rpc"
+)
+
+// target is the endpoint the captured calls are replayed against.
+type target interface {
+	call(method string, params json.RawMessage) (json.RawMessage, *rpc.Error, error)
+}
+
+// httpTarget posts JSON-RPC requests to a HTTP endpoint.
+type httpTarget struct {
+	url    string
+	client *http.Client
+}
+
+func (t *httpTarget) call(method string, params json.RawMessage) (json.RawMessage, *rpc.Error, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  []json.RawMessage{params},
+		"id":      1,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := t.client.Post(t.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	raw, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	var reply struct {
+		Result json.RawMessage `json:"result"`
+		Error  *rpc.Error      `json:"error"`
+	}
+	if err := json.Unmarshal(raw, &reply); err != nil {
+		return nil, nil, fmt.Errorf("bad response %q: %s", raw, err)
+	}
+	return reply.Result, reply.Error, nil
+}
+
+// clientTarget calls a JSON-RPC server through rpc.Client.
+type clientTarget struct {
+	client *rpc.Client
+}
+
+func (t *clientTarget) call(method string, params json.RawMessage) (json.RawMessage, *rpc.Error, error) {
+	var result json.RawMessage
+	err := t.client.Call(method, params, &result)
+	switch e := rpc.TypedError(err).(type) {
+	case nil:
+		return result, nil, nil
+	case *rpc.Error:
+		return nil, e, nil
+	case *rpc.ResponseError:
+		return nil, e.Err, nil
+	default:
+		return nil, nil, err
+	}
+}
+
+// result is the outcome of a replayed call.
+type result struct {
+	capture  *rpc.Capture
+	result   json.RawMessage
+	error    *rpc.Error
+	err      error // transport error
+	duration time.Duration
+}
+
+// loadCaptures reads the captured calls written by rpc.Recorder, sorted by
+// start time: the recorder writes them as they complete.
+func loadCaptures(r io.Reader) ([]*rpc.Capture, error) {
+	var captures []*rpc.Capture
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		c := &rpc.Capture{}
+		if err := json.Unmarshal(scanner.Bytes(), c); err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+		captures = append(captures, c)
+	}
+	sort.SliceStable(captures, func(i, j int) bool { return captures[i].Time.Before(captures[j].Time) })
+	return captures, scanner.Err()
+}
+
+// replay sends the captures to t. With speed > 0 the calls keep their
+// original spacing divided by speed, otherwise they are sent one after
+// the other.
+func replay(captures []*rpc.Capture, t target, speed float64) []*result {
+	results := make([]*result, len(captures))
+	send := func(i int) {
+		c := captures[i]
+		start := time.Now()
+		r := &result{capture: c}
+		r.result, r.error, r.err = t.call(c.Method, c.Params)
+		r.duration = time.Since(start)
+		results[i] = r
+	}
+	if speed <= 0 || len(captures) == 0 {
+		for i := range captures {
+			send(i)
+		}
+		return results
+	}
+
+	var wg sync.WaitGroup
+	first, start := captures[0].Time, time.Now()
+	for i, c := range captures {
+		offset := time.Duration(float64(c.Time.Sub(first)) / speed)
+		time.Sleep(time.Until(start.Add(offset)))
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			send(i)
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
+
+// diff describes how the replayed call differs from the captured one, or
+// returns "" if it does not.
+func diff(r *result) string {
+	c := r.capture
+	switch {
+	case r.err != nil:
+		return "failed: " + r.err.Error()
+	case c.Error != nil && r.error == nil:
+		return fmt.Sprintf("error %d became result %s", c.Error.Code, r.result)
+	case c.Error == nil && r.error != nil:
+		return fmt.Sprintf("result became error %d %q", r.error.Code, r.error.Message)
+	case c.Error != nil:
+		if c.Error.Code != r.error.Code {
+			return fmt.Sprintf("error %d became error %d %q", c.Error.Code, r.error.Code, r.error.Message)
+		}
+		return ""
+	}
+	if !equalJSON(c.Result, r.result) {
+		return fmt.Sprintf("result %s became %s", c.Result, r.result)
+	}
+	return ""
+}
+
+// equalJSON compares JSON documents regardless of member order and spacing.
+// Numbers are compared as written, so large integers are not rounded.
+func equalJSON(a, b json.RawMessage) bool {
+	var va, vb interface{}
+	if decodeJSON(a, &va) != nil || decodeJSON(b, &vb) != nil {
+		return bytes.Equal(a, b)
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+func decodeJSON(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+func percentile(durations []time.Duration, p float64) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[int(p*float64(len(sorted)-1))]
+}
+
+func change(before, after time.Duration) string {
+	if before <= 0 {
+		return "n/a"
+	}
+	return fmt.Sprintf("%+.1f%%", (float64(after)/float64(before)-1)*100)
+}
+
+// report writes the diffs and the latency changes of the replayed calls.
+func report(w io.Writer, results []*result, maxDiffs int) (diffs int) {
+	type methodStats struct {
+		count            int
+		original, replay time.Duration
+	}
+	var failures int
+	var original, replayed []time.Duration
+	stats := make(map[string]*methodStats)
+	var lines []string
+	for _, r := range results {
+		if d := diff(r); d != "" {
+			diffs++
+			if r.err != nil {
+				failures++
+			}
+			if len(lines) < maxDiffs {
+				lines = append(lines, fmt.Sprintf("  %s %s (request %s): %s", r.capture.Time.Format(time.RFC3339Nano), r.capture.Method, r.capture.RequestID, d))
+			}
+		}
+		if r.err != nil {
+			continue
+		}
+		original = append(original, r.capture.Duration)
+		replayed = append(replayed, r.duration)
+		s := stats[r.capture.Method]
+		if s == nil {
+			s = &methodStats{}
+			stats[r.capture.Method] = s
+		}
+		s.count++
+		s.original += r.capture.Duration
+		s.replay += r.duration
+	}
+
+	fmt.Fprintf(w, "replayed %d calls: %d diffs, %d failures\n", len(results), diffs, failures)
+	fmt.Fprintf(w, "\nlatency  %12s %12s %8s\n", "original", "replay", "change")
+	for _, p := range []struct {
+		name string
+		p    float64
+	}{{"p50", 0.5}, {"p95", 0.95}, {"p99", 0.99}} {
+		o, n := percentile(original, p.p), percentile(replayed, p.p)
+		fmt.Fprintf(w, "%-8s %12s %12s %8s\n", p.name, o, n, change(o, n))
+	}
+
+	methods := make([]string, 0, len(stats))
+	for method := range stats {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	fmt.Fprintf(w, "\n%-32s %6s %12s %12s %8s\n", "method", "calls", "original", "replay", "change")
+	for _, method := range methods {
+		s := stats[method]
+		o, n := s.original/time.Duration(s.count), s.replay/time.Duration(s.count)
+		fmt.Fprintf(w, "%-32s %6d %12s %12s %8s\n", method, s.count, o, n, change(o, n))
+	}
+
+	if len(lines) > 0 {
+		fmt.Fprintf(w, "\ndiffs:\n%s\n", strings.Join(lines, "\n"))
+		if diffs > len(lines) {
+			fmt.Fprintf(w, "  ... %d more\n", diffs-len(lines))
+		}
+	}
+	return diffs
+}
+
+var errNoTarget = errors.New("-target must be a http(s):// or tcp:// address")
@@ -0,0 +1,159 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/justoxh/go-toolkit/rpc"
+)
+
+type Args struct {
+	A, B int
+}
+
+type Calc struct {
+	bug bool
+}
+
+func (c *Calc) Add(args *Args, reply *int) error {
+	*reply = args.A + args.B
+	if c.bug && args.A > 10 {
+		*reply++
+	}
+	return nil
+}
+
+func (c *Calc) Div(args *Args, reply *int) error {
+	if args.B == 0 {
+		return errors.New("divide by zero")
+	}
+	*reply = args.A / args.B
+	return nil
+}
+
+func newCalcServer(bug bool, recorder *rpc.Recorder) *httptest.Server {
+	server, _ := rpc.NewHTTPServer(nil, nil)
+	server.GetServer().Register(&Calc{bug: bug})
+	if recorder != nil {
+		server.GetServer().SetRecorder(recorder)
+	}
+	return httptest.NewServer(server)
+}
+
+func Test_Replay(t *testing.T) {
+	var capture bytes.Buffer
+	origin := newCalcServer(false, rpc.NewRecorder(&capture, nil))
+	defer origin.Close()
+	calls := []struct {
+		method string
+		params string
+	}{
+		{"Calc.Add", `{"A":1,"B":2}`},
+		{"Calc.Add", `{"A":20,"B":2}`},
+		{"Calc.Div", `{"A":1,"B":0}`},
+	}
+	t0 := &httpTarget{url: origin.URL, client: http.DefaultClient}
+	for _, c := range calls {
+		if _, _, err := t0.call(c.method, json.RawMessage(c.params)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	captures, err := loadCaptures(&capture)
+	if err != nil || len(captures) != len(calls) {
+		t.Fatalf("bad captures %v: %v", captures, err)
+	}
+
+	var out bytes.Buffer
+	if diffs := report(&out, replay(captures, t0, 10), 10); diffs != 0 {
+		t.Fatalf("expected no diffs against the origin:\n%s", out.String())
+	}
+
+	buggy := newCalcServer(true, nil)
+	defer buggy.Close()
+	out.Reset()
+	if diffs := report(&out, replay(captures, &httpTarget{url: buggy.URL, client: http.DefaultClient}, 0), 10); diffs != 1 {
+		t.Fatalf("expected 1 diff:\n%s", out.String())
+	}
+	for _, s := range []string{"replayed 3 calls: 1 diffs, 0 failures", "Calc.Add", "Calc.Div", "result 22 became 23"} {
+		if !strings.Contains(out.String(), s) {
+			t.Fatalf("report misses %q:\n%s", s, out.String())
+		}
+	}
+}
+
+func Test_Run(t *testing.T) {
+	var capture bytes.Buffer
+	origin := newCalcServer(false, rpc.NewRecorder(&capture, nil))
+	defer origin.Close()
+	t0 := &httpTarget{url: origin.URL, client: http.DefaultClient}
+	if _, _, err := t0.call("Calc.Add", json.RawMessage(`{"A":20,"B":2}`)); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "capture.jsonl")
+	if err := ioutil.WriteFile(file, capture.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if code, err := run(file, origin.URL, 0, time.Second, 10); code != 0 || err != nil {
+		t.Fatalf("expected exit code 0, got %d %v", code, err)
+	}
+	buggy := newCalcServer(true, nil)
+	defer buggy.Close()
+	if code, err := run(file, buggy.URL, 0, time.Second, 10); code != 1 || err != nil {
+		t.Fatalf("expected exit code 1, got %d %v", code, err)
+	}
+	if _, err := run(file, "udp://127.0.0.1:1", 0, time.Second, 10); err != errNoTarget {
+		t.Fatalf("expected no target, got %v", err)
+	}
+}
+
+func Test_LoadCaptures(t *testing.T) {
+	// a slow call started first is written last
+	lines := `{"time":"2026-01-02T10:00:01Z","method":"Calc.Add","params":{"A":1,"B":1}}
+{"time":"2026-01-02T10:00:02Z","method":"Calc.Add","params":{"A":2,"B":2}}
+{"time":"2026-01-02T10:00:00Z","method":"Calc.Slow","params":{"A":3,"B":3}}
+{"time":"2026-01-02T10:00:02Z","method":"Calc.Add","params":{"A":4,"B":4}}
+`
+	captures, err := loadCaptures(strings.NewReader(lines))
+	if err != nil || len(captures) != 4 {
+		t.Fatalf("bad captures %v: %v", captures, err)
+	}
+	for i, params := range []string{`{"A":3,"B":3}`, `{"A":1,"B":1}`, `{"A":2,"B":2}`, `{"A":4,"B":4}`} {
+		if string(captures[i].Params) != params {
+			t.Fatalf("capture %d: expected %s, got %s", i, params, captures[i].Params)
+		}
+	}
+}
+
+func Test_Diff(t *testing.T) {
+	c := &rpc.Capture{Result: json.RawMessage(`{"a":1,"b":[1,2]}`)}
+	if d := diff(&result{capture: c, result: json.RawMessage(`{ "b":[1,2], "a":1 }`)}); d != "" {
+		t.Fatalf("unexpected diff %s", d)
+	}
+	if d := diff(&result{capture: c, error: rpc.NewError(-32000, "boom")}); d == "" {
+		t.Fatalf("expected diff")
+	}
+	c = &rpc.Capture{Error: rpc.NewError(-32000, "boom")}
+	if d := diff(&result{capture: c, error: rpc.NewError(-32000, "other message")}); d != "" {
+		t.Fatalf("unexpected diff %s", d)
+	}
+	// integers beyond the precision of float64
+	c = &rpc.Capture{Result: json.RawMessage(`{"id":18446744073709551615}`)}
+	if d := diff(&result{capture: c, result: json.RawMessage(`{"id":18446744073709551614}`)}); d == "" {
+		t.Fatalf("expected diff of large integers")
+	}
+}
@@ -1,6 +1,7 @@
 package localcache
 
 import (
+	"strings"
 	"time"
 
 	gocache "github.com/patrickmn/go-cache"
@@ -26,3 +27,27 @@ func (service *LocalCacheService) Initialize(cacheCfg interface{}) {
 	service.cleanup = time.Duration(options.CleanupTime) * time.Second
 	service.cache = gocache.New(service.expire, service.cleanup)
 }
+
+// Get returns the value of key and whether it was found.
+func (service *LocalCacheService) Get(key string) (interface{}, bool) {
+	return service.cache.Get(key)
+}
+
+// Set stores value under key for ttl, or for the configured ExpireTime if ttl is 0.
+func (service *LocalCacheService) Set(key string, value interface{}, ttl time.Duration) {
+	service.cache.Set(key, value, ttl)
+}
+
+// Delete removes key from the cache.
+func (service *LocalCacheService) Delete(key string) {
+	service.cache.Delete(key)
+}
+
+// DeletePrefix removes all keys starting with prefix from the cache.
+func (service *LocalCacheService) DeletePrefix(prefix string) {
+	for key := range service.cache.Items() {
+		if strings.HasPrefix(key, prefix) {
+			service.cache.Delete(key)
+		}
+	}
+}
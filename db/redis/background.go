@@ -0,0 +1,167 @@
+package redis
+
+import "context"
+
+// The methods of RedisCacheService run the commands of RedisContextService
+// with context.Background(), so they are only bounded by the timeouts of
+// RedisOptions.
+
+func (service *RedisCacheService) Set(key string, value []byte, ttl int64) error {
+	return service.contextual.Set(context.Background(), key, value, ttl)
+}
+
+func (service *RedisCacheService) Get(key string) ([]byte, error) {
+	return service.contextual.Get(context.Background(), key)
+}
+
+func (service *RedisCacheService) Mset(keyvalues [][2][]byte, ttl int64) error {
+	return service.contextual.Mset(context.Background(), keyvalues, ttl)
+}
+
+func (service *RedisCacheService) Mget(keys []string) ([][]byte, error) {
+	return service.contextual.Mget(context.Background(), keys)
+}
+
+func (service *RedisCacheService) Exists(key string) (bool, error) {
+	return service.contextual.Exists(context.Background(), key)
+}
+
+func (service *RedisCacheService) Del(key string) error {
+	return service.contextual.Del(context.Background(), key)
+}
+
+func (service *RedisCacheService) Dels(keys []string) error {
+	return service.contextual.Dels(context.Background(), keys)
+}
+
+func (service *RedisCacheService) Keys(keyFormat string) ([][]byte, error) {
+	return service.contextual.Keys(context.Background(), keyFormat)
+}
+
+func (service *RedisCacheService) Scan(cursor uint64, match string, count int64) (uint64, [][]byte, error) {
+	return service.contextual.Scan(context.Background(), cursor, match, count)
+}
+
+func (service *RedisCacheService) SAdd(key string, ttl int64, members ...[]byte) error {
+	return service.contextual.SAdd(context.Background(), key, ttl, members...)
+}
+
+func (service *RedisCacheService) SRem(key string, members ...[]byte) (int64, error) {
+	return service.contextual.SRem(context.Background(), key, members...)
+}
+
+func (service *RedisCacheService) SetNX(key string, value int64, ttl int) (bool, error) {
+	return service.contextual.SetNX(context.Background(), key, value, ttl)
+}
+
+func (service *RedisCacheService) SCard(key string) (int64, error) {
+	return service.contextual.SCard(context.Background(), key)
+}
+
+func (service *RedisCacheService) SIsMember(key string, member []byte) (bool, error) {
+	return service.contextual.SIsMember(context.Background(), key, member)
+}
+
+func (service *RedisCacheService) SMembers(key string) ([][]byte, error) {
+	return service.contextual.SMembers(context.Background(), key)
+}
+
+func (service *RedisCacheService) ZAdd(key string, ttl int64, args ...[]byte) error {
+	return service.contextual.ZAdd(context.Background(), key, ttl, args...)
+}
+
+func (service *RedisCacheService) ZRem(key string, args ...[]byte) (int64, error) {
+	return service.contextual.ZRem(context.Background(), key, args...)
+}
+
+func (service *RedisCacheService) ZCard(key string) (int64, error) {
+	return service.contextual.ZCard(context.Background(), key)
+}
+
+func (service *RedisCacheService) ZRank(key string, member []byte) (int64, error) {
+	return service.contextual.ZRank(context.Background(), key, member)
+}
+
+func (service *RedisCacheService) ZRevRank(key string, member []byte) (int64, error) {
+	return service.contextual.ZRevRank(context.Background(), key, member)
+}
+
+func (service *RedisCacheService) ZRange(key string, start, stop int64, withScores bool) ([][]byte, error) {
+	return service.contextual.ZRange(context.Background(), key, start, stop, withScores)
+}
+
+func (service *RedisCacheService) ZRangeByScore(key string, min, max interface{}, withScores bool) ([][]byte, error) {
+	return service.contextual.ZRangeByScore(context.Background(), key, min, max, withScores)
+}
+
+func (service *RedisCacheService) ZRevRange(key string, start, stop int64, withScores bool) ([][]byte, error) {
+	return service.contextual.ZRevRange(context.Background(), key, start, stop, withScores)
+}
+
+func (service *RedisCacheService) ZRemRangeByScore(key string, start, stop int64) (int64, error) {
+	return service.contextual.ZRemRangeByScore(context.Background(), key, start, stop)
+}
+
+func (service *RedisCacheService) HSet(key string, ttl int64, field string, value []byte) error {
+	return service.contextual.HSet(context.Background(), key, ttl, field, value)
+}
+
+func (service *RedisCacheService) HGet(key string, field []byte) ([]byte, error) {
+	return service.contextual.HGet(context.Background(), key, field)
+}
+
+func (service *RedisCacheService) HMSet(key string, ttl int64, args ...[]byte) error {
+	return service.contextual.HMSet(context.Background(), key, ttl, args...)
+}
+
+func (service *RedisCacheService) HMGet(key string, fields ...[]byte) ([][]byte, error) {
+	return service.contextual.HMGet(context.Background(), key, fields...)
+}
+
+func (service *RedisCacheService) HDel(key string, fields ...[]byte) (int64, error) {
+	return service.contextual.HDel(context.Background(), key, fields...)
+}
+
+func (service *RedisCacheService) HExists(key string, field []byte) (bool, error) {
+	return service.contextual.HExists(context.Background(), key, field)
+}
+
+func (service *RedisCacheService) HKeys(key string) ([][]byte, error) {
+	return service.contextual.HKeys(context.Background(), key)
+}
+
+func (service *RedisCacheService) HVals(key string) ([][]byte, error) {
+	return service.contextual.HVals(context.Background(), key)
+}
+
+func (service *RedisCacheService) HGetAll(key string) ([][]byte, error) {
+	return service.contextual.HGetAll(context.Background(), key)
+}
+
+func (service *RedisCacheService) HLen(key string) (int64, error) {
+	return service.contextual.HLen(context.Background(), key)
+}
+
+func (service *RedisCacheService) LRpush(key string, args ...[]byte) (int64, error) {
+	return service.contextual.LRpush(context.Background(), key, args...)
+}
+
+func (service *RedisCacheService) LLpush(key string, args ...[]byte) (int64, error) {
+	return service.contextual.LLpush(context.Background(), key, args...)
+}
+
+func (service *RedisCacheService) LRpop(key string) ([]byte, error) {
+	return service.contextual.LRpop(context.Background(), key)
+}
+
+func (service *RedisCacheService) LLpop(key string) ([]byte, error) {
+	return service.contextual.LLpop(context.Background(), key)
+}
+
+func (service *RedisCacheService) LIndex(key string, index int64) ([]byte, error) {
+	return service.contextual.LIndex(context.Background(), key, index)
+}
+
+func (service *RedisCacheService) LLlen(key string) (int64, error) {
+	return service.contextual.LLlen(context.Background(), key)
+}
@@ -0,0 +1,105 @@
+package redis
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/justoxh/go-toolkit/log"
+)
+
+// RedisContextService is the variant of RedisCacheService whose calls take
+// a context. A call waiting for a pooled connection, or for the reply of a
+// command, gives up with the error of the context when it is done.
+type RedisContextService struct {
+	pool         *redis.Pool
+	log          log.Logger
+	readTimeout  time.Duration
+	watchRetries int
+}
+
+var _ ContextService = (*RedisContextService)(nil)
+
+// get returns a pooled connection for the commands of a call. If it can't
+// get one, its commands return the error.
+func (service *RedisContextService) get(ctx context.Context) *ctxConn {
+	conn, _ := service.pool.GetContext(ctx)
+	return &ctxConn{ctx: ctx, conn: conn, readTimeout: service.readTimeout}
+}
+
+// ctxConn is a pooled connection whose commands give up when ctx is done.
+// A command given up keeps the connection until its reply arrives or its
+// read times out, then the connection goes back to the pool, or is
+// discarded if it is broken.
+type ctxConn struct {
+	ctx         context.Context
+	conn        redis.Conn
+	readTimeout time.Duration
+	pending     chan struct{} // closed when the command given up is over
+}
+
+func (c *ctxConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	var reply interface{}
+	err := c.run(func(conn redis.Conn, timeout time.Duration) (err error) {
+		reply, err = redis.DoWithTimeout(conn, timeout, commandName, args...)
+		return err
+	})
+	if err != nil {
+		// reply may still be set by a command given up
+		return nil, err
+	}
+	return reply, nil
+}
+
+// run runs f, which sends commands on conn and reads their replies with
+// timeout, giving up when ctx is done.
+func (c *ctxConn) run(f func(conn redis.Conn, timeout time.Duration) error) error {
+	if c.ctx.Done() == nil {
+		return f(c.conn, c.readTimeout)
+	}
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
+	timeout, atDeadline := c.readTimeout, false
+	if deadline, ok := c.ctx.Deadline(); ok {
+		left := time.Until(deadline)
+		if left <= 0 {
+			return context.DeadlineExceeded
+		}
+		if timeout == 0 || left < timeout {
+			timeout, atDeadline = left, true
+		}
+	}
+
+	var err error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err = f(c.conn, timeout)
+	}()
+	select {
+	case <-done:
+		if nerr, ok := err.(net.Error); ok && nerr.Timeout() && atDeadline {
+			// the read timed out at the deadline of ctx
+			return context.DeadlineExceeded
+		}
+		return err
+	case <-c.ctx.Done():
+		c.pending = done
+		return c.ctx.Err()
+	}
+}
+
+// Close returns the connection to the pool, once the command given up, if
+// any, is over.
+func (c *ctxConn) Close() error {
+	if c.pending != nil {
+		go func() {
+			<-c.pending
+			c.conn.Close()
+		}()
+		return nil
+	}
+	return c.conn.Close()
+}
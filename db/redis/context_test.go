@@ -0,0 +1,81 @@
+package redis
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/justoxh/go-toolkit/log/logruslogger"
+)
+
+// listenStalled accepts connections and never replies.
+func listenStalled(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	return l
+}
+
+func initStalledService(t *testing.T, options RedisOptions) *RedisCacheService {
+	l := listenStalled(t)
+	t.Cleanup(func() { l.Close() })
+	options.Host, options.Port, _ = net.SplitHostPort(l.Addr().String())
+	options.MaxIdle, options.MaxActive = 1, 1
+	service := &RedisCacheService{}
+	service.Initialize(options, logruslogger.GetLoggerWithOptions("test", &logruslogger.Options{DisableConsole: true}))
+	return service
+}
+
+func Test_Context_Command(t *testing.T) {
+	service := initStalledService(t, RedisOptions{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := service.WithContext().Get(ctx, "key"); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("get took %s", d)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if _, err := service.WithContext().Get(ctx, "key"); err != context.Canceled {
+		t.Fatalf("expected canceled, got %v", err)
+	}
+}
+
+func Test_Context_Pool(t *testing.T) {
+	service := initStalledService(t, RedisOptions{})
+	held := service.pool.Get()
+	defer held.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := service.WithContext().Exists(ctx, "key"); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded waiting for a connection, got %v", err)
+	}
+}
+
+func Test_Context_ReadTimeout(t *testing.T) {
+	service := initStalledService(t, RedisOptions{DialTimeout: 100, ReadTimeout: 50, WriteTimeout: 50})
+	start := time.Now()
+	if _, err := service.Get("key"); err == nil {
+		t.Fatalf("expected read timeout")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("get took %s", d)
+	}
+}
@@ -0,0 +1,320 @@
+package redis
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/justoxh/go-toolkit/log/logruslogger"
+)
+
+// fakeRedis serves a few commands of the Redis protocol from memory, so
+// the tests which use it run without a Redis server.
+type fakeRedis struct {
+	mutex      sync.Mutex
+	strings    map[string][]byte
+	hashes     map[string]map[string][]byte
+	ttls       map[string]int64
+	versions   map[string]int // writes by key, for WATCH
+	roundTrips int            // replies flushed
+}
+
+// fakeConn is the transaction state of a connection to a fakeRedis.
+type fakeConn struct {
+	watched map[string]int // versions of the watched keys
+	multi   bool
+	queued  [][]string
+}
+
+// initFakeService returns a service connected to a new fakeRedis.
+func initFakeService(t *testing.T) (*fakeRedis, *RedisCacheService) {
+	f := &fakeRedis{
+		strings:  make(map[string][]byte),
+		hashes:   make(map[string]map[string][]byte),
+		ttls:     make(map[string]int64),
+		versions: make(map[string]int),
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	options := RedisOptions{MaxIdle: 2, MaxActive: 2, ReadTimeout: 1000}
+	options.Host, options.Port, _ = net.SplitHostPort(l.Addr().String())
+	service := &RedisCacheService{}
+	service.Initialize(options, logruslogger.GetLoggerWithOptions("test", &logruslogger.Options{DisableConsole: true}))
+	return f, service
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r, w := bufio.NewReader(conn), bufio.NewWriter(conn)
+	c := &fakeConn{}
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		f.mutex.Lock()
+		f.transact(w, c, strings.ToLower(args[0]), args)
+		if r.Buffered() == 0 {
+			f.roundTrips++
+			w.Flush()
+		}
+		f.mutex.Unlock()
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil || line[0] != '*' || n == 0 {
+		return nil, fmt.Errorf("bad command %q", line)
+	}
+	args := make([]string, n)
+	for i := range args {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		buf := make([]byte, size+2)
+		if _, err = io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func writeBulk(w *bufio.Writer, v []byte) {
+	if v == nil {
+		w.WriteString("$-1\r\n")
+		return
+	}
+	fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+}
+
+func writeInt(w *bufio.Writer, n int) {
+	fmt.Fprintf(w, ":%d\r\n", n)
+}
+
+// transact runs the transaction commands, and queues the other ones
+// within MULTI.
+func (f *fakeRedis) transact(w *bufio.Writer, c *fakeConn, cmd string, args []string) {
+	switch {
+	case cmd == "watch":
+		if c.watched == nil {
+			c.watched = make(map[string]int)
+		}
+		for _, key := range args[1:] {
+			c.watched[key] = f.versions[key]
+		}
+		w.WriteString("+OK\r\n")
+	case cmd == "unwatch":
+		c.watched = nil
+		w.WriteString("+OK\r\n")
+	case cmd == "multi":
+		c.multi = true
+		w.WriteString("+OK\r\n")
+	case cmd == "exec":
+		aborted := false
+		for key, version := range c.watched {
+			aborted = aborted || f.versions[key] != version
+		}
+		queued := c.queued
+		c.watched, c.multi, c.queued = nil, false, nil
+		if aborted {
+			w.WriteString("*-1\r\n")
+			return
+		}
+		var buf bytes.Buffer
+		bw := bufio.NewWriter(&buf)
+		for _, args := range queued {
+			f.exec(bw, strings.ToLower(args[0]), args[1:])
+		}
+		bw.Flush()
+		fmt.Fprintf(w, "*%d\r\n", len(queued))
+		w.Write(buf.Bytes())
+	case c.multi:
+		c.queued = append(c.queued, args)
+		w.WriteString("+QUEUED\r\n")
+	default:
+		f.exec(w, cmd, args[1:])
+	}
+}
+
+func (f *fakeRedis) exec(w *bufio.Writer, cmd string, args []string) {
+	switch cmd {
+	case "set", "expire", "hset", "hmset", "hdel":
+		f.versions[args[0]]++
+	case "mset":
+		for i := 0; i < len(args); i += 2 {
+			f.versions[args[i]]++
+		}
+	case "del":
+		for _, key := range args {
+			f.versions[key]++
+		}
+	}
+
+	wrongType := func(key string) bool {
+		_, s := f.strings[key]
+		_, h := f.hashes[key]
+		if s && cmd[0] == 'h' || h && cmd == "get" {
+			w.WriteString("-WRONGTYPE Operation against a key holding the wrong kind of value\r\n")
+			return true
+		}
+		return false
+	}
+	if len(args) > 0 && wrongType(args[0]) {
+		return
+	}
+	switch cmd {
+	case "set":
+		f.strings[args[0]] = []byte(args[1])
+		if len(args) == 4 && strings.ToLower(args[2]) == "ex" {
+			f.ttls[args[0]], _ = strconv.ParseInt(args[3], 10, 64)
+		}
+		w.WriteString("+OK\r\n")
+	case "get":
+		writeBulk(w, f.strings[args[0]])
+	case "mset":
+		for i := 0; i+1 < len(args); i += 2 {
+			f.strings[args[i]] = []byte(args[i+1])
+		}
+		w.WriteString("+OK\r\n")
+	case "mget":
+		fmt.Fprintf(w, "*%d\r\n", len(args))
+		for _, key := range args {
+			writeBulk(w, f.strings[key])
+		}
+	case "del":
+		n := 0
+		for _, key := range args {
+			if _, ok := f.strings[key]; ok {
+				n++
+			} else if _, ok := f.hashes[key]; ok {
+				n++
+			}
+			delete(f.strings, key)
+			delete(f.hashes, key)
+			delete(f.ttls, key)
+		}
+		writeInt(w, n)
+	case "exists":
+		_, s := f.strings[args[0]]
+		_, h := f.hashes[args[0]]
+		if s || h {
+			writeInt(w, 1)
+		} else {
+			writeInt(w, 0)
+		}
+	case "expire":
+		_, s := f.strings[args[0]]
+		_, h := f.hashes[args[0]]
+		if !s && !h {
+			writeInt(w, 0)
+			return
+		}
+		f.ttls[args[0]], _ = strconv.ParseInt(args[1], 10, 64)
+		writeInt(w, 1)
+	case "hset", "hmset":
+		h := f.hashes[args[0]]
+		if h == nil {
+			h = make(map[string][]byte)
+			f.hashes[args[0]] = h
+		}
+		n := 0
+		for i := 1; i+1 < len(args); i += 2 {
+			if _, ok := h[args[i]]; !ok {
+				n++
+			}
+			h[args[i]] = []byte(args[i+1])
+		}
+		if cmd == "hmset" {
+			w.WriteString("+OK\r\n")
+		} else {
+			writeInt(w, n)
+		}
+	case "hget":
+		writeBulk(w, f.hashes[args[0]][args[1]])
+	case "hmget":
+		fmt.Fprintf(w, "*%d\r\n", len(args)-1)
+		for _, field := range args[1:] {
+			writeBulk(w, f.hashes[args[0]][field])
+		}
+	case "scan":
+		f.scan(w, args)
+	case "hdel":
+		n := 0
+		for _, field := range args[1:] {
+			if _, ok := f.hashes[args[0]][field]; ok {
+				n++
+				delete(f.hashes[args[0]], field)
+			}
+		}
+		writeInt(w, n)
+	default:
+		fmt.Fprintf(w, "-ERR unknown command '%s'\r\n", cmd)
+	}
+}
+
+// scan pages the sorted keys, its cursor is the index of the next key.
+func (f *fakeRedis) scan(w *bufio.Writer, args []string) {
+	cursor, _ := strconv.Atoi(args[0])
+	match, count := "*", 10
+	for i := 1; i+1 < len(args); i += 2 {
+		switch strings.ToLower(args[i]) {
+		case "match":
+			match = args[i+1]
+		case "count":
+			count, _ = strconv.Atoi(args[i+1])
+		}
+	}
+	var keys []string
+	for key := range f.strings {
+		keys = append(keys, key)
+	}
+	for key := range f.hashes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	next := cursor + count
+	if next >= len(keys) {
+		next = 0
+	} else {
+		keys = keys[:next]
+	}
+	var page []string
+	for _, key := range keys[cursor:] {
+		if ok, _ := path.Match(match, key); ok {
+			page = append(page, key)
+		}
+	}
+	fmt.Fprintf(w, "*2\r\n")
+	writeBulk(w, []byte(strconv.Itoa(next)))
+	fmt.Fprintf(w, "*%d\r\n", len(page))
+	for _, key := range page {
+		writeBulk(w, []byte(key))
+	}
+}
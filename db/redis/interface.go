@@ -1,5 +1,7 @@
 package redis
 
+import "context"
+
 // Service implement interface for redis servece
 type Service interface {
 	// string
@@ -11,6 +13,7 @@ type Service interface {
 	Del(key string) error
 	Dels(keys []string) error
 	Keys(keyFormat string) ([][]byte, error)
+	Scan(cursor uint64, match string, count int64) (uint64, [][]byte, error)
 
 	// set
 	SAdd(key string, ttl int64, members ...[]byte) error
@@ -50,3 +53,55 @@ type Service interface {
 	LLlen(key string) (int64, error)
 
 }
+
+// ContextService is the variant of Service whose calls take a context, and
+// give up when it is done.
+type ContextService interface {
+	// string
+	Set(ctx context.Context, key string, value []byte, ttl int64) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Mset(ctx context.Context, keyvalues [][2][]byte, ttl int64) error
+	Mget(ctx context.Context, keys []string) ([][]byte, error)
+	Exists(ctx context.Context, key string) (bool, error)
+	Del(ctx context.Context, key string) error
+	Dels(ctx context.Context, keys []string) error
+	Keys(ctx context.Context, keyFormat string) ([][]byte, error)
+	Scan(ctx context.Context, cursor uint64, match string, count int64) (uint64, [][]byte, error)
+
+	// set
+	SAdd(ctx context.Context, key string, ttl int64, members ...[]byte) error
+	SRem(ctx context.Context, key string, members ...[]byte) (int64, error)
+	SCard(ctx context.Context, key string) (int64, error)
+	SIsMember(ctx context.Context, key string, member []byte) (bool, error)
+	SMembers(ctx context.Context, key string) ([][]byte, error)
+	SetNX(ctx context.Context, key string, value int64, ttl int) (bool, error)
+	// zset
+	ZAdd(ctx context.Context, key string, ttl int64, args ...[]byte) error
+	ZRem(ctx context.Context, key string, args ...[]byte) (int64, error)
+	ZCard(ctx context.Context, key string) (int64, error)
+	ZRank(ctx context.Context, key string, member []byte) (int64, error)
+	ZRevRank(ctx context.Context, key string, member []byte) (int64, error)
+	ZRange(ctx context.Context, key string, start, stop int64, withScores bool) ([][]byte, error)
+	ZRangeByScore(ctx context.Context, key string, min, max interface{}, withScores bool) ([][]byte, error)
+	ZRevRange(ctx context.Context, key string, start, stop int64, withScores bool) ([][]byte, error)
+
+	// hash
+	HSet(ctx context.Context, key string, ttl int64, field string, value []byte) error
+	HGet(ctx context.Context, key string, field []byte) ([]byte, error)
+	HMSet(ctx context.Context, key string, ttl int64, args ...[]byte) error
+	HMGet(ctx context.Context, key string, fields ...[]byte) ([][]byte, error)
+	HDel(ctx context.Context, key string, fields ...[]byte) (int64, error)
+	HExists(ctx context.Context, key string, field []byte) (bool, error)
+	HKeys(ctx context.Context, key string) ([][]byte, error)
+	HVals(ctx context.Context, key string) ([][]byte, error)
+	HGetAll(ctx context.Context, key string) ([][]byte, error)
+	HLen(ctx context.Context, key string) (int64, error)
+
+	// list
+	LRpush(ctx context.Context, key string, args ...[]byte) (int64, error)
+	LLpush(ctx context.Context, key string, args ...[]byte) (int64, error)
+	LRpop(ctx context.Context, key string) ([]byte, error)
+	LLpop(ctx context.Context, key string) ([]byte, error)
+	LIndex(ctx context.Context, key string, index int64) ([]byte, error)
+	LLlen(ctx context.Context, key string) (int64, error)
+}
@@ -0,0 +1,271 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// errNotExecuted is the error of the commands of a pipeline not executed yet.
+var errNotExecuted = errors.New("redis: pipeline not executed")
+
+// Pipeline queues commands, and sends them in one round trip on a pooled
+// connection when it is executed. Each command returns its typed result
+// once the pipeline is executed:
+//
+//	p := service.Pipeline()
+//	name := p.Get("user:1:name")
+//	p.Expire("user:1:name", 3600)
+//	if err := p.Exec(ctx); err != nil {
+//		...
+//	}
+//	value, err := name.Result()
+//
+// A pipeline is not atomic, other clients' commands can run between its
+// commands. It is not safe for concurrent use.
+type Pipeline struct {
+	service *RedisContextService
+	cmds    []*Cmd
+}
+
+// Pipeline returns a new pipeline of the service.
+func (service *RedisContextService) Pipeline() *Pipeline {
+	return &Pipeline{service: service}
+}
+
+// Pipeline returns a new pipeline of the service.
+func (service *RedisCacheService) Pipeline() *Pipeline {
+	return service.contextual.Pipeline()
+}
+
+// Cmd is a command queued in a pipeline.
+type Cmd struct {
+	name  string
+	args  []interface{}
+	reply interface{}
+	err   error
+}
+
+// Err returns the error of the command.
+func (c *Cmd) Err() error {
+	return c.err
+}
+
+// Result returns the reply of the command as sent by the server.
+func (c *Cmd) Result() (interface{}, error) {
+	return c.reply, c.err
+}
+
+// BytesCmd is a command replying a value, nil if it does not exist.
+type BytesCmd struct{ Cmd }
+
+func (c *BytesCmd) Result() ([]byte, error) {
+	v, err := redis.Bytes(c.reply, c.err)
+	if err == redis.ErrNil {
+		return nil, nil
+	}
+	return v, err
+}
+
+// BytesSliceCmd is a command replying values, with nil for those which
+// do not exist.
+type BytesSliceCmd struct{ Cmd }
+
+func (c *BytesSliceCmd) Result() ([][]byte, error) {
+	return redis.ByteSlices(c.reply, c.err)
+}
+
+// IntCmd is a command replying a count.
+type IntCmd struct{ Cmd }
+
+func (c *IntCmd) Result() (int64, error) {
+	return redis.Int64(c.reply, c.err)
+}
+
+// BoolCmd is a command replying whether it applied.
+type BoolCmd struct{ Cmd }
+
+func (c *BoolCmd) Result() (bool, error) {
+	return redis.Bool(c.reply, c.err)
+}
+
+func (p *Pipeline) queue(c *Cmd, name string, args ...interface{}) {
+	c.name, c.args, c.err = name, args, errNotExecuted
+	p.cmds = append(p.cmds, c)
+}
+
+// Len returns the number of commands queued.
+func (p *Pipeline) Len() int {
+	return len(p.cmds)
+}
+
+// Do queues any command.
+func (p *Pipeline) Do(commandName string, args ...interface{}) *Cmd {
+	c := &Cmd{}
+	p.queue(c, commandName, args...)
+	return c
+}
+
+// Set queues the set of key, with the ttl in seconds if it is positive.
+func (p *Pipeline) Set(key string, value []byte, ttl int64) *Cmd {
+	c := &Cmd{}
+	if ttl > 0 {
+		p.queue(c, "set", key, value, "ex", ttl)
+	} else {
+		p.queue(c, "set", key, value)
+	}
+	return c
+}
+
+func (p *Pipeline) Get(key string) *BytesCmd {
+	c := &BytesCmd{}
+	p.queue(&c.Cmd, "get", key)
+	return c
+}
+
+func (p *Pipeline) Mset(keyvalues [][2][]byte) *Cmd {
+	args := make([]interface{}, 0, 2*len(keyvalues))
+	for _, kv := range keyvalues {
+		args = append(args, kv[0], kv[1])
+	}
+	c := &Cmd{}
+	p.queue(c, "mset", args...)
+	return c
+}
+
+func (p *Pipeline) Mget(keys ...string) *BytesSliceCmd {
+	c := &BytesSliceCmd{}
+	p.queue(&c.Cmd, "mget", stringArgs(nil, keys)...)
+	return c
+}
+
+func (p *Pipeline) Del(keys ...string) *IntCmd {
+	c := &IntCmd{}
+	p.queue(&c.Cmd, "del", stringArgs(nil, keys)...)
+	return c
+}
+
+func (p *Pipeline) Exists(key string) *BoolCmd {
+	c := &BoolCmd{}
+	p.queue(&c.Cmd, "exists", key)
+	return c
+}
+
+// Expire queues the expiration of key in ttl seconds.
+func (p *Pipeline) Expire(key string, ttl int64) *BoolCmd {
+	c := &BoolCmd{}
+	p.queue(&c.Cmd, "expire", key, ttl)
+	return c
+}
+
+func (p *Pipeline) HSet(key string, field string, value []byte) *IntCmd {
+	c := &IntCmd{}
+	p.queue(&c.Cmd, "hset", key, field, value)
+	return c
+}
+
+func (p *Pipeline) HGet(key string, field []byte) *BytesCmd {
+	c := &BytesCmd{}
+	p.queue(&c.Cmd, "hget", key, field)
+	return c
+}
+
+func (p *Pipeline) HMSet(key string, args ...[]byte) *Cmd {
+	c := &Cmd{}
+	p.queue(c, "hmset", bytesArgs(key, args)...)
+	return c
+}
+
+func (p *Pipeline) HMGet(key string, fields ...[]byte) *BytesSliceCmd {
+	c := &BytesSliceCmd{}
+	p.queue(&c.Cmd, "hmget", bytesArgs(key, fields)...)
+	return c
+}
+
+func (p *Pipeline) HDel(key string, fields ...[]byte) *IntCmd {
+	c := &IntCmd{}
+	p.queue(&c.Cmd, "hdel", bytesArgs(key, fields)...)
+	return c
+}
+
+func (p *Pipeline) SAdd(key string, members ...[]byte) *IntCmd {
+	c := &IntCmd{}
+	p.queue(&c.Cmd, "sadd", bytesArgs(key, members)...)
+	return c
+}
+
+func (p *Pipeline) ZAdd(key string, args ...[]byte) *IntCmd {
+	c := &IntCmd{}
+	p.queue(&c.Cmd, "zadd", bytesArgs(key, args)...)
+	return c
+}
+
+func stringArgs(args []interface{}, values []string) []interface{} {
+	for _, v := range values {
+		args = append(args, v)
+	}
+	return args
+}
+
+func bytesArgs(key string, values [][]byte) []interface{} {
+	args := make([]interface{}, 0, 1+len(values))
+	args = append(args, key)
+	for _, v := range values {
+		args = append(args, v)
+	}
+	return args
+}
+
+// Exec sends the queued commands in one round trip, and reads their
+// replies. Each command gets its own reply or error; Exec returns the
+// error of the round trip, or else the first error of a command. The
+// pipeline is empty afterwards, ready for other commands.
+func (p *Pipeline) Exec(ctx context.Context) error {
+	cmds := p.cmds
+	p.cmds = nil
+	if len(cmds) == 0 {
+		return nil
+	}
+	conn := p.service.get(ctx)
+	defer conn.Close()
+
+	var replies []interface{}
+	err := conn.run(func(conn redis.Conn, timeout time.Duration) error {
+		for _, c := range cmds {
+			if err := conn.Send(c.name, c.args...); err != nil {
+				return err
+			}
+		}
+		reply, err := redis.DoWithTimeout(conn, timeout, "")
+		replies, _ = reply.([]interface{})
+		return err
+	})
+	return setReplies(cmds, replies, err)
+}
+
+// setReplies sets the replies of cmds, or the error of the round trip which
+// sent them. It returns the error of the round trip, or else the first error
+// of a command.
+func setReplies(cmds []*Cmd, replies []interface{}, err error) error {
+	if err == nil && len(replies) != len(cmds) {
+		err = errors.New("redis: replies mismatch the commands")
+	}
+	if err != nil {
+		for _, c := range cmds {
+			c.err = err
+		}
+		return err
+	}
+	for i, c := range cmds {
+		c.reply, c.err = replies[i], nil
+		if rerr, ok := replies[i].(redis.Error); ok {
+			c.reply, c.err = nil, rerr
+			if err == nil {
+				err = rerr
+			}
+		}
+	}
+	return err
+}
@@ -0,0 +1,84 @@
+package redis
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func Test_Pipeline(t *testing.T) {
+	f, service := initFakeService(t)
+	ctx := context.Background()
+
+	p := service.Pipeline()
+	set := p.Set("name", []byte("alice"), 60)
+	p.HSet("user", "age", []byte("30"))
+	name := p.Get("name")
+	missing := p.Get("missing")
+	age := p.HGet("user", []byte("age"))
+	wrong := p.HGet("name", []byte("age"))
+	exists := p.Exists("user")
+	if _, err := name.Result(); err != errNotExecuted {
+		t.Fatalf("expected not executed, got %v", err)
+	}
+	before := f.roundTrips
+	if err := p.Exec(ctx); err == nil || !strings.HasPrefix(err.Error(), "WRONGTYPE") {
+		t.Fatalf("expected the error of a command, got %v", err)
+	}
+	if f.roundTrips != before+1 {
+		t.Fatalf("expected one round trip, got %d", f.roundTrips-before)
+	}
+	if set.Err() != nil || f.ttls["name"] != 60 {
+		t.Fatalf("bad set %v %d", set.Err(), f.ttls["name"])
+	}
+	if v, err := name.Result(); err != nil || string(v) != "alice" {
+		t.Fatalf("bad get %s %v", v, err)
+	}
+	if v, err := missing.Result(); err != nil || v != nil {
+		t.Fatalf("expected nil for a missing key, got %v %v", v, err)
+	}
+	if v, err := age.Result(); err != nil || string(v) != "30" {
+		t.Fatalf("bad hget %s %v", v, err)
+	}
+	if _, err := wrong.Result(); err == nil {
+		t.Fatalf("expected the error of hget on a string")
+	}
+	if ok, err := exists.Result(); err != nil || !ok {
+		t.Fatalf("bad exists %v %v", ok, err)
+	}
+	if p.Len() != 0 || p.Exec(ctx) != nil {
+		t.Fatalf("expected an empty pipeline after exec")
+	}
+}
+
+func Test_Pipeline_Canceled(t *testing.T) {
+	_, service := initFakeService(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p := service.Pipeline()
+	get := p.Get("name")
+	if err := p.Exec(ctx); err != context.Canceled {
+		t.Fatalf("expected canceled, got %v", err)
+	}
+	if _, err := get.Result(); err != context.Canceled {
+		t.Fatalf("expected the command canceled, got %v", err)
+	}
+}
+
+func Test_Pipeline_Mset(t *testing.T) {
+	f, service := initFakeService(t)
+	before := f.roundTrips
+	if err := service.Mset([][2][]byte{{[]byte("a"), []byte("1")}, {[]byte("b"), []byte("2")}}, 30); err != nil {
+		t.Fatal(err)
+	}
+	if f.roundTrips != before+1 || f.ttls["a"] != 30 || f.ttls["b"] != 30 {
+		t.Fatalf("expected mset and expires in one round trip, got %d %v", f.roundTrips-before, f.ttls)
+	}
+	values, err := service.Mget([]string{"a", "missing", "b"})
+	if err != nil || len(values) != 3 || string(values[0]) != "1" || values[1] != nil || string(values[2]) != "2" {
+		t.Fatalf("bad mget %q %v", values, err)
+	}
+	if err := service.Dels([]string{"a", "b"}); err != nil || len(f.strings) != 0 {
+		t.Fatalf("bad dels %v %v", f.strings, err)
+	}
+}
@@ -1,6 +1,7 @@
 package redis
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"time"
@@ -16,15 +17,28 @@ type RedisOptions struct {
 	IdleTimeout int
 	MaxIdle     int
 	MaxActive   int
+
+	// timeouts in milliseconds of dialing a connection, and of reading a
+	// reply or writing a command on it, none if 0
+	DialTimeout  int
+	ReadTimeout  int
+	WriteTimeout int
+
+	// retries of a transaction of Watch aborted by a change of a watched
+	// key, 3 if 0, none if negative
+	WatchRetries int
 }
 
 // RedisCacheService redis service define
 type RedisCacheService struct {
-	options RedisOptions
-	pool    *redis.Pool
-	log     log.Logger
+	options    RedisOptions
+	pool       *redis.Pool
+	log        log.Logger
+	contextual *RedisContextService
 }
 
+var _ Service = (*RedisCacheService)(nil)
+
 // Initialize redis service init
 func (service *RedisCacheService) Initialize(redisCfg interface{}, l log.Logger) {
 	options, ok := redisCfg.(RedisOptions)
@@ -44,7 +58,10 @@ func (service *RedisCacheService) Initialize(redisCfg interface{}, l log.Logger)
 				c   redis.Conn
 				err error
 			)
-			if c, err = redis.Dial("tcp", address); err != nil {
+			if c, err = redis.Dial("tcp", address,
+				redis.DialConnectTimeout(milliseconds(options.DialTimeout)),
+				redis.DialReadTimeout(milliseconds(options.ReadTimeout)),
+				redis.DialWriteTimeout(milliseconds(options.WriteTimeout))); err != nil {
 				service.log.Error("redis conn fail", "conn", address, "error", err)
 				return nil, err
 			}
@@ -58,6 +75,19 @@ func (service *RedisCacheService) Initialize(redisCfg interface{}, l log.Logger)
 			return c, nil
 		},
 	}
+	service.contextual = &RedisContextService{
+		pool:         service.pool,
+		log:          l,
+		readTimeout:  milliseconds(options.ReadTimeout),
+		watchRetries: options.WatchRetries,
+	}
+	if options.WatchRetries == 0 {
+		service.contextual.watchRetries = defaultWatchRetries
+	}
+}
+
+func milliseconds(ms int) time.Duration {
+	return time.Duration(ms) * time.Millisecond
 }
 
 // Start xx
@@ -70,10 +100,21 @@ func (service *RedisCacheService) Stop() {
 
 }
 
+// Stats returns the statistics of the connection pool.
+func (service *RedisCacheService) Stats() redis.PoolStats {
+	return service.pool.Stats()
+}
+
+// WithContext returns the variant of the service whose calls take a
+// context, and give up when it is done.
+func (service *RedisCacheService) WithContext() *RedisContextService {
+	return service.contextual
+}
+
 // -----------------string operation------------------
 // when set exist key, old key ttl must reset it
-func (service *RedisCacheService) Set(key string, value []byte, ttl int64) error {
-	conn := service.pool.Get()
+func (service *RedisContextService) Set(ctx context.Context, key string, value []byte, ttl int64) error {
+	conn := service.get(ctx)
 	defer conn.Close()
 
 	if _, err := conn.Do("set", key, value); err != nil {
@@ -90,8 +131,8 @@ func (service *RedisCacheService) Set(key string, value []byte, ttl int64) error
 	return nil
 }
 
-func (service *RedisCacheService) Get(key string) ([]byte, error) {
-	conn := service.pool.Get()
+func (service *RedisContextService) Get(ctx context.Context, key string) ([]byte, error) {
+	conn := service.get(ctx)
 	defer conn.Close()
 
 	reply, err := conn.Do("get", key)
@@ -106,70 +147,40 @@ func (service *RedisCacheService) Get(key string) ([]byte, error) {
 	}
 }
 
-func (service *RedisCacheService) Mset(keyvalues [][2][]byte, ttl int64) error {
-	conn := service.pool.Get()
-	defer conn.Close()
-
+func (service *RedisContextService) Mset(ctx context.Context, keyvalues [][2][]byte, ttl int64) error {
 	if len(keyvalues) <= 0 {
 		return nil
 	}
 
-	var list []interface{}
-	for _, v := range keyvalues {
-		list = append(list, v[0])
-		list = append(list, v[1])
-	}
-
-	if _, err := conn.Do("mset", list...); err != nil {
-		service.log.Error("redis String mset", "keyvalues", keyvalues, "error", err.Error())
-		return err
-	}
-
+	p := service.Pipeline()
+	p.Mset(keyvalues)
 	if ttl > 0 {
 		for _, kv := range keyvalues {
-			if _, err := conn.Do("expire", kv[0], ttl); err != nil {
-				service.log.Error("redis String expire", "key", kv[0], "error", err.Error())
-				return err
-			}
+			p.Expire(string(kv[0]), ttl)
 		}
 	}
+	if err := p.Exec(ctx); err != nil {
+		service.log.Error("redis String mset", "keyvalues", keyvalues, "error", err.Error())
+		return err
+	}
 	return nil
 }
 
-func (service *RedisCacheService) Mget(keys []string) ([][]byte, error) {
-	conn := service.pool.Get()
-	defer conn.Close()
-
+func (service *RedisContextService) Mget(ctx context.Context, keys []string) ([][]byte, error) {
 	if keys == nil || len(keys) <= 0 {
 		return [][]byte{}, nil
 	}
-	var list []interface{}
-	for _, v := range keys {
-		list = append(list, v)
-	}
-	reply, err := conn.Do("mget", list...)
-	res := [][]byte{}
-	if nil != err {
+	p := service.Pipeline()
+	values := p.Mget(keys...)
+	if err := p.Exec(ctx); err != nil {
 		service.log.Error("redis String mget", "key", keys, "error", err.Error())
 		return [][]byte{}, err
-	} else if nil == reply {
-		service.log.Debug("redis String get, no this key", "key", keys)
-		return [][]byte{}, err
-	} else {
-		rs := reply.([]interface{})
-		for _, r := range rs {
-			if nil != r {
-				res = append(res, r.([]byte))
-			} else {
-				res = append(res, nil)
-			}
-		}
-		return res, err
 	}
+	return values.Result()
 }
 
-func (service *RedisCacheService) Exists(key string) (bool, error) {
-	conn := service.pool.Get()
+func (service *RedisContextService) Exists(ctx context.Context, key string) (bool, error) {
+	conn := service.get(ctx)
 	defer conn.Close()
 
 	reply, err := conn.Do("exists", key)
@@ -186,8 +197,8 @@ func (service *RedisCacheService) Exists(key string) (bool, error) {
 	}
 }
 
-func (service *RedisCacheService) Del(key string) error {
-	conn := service.pool.Get()
+func (service *RedisContextService) Del(ctx context.Context, key string) error {
+	conn := service.get(ctx)
 	defer conn.Close()
 
 	_, err := conn.Do("del", key)
@@ -197,31 +208,25 @@ func (service *RedisCacheService) Del(key string) error {
 	return err
 }
 
-func (service *RedisCacheService) Dels(keys []string) error {
-	conn := service.pool.Get()
-	defer conn.Close()
-
+func (service *RedisContextService) Dels(ctx context.Context, keys []string) error {
 	if keys == nil || len(keys) <= 0 {
 		return nil
 	}
 
-	var list []interface{}
-	for _, v := range keys {
-		list = append(list, v)
-	}
-
-	num, err := conn.Do("del", list...)
-	if err != nil {
-		service.log.Error("redis String dels", "key", list, "error", err.Error())
+	p := service.Pipeline()
+	deleted := p.Del(keys...)
+	if err := p.Exec(ctx); err != nil {
+		service.log.Error("redis String dels", "key", keys, "error", err.Error())
 	} else {
-		service.log.Debug("redis String dels", "num", num.(int64))
+		num, _ := deleted.Result()
+		service.log.Debug("redis String dels", "num", num)
 	}
 
 	return nil
 }
 
-func (service *RedisCacheService) Keys(keyFormat string) ([][]byte, error) {
-	conn := service.pool.Get()
+func (service *RedisContextService) Keys(ctx context.Context, keyFormat string) ([][]byte, error) {
+	conn := service.get(ctx)
 	defer conn.Close()
 
 	reply, err := conn.Do("keys", keyFormat)
@@ -240,9 +245,37 @@ func (service *RedisCacheService) Keys(keyFormat string) ([][]byte, error) {
 	return res, err
 }
 
+// Scan returns a page of the keys matching the glob pattern match, and the
+// cursor of the next page, 0 once the iteration is complete. Unlike Keys it
+// does not block the server on a large keyspace. count hints the size of
+// the page, the server default is used if it is not positive.
+func (service *RedisContextService) Scan(ctx context.Context, cursor uint64, match string, count int64) (uint64, [][]byte, error) {
+	conn := service.get(ctx)
+	defer conn.Close()
+
+	args := []interface{}{cursor, "match", match}
+	if count > 0 {
+		args = append(args, "count", count)
+	}
+	reply, err := redis.Values(conn.Do("scan", args...))
+	if err == nil && len(reply) != 2 {
+		err = errors.New("redis: bad scan reply")
+	}
+	if err != nil {
+		service.log.Error("redis String scan", "error", err.Error())
+		return 0, nil, err
+	}
+	next, err := redis.Uint64(reply[0], nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	keys, err := redis.ByteSlices(reply[1], nil)
+	return next, keys, err
+}
+
 // -----------------set operation---------------------
-func (service *RedisCacheService) SAdd(key string, ttl int64, members ...[]byte) error {
-	conn := service.pool.Get()
+func (service *RedisContextService) SAdd(ctx context.Context, key string, ttl int64, members ...[]byte) error {
+	conn := service.get(ctx)
 	defer conn.Close()
 
 	vs := []interface{}{}
@@ -263,8 +296,8 @@ func (service *RedisCacheService) SAdd(key string, ttl int64, members ...[]byte)
 	return err
 }
 
-func (service *RedisCacheService) SRem(key string, members ...[]byte) (int64, error) {
-	conn := service.pool.Get()
+func (service *RedisContextService) SRem(ctx context.Context, key string, members ...[]byte) (int64, error) {
+	conn := service.get(ctx)
 	defer conn.Close()
 
 	vs := []interface{}{}
@@ -283,25 +316,26 @@ func (service *RedisCacheService) SRem(key string, members ...[]byte) (int64, er
 	}
 }
 
-func (service *RedisCacheService) SetNX(key string, value int64,ttl int64) error {
-	conn := service.pool.Get()
+// SetNX sets key only if it does not exist, with the ttl in seconds set in
+// the same command. It reports whether key was set.
+func (service *RedisContextService) SetNX(ctx context.Context, key string, value int64, ttl int) (bool, error) {
+	conn := service.get(ctx)
 	defer conn.Close()
-	if _, err := conn.Do("setnx", key, value); err != nil {
-		service.log.Error("redis String setnx", "key", key, "error", err.Error())
-		return err
-	}
 
+	args := []interface{}{key, value, "nx"}
 	if ttl > 0 {
-		if _, err := conn.Do("expire", key, ttl); err != nil {
-			service.log.Error("redis String setnx expire", "key", key, "ttl", ttl, "error", err.Error())
-			return err
-		}
+		args = append(args, "ex", ttl)
 	}
-	return nil
+	reply, err := conn.Do("set", args...)
+	if err != nil {
+		service.log.Error("redis String setnx", "key", key, "ttl", ttl, "error", err.Error())
+		return false, err
+	}
+	return reply != nil, nil
 }
 
-func (service *RedisCacheService) SCard(key string) (int64, error) {
-	conn := service.pool.Get()
+func (service *RedisContextService) SCard(ctx context.Context, key string) (int64, error) {
+	conn := service.get(ctx)
 	defer conn.Close()
 
 	reply, err := conn.Do("scard", key)
@@ -315,8 +349,8 @@ func (service *RedisCacheService) SCard(key string) (int64, error) {
 	}
 }
 
-func (service *RedisCacheService) SIsMember(key string, member []byte) (bool, error) {
-	conn := service.pool.Get()
+func (service *RedisContextService) SIsMember(ctx context.Context, key string, member []byte) (bool, error) {
+	conn := service.get(ctx)
 	defer conn.Close()
 
 	reply, err := conn.Do("sismember", key, member)
@@ -328,8 +362,8 @@ func (service *RedisCacheService) SIsMember(key string, member []byte) (bool, er
 	}
 }
 
-func (service *RedisCacheService) SMembers(key string) ([][]byte, error) {
-	conn := service.pool.Get()
+func (service *RedisContextService) SMembers(ctx context.Context, key string) ([][]byte, error) {
+	conn := service.get(ctx)
 	defer conn.Close()
 
 	reply, err := conn.Do("smembers", key)
@@ -347,8 +381,8 @@ func (service *RedisCacheService) SMembers(key string) ([][]byte, error) {
 }
 
 // -----------------zset operation-------------------
-func (service *RedisCacheService) ZAdd(key string, ttl int64, args ...[]byte) error {
-	conn := service.pool.Get()
+func (service *RedisContextService) ZAdd(ctx context.Context, key string, ttl int64, args ...[]byte) error {
+	conn := service.get(ctx)
 	defer conn.Close()
 
 	if len(args)%2 != 0 {
@@ -372,8 +406,8 @@ func (service *RedisCacheService) ZAdd(key string, ttl int64, args ...[]byte) er
 	return err
 }
 
-func (service *RedisCacheService) ZRem(key string, args ...[]byte) (int64, error) {
-	conn := service.pool.Get()
+func (service *RedisContextService) ZRem(ctx context.Context, key string, args ...[]byte) (int64, error) {
+	conn := service.get(ctx)
 	defer conn.Close()
 
 	vs := []interface{}{}
@@ -391,8 +425,8 @@ func (service *RedisCacheService) ZRem(key string, args ...[]byte) (int64, error
 	}
 }
 
-func (service *RedisCacheService) ZCard(key string) (int64, error) {
-	conn := service.pool.Get()
+func (service *RedisContextService) ZCard(ctx context.Context, key string) (int64, error) {
+	conn := service.get(ctx)
 	defer conn.Close()
 
 	reply, err := conn.Do("zcard", key)
@@ -405,8 +439,8 @@ func (service *RedisCacheService) ZCard(key string) (int64, error) {
 	}
 }
 
-func (service *RedisCacheService) ZRank(key string, member []byte) (int64, error) {
-	conn := service.pool.Get()
+func (service *RedisContextService) ZRank(ctx context.Context, key string, member []byte) (int64, error) {
+	conn := service.get(ctx)
 	defer conn.Close()
 
 	vs := []interface{}{}
@@ -425,8 +459,8 @@ func (service *RedisCacheService) ZRank(key string, member []byte) (int64, error
 	}
 }
 
-func (service *RedisCacheService) ZRevRank(key string, member []byte) (int64, error) {
-	conn := service.pool.Get()
+func (service *RedisContextService) ZRevRank(ctx context.Context, key string, member []byte) (int64, error) {
+	conn := service.get(ctx)
 	defer conn.Close()
 
 	vs := []interface{}{}
@@ -445,8 +479,8 @@ func (service *RedisCacheService) ZRevRank(key string, member []byte) (int64, er
 	}
 }
 
-func (service *RedisCacheService) ZRange(key string, start, stop int64, withScores bool) ([][]byte, error) {
-	conn := service.pool.Get()
+func (service *RedisContextService) ZRange(ctx context.Context, key string, start, stop int64, withScores bool) ([][]byte, error) {
+	conn := service.get(ctx)
 	defer conn.Close()
 
 	vs := []interface{}{}
@@ -472,8 +506,8 @@ func (service *RedisCacheService) ZRange(key string, start, stop int64, withScor
 	return res, err
 }
 
-func (service *RedisCacheService) ZRangeByScore(key string, min, max interface{}, withScores bool) ([][]byte, error) {
-	conn := service.pool.Get()
+func (service *RedisContextService) ZRangeByScore(ctx context.Context, key string, min, max interface{}, withScores bool) ([][]byte, error) {
+	conn := service.get(ctx)
 	defer conn.Close()
 
 	vs := []interface{}{}
@@ -499,8 +533,8 @@ func (service *RedisCacheService) ZRangeByScore(key string, min, max interface{}
 	return res, err
 }
 
-func (service *RedisCacheService) ZRevRange(key string, start, stop int64, withScores bool) ([][]byte, error) {
-	conn := service.pool.Get()
+func (service *RedisContextService) ZRevRange(ctx context.Context, key string, start, stop int64, withScores bool) ([][]byte, error) {
+	conn := service.get(ctx)
 	defer conn.Close()
 
 	vs := []interface{}{}
@@ -526,11 +560,11 @@ func (service *RedisCacheService) ZRevRange(key string, start, stop int64, withS
 	return res, err
 }
 
-func (service *RedisCacheService) ZRemRangeByScore(key string, start, stop int64) (int64, error) {
+func (service *RedisContextService) ZRemRangeByScore(ctx context.Context, key string, start, stop int64) (int64, error) {
 
 	//log.Info("[REDIS-ZRemRangeByScore] key : " + key)
 
-	conn := service.pool.Get()
+	conn := service.get(ctx)
 	defer conn.Close()
 
 	vs := []interface{}{}
@@ -548,8 +582,8 @@ func (service *RedisCacheService) ZRemRangeByScore(key string, start, stop int64
 }
 
 // -----------------hash operation-------------------
-func (service *RedisCacheService) HSet(key string, ttl int64, field string, value []byte) error {
-	conn := service.pool.Get()
+func (service *RedisContextService) HSet(ctx context.Context, key string, ttl int64, field string, value []byte) error {
+	conn := service.get(ctx)
 	defer conn.Close()
 
 	vs := []interface{}{}
@@ -570,8 +604,8 @@ func (service *RedisCacheService) HSet(key string, ttl int64, field string, valu
 	return err
 }
 
-func (service *RedisCacheService) HGet(key string, field []byte) ([]byte, error) {
-	conn := service.pool.Get()
+func (service *RedisContextService) HGet(ctx context.Context, key string, field []byte) ([]byte, error) {
+	conn := service.get(ctx)
 	defer conn.Close()
 
 	var vs []interface{}
@@ -591,8 +625,8 @@ func (service *RedisCacheService) HGet(key string, field []byte) ([]byte, error)
 	}
 }
 
-func (service *RedisCacheService) HMSet(key string, ttl int64, args ...[]byte) error {
-	conn := service.pool.Get()
+func (service *RedisContextService) HMSet(ctx context.Context, key string, ttl int64, args ...[]byte) error {
+	conn := service.get(ctx)
 	defer conn.Close()
 
 	if len(args)%2 != 0 {
@@ -616,8 +650,8 @@ func (service *RedisCacheService) HMSet(key string, ttl int64, args ...[]byte) e
 	return err
 }
 
-func (service *RedisCacheService) HMGet(key string, fields ...[]byte) ([][]byte, error) {
-	conn := service.pool.Get()
+func (service *RedisContextService) HMGet(ctx context.Context, key string, fields ...[]byte) ([][]byte, error) {
+	conn := service.get(ctx)
 	defer conn.Close()
 
 	vs := []interface{}{}
@@ -643,8 +677,8 @@ func (service *RedisCacheService) HMGet(key string, fields ...[]byte) ([][]byte,
 	return res, err
 }
 
-func (service *RedisCacheService) HDel(key string, fields ...[]byte) (int64, error) {
-	conn := service.pool.Get()
+func (service *RedisContextService) HDel(ctx context.Context, key string, fields ...[]byte) (int64, error) {
+	conn := service.get(ctx)
 	defer conn.Close()
 
 	vs := []interface{}{}
@@ -663,8 +697,8 @@ func (service *RedisCacheService) HDel(key string, fields ...[]byte) (int64, err
 	}
 }
 
-func (service *RedisCacheService) HExists(key string, field []byte) (bool, error) {
-	conn := service.pool.Get()
+func (service *RedisContextService) HExists(ctx context.Context, key string, field []byte) (bool, error) {
+	conn := service.get(ctx)
 	defer conn.Close()
 
 	reply, err := conn.Do("hexists", key, field)
@@ -678,8 +712,8 @@ func (service *RedisCacheService) HExists(key string, field []byte) (bool, error
 	return false, err
 }
 
-func (service *RedisCacheService) HKeys(key string) ([][]byte, error) {
-	conn := service.pool.Get()
+func (service *RedisContextService) HKeys(ctx context.Context, key string) ([][]byte, error) {
+	conn := service.get(ctx)
 	defer conn.Close()
 
 	reply, err := conn.Do("hkeys", key)
@@ -696,8 +730,8 @@ func (service *RedisCacheService) HKeys(key string) ([][]byte, error) {
 	return res, err
 }
 
-func (service *RedisCacheService) HVals(key string) ([][]byte, error) {
-	conn := service.pool.Get()
+func (service *RedisContextService) HVals(ctx context.Context, key string) ([][]byte, error) {
+	conn := service.get(ctx)
 	defer conn.Close()
 
 	reply, err := conn.Do("hvals", key)
@@ -714,8 +748,8 @@ func (service *RedisCacheService) HVals(key string) ([][]byte, error) {
 	return res, err
 }
 
-func (service *RedisCacheService) HGetAll(key string) ([][]byte, error) {
-	conn := service.pool.Get()
+func (service *RedisContextService) HGetAll(ctx context.Context, key string) ([][]byte, error) {
+	conn := service.get(ctx)
 	defer conn.Close()
 
 	reply, err := conn.Do("hgetall", key)
@@ -732,8 +766,8 @@ func (service *RedisCacheService) HGetAll(key string) ([][]byte, error) {
 	return res, err
 }
 
-func (service *RedisCacheService) HLen(key string) (int64, error) {
-	conn := service.pool.Get()
+func (service *RedisContextService) HLen(ctx context.Context, key string) (int64, error) {
+	conn := service.get(ctx)
 	defer conn.Close()
 
 	reply, err := conn.Do("hlen", key)
@@ -748,8 +782,8 @@ func (service *RedisCacheService) HLen(key string) (int64, error) {
 }
 
 // -----------------list operation--------------------
-func (service *RedisCacheService) LRpush(key string, args ...[]byte) (int64, error) {
-	conn := service.pool.Get()
+func (service *RedisContextService) LRpush(ctx context.Context, key string, args ...[]byte) (int64, error) {
+	conn := service.get(ctx)
 	defer conn.Close()
 
 	vs := []interface{}{}
@@ -768,8 +802,8 @@ func (service *RedisCacheService) LRpush(key string, args ...[]byte) (int64, err
 	}
 }
 
-func (service *RedisCacheService) LLpush(key string, args ...[]byte) (int64, error) {
-	conn := service.pool.Get()
+func (service *RedisContextService) LLpush(ctx context.Context, key string, args ...[]byte) (int64, error) {
+	conn := service.get(ctx)
 	defer conn.Close()
 
 	vs := []interface{}{}
@@ -788,8 +822,8 @@ func (service *RedisCacheService) LLpush(key string, args ...[]byte) (int64, err
 	}
 }
 
-func (service *RedisCacheService) LRpop(key string) ([]byte, error) {
-	conn := service.pool.Get()
+func (service *RedisContextService) LRpop(ctx context.Context, key string) ([]byte, error) {
+	conn := service.get(ctx)
 	defer conn.Close()
 
 	reply, err := conn.Do("rpop", key)
@@ -805,8 +839,8 @@ func (service *RedisCacheService) LRpop(key string) ([]byte, error) {
 	}
 }
 
-func (service *RedisCacheService) LLpop(key string) ([]byte, error) {
-	conn := service.pool.Get()
+func (service *RedisContextService) LLpop(ctx context.Context, key string) ([]byte, error) {
+	conn := service.get(ctx)
 	defer conn.Close()
 
 	reply, err := conn.Do("lpop", key)
@@ -822,8 +856,8 @@ func (service *RedisCacheService) LLpop(key string) ([]byte, error) {
 	}
 }
 
-func (service *RedisCacheService) LIndex(key string, index int64) ([]byte, error) {
-	conn := service.pool.Get()
+func (service *RedisContextService) LIndex(ctx context.Context, key string, index int64) ([]byte, error) {
+	conn := service.get(ctx)
 	defer conn.Close()
 
 	vs := []interface{}{}
@@ -844,8 +878,8 @@ func (service *RedisCacheService) LIndex(key string, index int64) ([]byte, error
 }
 
 
-func (service *RedisCacheService) LLlen(key string) (int64, error) {
-	conn := service.pool.Get()
+func (service *RedisContextService) LLlen(ctx context.Context, key string) (int64, error) {
+	conn := service.get(ctx)
 	defer conn.Close()
 
 	reply, err := conn.Do("llen", key)
@@ -8,6 +8,7 @@ import (
 	"github.com/justoxh/go-toolkit/log/logruslogger"
 	"os"
 	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/naoina/toml"
@@ -360,6 +361,32 @@ func Test_String_Keys(t *testing.T) {
 	}
 }
 
+func Test_String_Scan(t *testing.T) {
+	_, service := initFakeService(t)
+	for _, key := range []string{"user:1", "user:2", "user:*", "order:1", "user:3"} {
+		service.Set(key, []byte("v"), 0)
+	}
+
+	var keys []string
+	cursor, pages := uint64(0), 0
+	for {
+		next, page, err := service.Scan(cursor, "user:*", 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, key := range page {
+			keys = append(keys, string(key))
+		}
+		pages++
+		if cursor = next; cursor == 0 {
+			break
+		}
+	}
+	if pages != 3 || strings.Join(keys, ",") != "user:*,user:1,user:2,user:3" {
+		t.Fatalf("bad scan of %d pages %v", pages, keys)
+	}
+}
+
 func Test_Set_SAdd(t *testing.T) {
 	redisService := InitService()
 	// members is nil
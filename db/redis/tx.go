@@ -0,0 +1,136 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// ErrTxAborted is returned by Watch when EXEC aborted the transaction on
+// every attempt, since a watched key changed.
+var ErrTxAborted = errors.New("redis: transaction aborted, a watched key changed")
+
+// defaultWatchRetries is the number of retries of a transaction of Watch
+// when RedisOptions.WatchRetries is 0.
+const defaultWatchRetries = 3
+
+// Tx is a transaction of Watch. Its commands run right away on the
+// connection of the transaction, to read the watched keys, while the
+// commands queued on Multi run atomically by MULTI/EXEC once the function
+// of Watch returns.
+type Tx struct {
+	conn  *ctxConn
+	multi *Pipeline
+}
+
+// Do runs a command right away.
+func (tx *Tx) Do(commandName string, args ...interface{}) (interface{}, error) {
+	return tx.conn.Do(commandName, args...)
+}
+
+// Get returns the value of key, nil if it does not exist.
+func (tx *Tx) Get(key string) ([]byte, error) {
+	return nilBytes(tx.conn.Do("get", key))
+}
+
+// HGet returns the value of field of the hash key, nil if it does not exist.
+func (tx *Tx) HGet(key string, field []byte) ([]byte, error) {
+	return nilBytes(tx.conn.Do("hget", key, field))
+}
+
+// Multi returns the pipeline of the commands run by EXEC, which must not be
+// executed with Exec. Their results are set once EXEC ran, and are
+// ErrTxAborted if it aborted.
+func (tx *Tx) Multi() *Pipeline {
+	return tx.multi
+}
+
+func nilBytes(reply interface{}, err error) ([]byte, error) {
+	v, err := redis.Bytes(reply, err)
+	if err == redis.ErrNil {
+		return nil, nil
+	}
+	return v, err
+}
+
+// Watch runs a transaction on a pooled connection: it watches keys, calls
+// fn, which reads them with tx and queues commands on tx.Multi(), then runs
+// the commands with MULTI/EXEC. If a watched key changed before EXEC, which
+// aborts, the transaction is tried again from the watch, up to
+// RedisOptions.WatchRetries times, then Watch returns ErrTxAborted. An
+// error of fn is returned as is, without running the commands.
+//
+//	err := service.Watch(ctx, []string{"balances"}, func(tx *Tx) error {
+//		from, err := tx.HGet("balances", []byte("alice"))
+//		...
+//		tx.Multi().HSet("balances", "alice", debited)
+//		tx.Multi().HSet("balances", "bob", credited)
+//		return nil
+//	})
+func (service *RedisContextService) Watch(ctx context.Context, keys []string, fn func(tx *Tx) error) error {
+	conn := service.get(ctx)
+	defer conn.Close()
+
+	for attempt := 0; ; attempt++ {
+		if _, err := conn.Do("watch", stringArgs(nil, keys)...); err != nil {
+			service.log.Error("redis tx watch", "keys", keys, "error", err.Error())
+			return err
+		}
+		tx := &Tx{conn: conn, multi: service.Pipeline()}
+		if err := fn(tx); err != nil {
+			// the connection is unwatched when it goes back to the pool
+			return err
+		}
+		err := tx.exec()
+		if err != ErrTxAborted {
+			if err != nil {
+				service.log.Error("redis tx exec", "keys", keys, "error", err.Error())
+			}
+			return err
+		}
+		if attempt >= service.watchRetries {
+			service.log.Error("redis tx exec", "keys", keys, "attempts", attempt+1, "error", err.Error())
+			return err
+		}
+		service.log.Debug("redis tx aborted, retry", "keys", keys, "attempt", attempt+1)
+	}
+}
+
+// Watch runs a transaction as RedisContextService.Watch does, with
+// context.Background().
+func (service *RedisCacheService) Watch(keys []string, fn func(tx *Tx) error) error {
+	return service.contextual.Watch(context.Background(), keys, fn)
+}
+
+// exec runs the commands queued on Multi with MULTI/EXEC, in one round
+// trip. It returns ErrTxAborted if EXEC aborted.
+func (tx *Tx) exec() error {
+	cmds := tx.multi.cmds
+	tx.multi.cmds = nil
+	if len(cmds) == 0 {
+		_, err := tx.conn.Do("unwatch")
+		return err
+	}
+
+	var reply interface{}
+	err := tx.conn.run(func(conn redis.Conn, timeout time.Duration) (err error) {
+		conn.Send("multi")
+		for _, c := range cmds {
+			conn.Send(c.name, c.args...)
+		}
+		// the error of a command which could not be queued, if any, which
+		// fails EXEC too
+		reply, err = redis.DoWithTimeout(conn, timeout, "exec")
+		return err
+	})
+	var replies []interface{}
+	if err == nil {
+		if reply == nil {
+			err = ErrTxAborted
+		}
+		replies, _ = reply.([]interface{})
+	}
+	return setReplies(cmds, replies, err)
+}
@@ -0,0 +1,76 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+// transfer moves amount from the balance of from to the one of to, in the
+// hash balances.
+func transfer(service *RedisCacheService, from, to string, amount int64, during func(attempt int)) (int, error) {
+	attempts := 0
+	err := service.Watch([]string{"balances"}, func(tx *Tx) error {
+		attempts++
+		balance := func(name string) int64 {
+			v, _ := tx.HGet("balances", []byte(name))
+			n, _ := strconv.ParseInt(string(v), 10, 64)
+			return n
+		}
+		a, b := balance(from), balance(to)
+		if during != nil {
+			during(attempts)
+		}
+		tx.Multi().HSet("balances", from, []byte(strconv.FormatInt(a-amount, 10)))
+		tx.Multi().HSet("balances", to, []byte(strconv.FormatInt(b+amount, 10)))
+		return nil
+	})
+	return attempts, err
+}
+
+func Test_Watch(t *testing.T) {
+	f, service := initFakeService(t)
+	service.HMSet("balances", 0, []byte("alice"), []byte("100"), []byte("bob"), []byte("0"))
+
+	// another client changes the balances during the first attempt
+	attempts, err := transfer(service, "alice", "bob", 30, func(attempt int) {
+		if attempt == 1 {
+			service.HSet("balances", 0, "alice", []byte("50"))
+		}
+	})
+	if err != nil || attempts != 2 {
+		t.Fatalf("expected a retry, got %d attempts %v", attempts, err)
+	}
+	if a, b := string(f.hashes["balances"]["alice"]), string(f.hashes["balances"]["bob"]); a != "20" || b != "30" {
+		t.Fatalf("bad balances %s %s", a, b)
+	}
+}
+
+func Test_Watch_Aborted(t *testing.T) {
+	f, service := initFakeService(t)
+	service.HMSet("balances", 0, []byte("alice"), []byte("100"), []byte("bob"), []byte("0"))
+
+	attempts, err := transfer(service, "alice", "bob", 30, func(attempt int) {
+		service.HSet("balances", 0, "alice", []byte(strconv.Itoa(100+attempt)))
+	})
+	if err != ErrTxAborted || attempts != defaultWatchRetries+1 {
+		t.Fatalf("expected aborted after %d attempts, got %d attempts %v", defaultWatchRetries+1, attempts, err)
+	}
+	if b := string(f.hashes["balances"]["bob"]); b != "0" {
+		t.Fatalf("expected no transfer, got %s", b)
+	}
+}
+
+func Test_Watch_Error(t *testing.T) {
+	f, service := initFakeService(t)
+	insufficient := errors.New("insufficient balance")
+	var set *IntCmd
+	err := service.WithContext().Watch(context.Background(), []string{"balances"}, func(tx *Tx) error {
+		set = tx.Multi().HSet("balances", "alice", []byte("1"))
+		return insufficient
+	})
+	if err != insufficient || set.Err() != errNotExecuted || len(f.hashes) != 0 {
+		t.Fatalf("expected nothing run, got %v %v %v", err, set.Err(), f.hashes)
+	}
+}
@@ -1,14 +1,17 @@
 package logruslogger
 
 import (
+	"context"
 	"fmt"
 
+	"github.com/justoxh/go-toolkit/trace"
 	"github.com/sirupsen/logrus"
 )
 
 // LogrusLogger logrus logger
 type LogrusLogger struct {
-	log *logrus.Logger
+	log   *logrus.Logger
+	entry *logrus.Entry // fields added by WithContext, nil if none
 }
 
 // GetLogger convert LogrusLogger to *logrus.Logger
@@ -16,72 +19,124 @@ func (l *LogrusLogger) GetLogger() *logrus.Logger {
 	return l.log
 }
 
+// WithContext returns a logger which adds the request ID and the traceparent
+// carried by ctx as the request_id and traceparent fields.
+func (l *LogrusLogger) WithContext(ctx context.Context) *LogrusLogger {
+	fields := logrus.Fields{}
+	if id := trace.RequestID(ctx); id != "" {
+		fields["request_id"] = id
+	}
+	if tp := trace.TraceParent(ctx); tp != "" {
+		fields["traceparent"] = tp
+	}
+	if len(fields) == 0 {
+		return l
+	}
+	entry := l.entry
+	if entry == nil {
+		entry = logrus.NewEntry(l.log)
+	}
+	return &LogrusLogger{log: l.log, entry: entry.WithFields(fields)}
+}
+
+// output is the part of *logrus.Logger used by LogrusLogger.
+type output interface {
+	Debug(args ...interface{})
+	Info(args ...interface{})
+	Warn(args ...interface{})
+	Print(args ...interface{})
+	Panic(args ...interface{})
+	Fatal(args ...interface{})
+	Error(args ...interface{})
+}
+
+// entryOutput logs through an entry with the same stack depth as
+// *logrus.Logger, so that CallerHook still reports the right caller.
+type entryOutput struct {
+	entry *logrus.Entry
+}
+
+func (o entryOutput) Debug(args ...interface{}) { o.entry.Debug(args...) }
+func (o entryOutput) Info(args ...interface{})  { o.entry.Info(args...) }
+func (o entryOutput) Warn(args ...interface{})  { o.entry.Warn(args...) }
+func (o entryOutput) Print(args ...interface{}) { o.entry.Info(args...) }
+func (o entryOutput) Panic(args ...interface{}) { o.entry.Panic(args...) }
+func (o entryOutput) Fatal(args ...interface{}) { o.entry.Fatal(args...) }
+func (o entryOutput) Error(args ...interface{}) { o.entry.Error(args...) }
+
+func (l *LogrusLogger) out() output {
+	if l.entry != nil {
+		return entryOutput{l.entry}
+	}
+	return l.log
+}
+
 // Debug wrapper Debug logger
 func (l *LogrusLogger) Debug(f interface{}, args ...interface{}) {
-	l.log.Debug(FormatLog(f, args...))
+	l.out().Debug(FormatLog(f, args...))
 }
 
 // Info wrapper Info logger
 func (l *LogrusLogger) Info(f interface{}, args ...interface{}) {
-	l.log.Info(FormatLog(f, args...))
+	l.out().Info(FormatLog(f, args...))
 }
 
 // Warn wrapper Warn logger
 func (l *LogrusLogger) Warn(f interface{}, args ...interface{}) {
-	l.log.Warn(FormatLog(f, args...))
+	l.out().Warn(FormatLog(f, args...))
 }
 
 // Printf wrapper Printf logger
 func (l *LogrusLogger) Printf(f interface{}, args ...interface{}) {
-	l.log.Print(FormatLog(f, args...))
+	l.out().Print(FormatLog(f, args...))
 }
 
 // Panic wrapper Panic logger
 func (l *LogrusLogger) Panic(f interface{}, args ...interface{}) {
-	l.log.Panic(FormatLog(f, args...))
+	l.out().Panic(FormatLog(f, args...))
 }
 
 // Fatal wrapper Fatal logger
 func (l *LogrusLogger) Fatal(f interface{}, args ...interface{}) {
-	l.log.Fatal(FormatLog(f, args...))
+	l.out().Fatal(FormatLog(f, args...))
 }
 
 // Error wrapper Error logger
 func (l *LogrusLogger) Error(f interface{}, args ...interface{}) {
-	l.log.Error(FormatLog(f, args...))
+	l.out().Error(FormatLog(f, args...))
 }
 
 // Debugln wrapper Debugln logger
 func (l *LogrusLogger) Debugln(v ...interface{}) {
-	l.log.Debug(fmt.Sprintln(v...))
+	l.out().Debug(fmt.Sprintln(v...))
 }
 
 // Infoln wrapper Infoln logger
 func (l *LogrusLogger) Infoln(args ...interface{}) {
-	l.log.Info(fmt.Sprintln(args...))
+	l.out().Info(fmt.Sprintln(args...))
 }
 
 // Warnln wrapper Warnln logger
 func (l *LogrusLogger) Warnln(args ...interface{}) {
-	l.log.Warn(fmt.Sprintln(args...))
+	l.out().Warn(fmt.Sprintln(args...))
 }
 
 // Printfln wrapper Printfln logger
 func (l *LogrusLogger) Printfln(args ...interface{}) {
-	l.log.Print(fmt.Sprintln(args...))
+	l.out().Print(fmt.Sprintln(args...))
 }
 
 // Panicln wrapper Panicln logger
 func (l *LogrusLogger) Panicln(args ...interface{}) {
-	l.log.Panic(fmt.Sprintln(args...))
+	l.out().Panic(fmt.Sprintln(args...))
 }
 
 // Fatalln wrapper Fatalln logger
 func (l *LogrusLogger) Fatalln(args ...interface{}) {
-	l.log.Fatal(fmt.Sprintln(args...))
+	l.out().Fatal(fmt.Sprintln(args...))
 }
 
 // Errorln wrapper Errorln logger
 func (l *LogrusLogger) Errorln(args ...interface{}) {
-	l.log.Error(fmt.Sprintln(args...))
+	l.out().Error(fmt.Sprintln(args...))
 }
@@ -0,0 +1,43 @@
+package logruslogger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/justoxh/go-toolkit/trace"
+	"github.com/sirupsen/logrus"
+)
+
+func Test_WithContext(t *testing.T) {
+	options := &Options{}
+	options.WithCallerHook = true
+	options.Depth = 8
+	options.DisableConsole = true
+
+	a := GetLoggerWithOptions("ctx-logrus", options)
+	var buf bytes.Buffer
+	a.GetLogger().Out = &buf
+	a.GetLogger().Formatter = &logrus.JSONFormatter{}
+
+	if a.WithContext(context.Background()) != a {
+		t.Fatalf("expected the same logger for an empty context")
+	}
+
+	ctx := trace.WithRequestID(context.Background(), "req-1")
+	ctx = trace.WithTraceParent(ctx, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	a.WithContext(ctx).Info("test %v", 1)
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &fields); err != nil {
+		t.Fatalf("bad log line %q: %s", buf.String(), err)
+	}
+	if fields["request_id"] != "req-1" || fields["traceparent"] != "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01" {
+		t.Fatalf("missing context fields: %v", fields)
+	}
+	if caller, _ := fields["caller"].(string); !strings.HasPrefix(caller, "log_context_test.go:") {
+		t.Fatalf("bad caller %v", fields["caller"])
+	}
+}
@@ -137,3 +137,22 @@ func Test_ErrorPath(t *testing.T) {
 	_ = GetLoggerWithOptions("aa-logrus", options)
 
 }
+
+func Test_SetLevel(t *testing.T) {
+	GetLoggerWithOptions("level-logrus", &Options{Level: "info", DisableConsole: true})
+	if level := Loggers()["level-logrus"]; level != "info" {
+		t.Fatalf("expected info, got %q", level)
+	}
+	if err := SetLevel("level-logrus", "warn"); err != nil {
+		t.Fatal(err)
+	}
+	if level := Loggers()["level-logrus"]; level != "warn" {
+		t.Fatalf("expected warn, got %q", level)
+	}
+	if err := SetLevel("level-logrus", "verbose"); err == nil {
+		t.Fatalf("expected error for unknown level")
+	}
+	if err := SetLevel("missing-logrus", "warn"); err == nil {
+		t.Fatalf("expected error for unknown logger")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	rotatelogs "github.com/lestrrat-go/file-rotatelogs"
@@ -172,3 +173,45 @@ func GetLoggerWithOptions(logName string, options *Options) *LogrusLogger {
 	fmt.Printf("register logger %v, store in %v, current loggers: %v\n", logName, logDir, logMap)
 	return curLog
 }
+
+// Loggers returns the level of each logger registered by
+// GetLoggerWithOptions, by name.
+func Loggers() map[string]string {
+	getLogMutex.Lock()
+	defer getLogMutex.Unlock()
+
+	levels := make(map[string]string, len(logMap))
+	for name, l := range logMap {
+		level := logrus.Level(atomic.LoadUint32((*uint32)(&l.log.Level)))
+		levels[name] = levelName(level)
+	}
+	return levels
+}
+
+// levelName returns the name of level in logLevelMap.
+func levelName(level logrus.Level) string {
+	for name, l := range logLevelMap {
+		if l == level {
+			return name
+		}
+	}
+	return level.String()
+}
+
+// SetLevel changes the level of the registered logger logName at runtime.
+func SetLevel(logName, level string) error {
+	logLevel, ok := logLevelMap[level]
+	if !ok {
+		return fmt.Errorf("unknown log level %q", level)
+	}
+
+	getLogMutex.Lock()
+	defer getLogMutex.Unlock()
+
+	curLog, ok := logMap[logName]
+	if !ok {
+		return fmt.Errorf("unknown logger %q", logName)
+	}
+	curLog.log.SetLevel(logLevel)
+	return nil
+}
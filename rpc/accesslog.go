@@ -0,0 +1,142 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"time"
+
+	"github.com/justoxh/go-toolkit/log"
+	"github.com/justoxh/go-toolkit/trace"
+)
+
+// Transports of the calls, as reported by the access log.
+const (
+	TransportHTTP      = "http"
+	TransportREST      = "rest"
+	TransportSSE       = "sse"
+	TransportWebsocket = "ws"
+	TransportConnect   = "connect"
+)
+
+// AccessLogOptions access log options config
+type AccessLogOptions struct {
+	SampleRate float64  // share of calls logged with their params and result, from 0 to 1
+	Redact     []string // names of members whose values are redacted, at any depth
+}
+
+// accessLog writes an entry per call.
+type accessLog struct {
+	log    log.Logger
+	bodies *Recorder // samples and redacts the params and results, nil if none are logged
+}
+
+// SetAccessLog writes an entry per call served by the server to l, at info
+// level, with the fields:
+//
+//	transport    http, rest, sse, ws, connect or the one of WithTransport
+//	remote       address of the client
+//	subject      authenticated subject of WithSubject
+//	method       with its version suffix
+//	code         error code, 0 on success
+//	latency      duration of the call
+//	request_id
+//
+// and, for options.SampleRate of the calls, the sizes of the JSON encodings
+// of the params and the result, params_size and result_size, and the params
+// and the result with the values of the options.Redact members replaced. A nil l disables the
+// access log.
+func (server *Server) SetAccessLog(l log.Logger, options *AccessLogOptions) {
+	if l == nil {
+		server.accessLog = nil
+		return
+	}
+	a := &accessLog{log: l}
+	if options != nil && options.SampleRate > 0 {
+		a.bodies = NewRecorder(ioutil.Discard, &RecorderOptions{SampleRate: options.SampleRate, Redact: options.Redact})
+	}
+	server.accessLog = a
+}
+
+// transportKey is the context key of the transport of a call.
+type transportKey struct{}
+
+type transportInfo struct {
+	name   string
+	remote string
+}
+
+// WithTransport returns a copy of ctx in which the calls are logged as
+// served by transport for the client at remoteAddr. It labels the calls of
+// the codecs served with ServeCodecContext.
+func WithTransport(ctx context.Context, transport, remoteAddr string) context.Context {
+	return context.WithValue(ctx, transportKey{}, transportInfo{name: transport, remote: remoteAddr})
+}
+
+// subjectKey is the context key of the authenticated subject of a call.
+type subjectKey struct{}
+
+// WithSubject returns a copy of ctx carrying the authenticated subject of
+// its calls, such as a user ID, typically set by an authentication
+// middleware wrapping HTTPServer or WsRPCServer.ServeWS.
+func WithSubject(ctx context.Context, subject string) context.Context {
+	return context.WithValue(ctx, subjectKey{}, subject)
+}
+
+// Subject returns the authenticated subject carried by ctx.
+func Subject(ctx context.Context) string {
+	s, _ := ctx.Value(subjectKey{}).(string)
+	return s
+}
+
+// withSubjectOf returns a copy of ctx carrying the subject of from.
+func withSubjectOf(ctx, from context.Context) context.Context {
+	if s := Subject(from); s != "" {
+		return WithSubject(ctx, s)
+	}
+	return ctx
+}
+
+// logAccess writes the entry of a call which started at start. argv and
+// replyv are invalid for the calls which failed before being dispatched.
+// Batch calls are not logged themselves, their elements are.
+func (server *Server) logAccess(ctx context.Context, serviceMethod string, start time.Time, argv, replyv reflect.Value, errmsg string) {
+	a := server.accessLog
+	if a == nil || isBatchMethod(serviceMethod) {
+		return
+	}
+	t, _ := ctx.Value(transportKey{}).(transportInfo)
+	code := 0
+	if errmsg != "" {
+		code = responseError(errmsg).Code
+	}
+	fields := []interface{}{
+		"transport", t.name,
+		"remote", t.remote,
+		"subject", Subject(ctx),
+		"method", serviceMethod,
+		"code", code,
+		"latency", time.Since(start),
+		"request_id", trace.RequestID(ctx),
+	}
+	// the params and the result are only encoded for the sampled calls
+	if a.bodies != nil && a.bodies.sampled() {
+		if argv.IsValid() {
+			params, _ := json.Marshal(argv.Interface())
+			p, _ := a.bodies.redactJSON(params)
+			fields = append(fields, "params_size", len(params), "params", string(p))
+		}
+		if replyv.IsValid() && errmsg == "" {
+			result, _ := json.Marshal(replyv.Interface())
+			r, _ := a.bodies.redactJSON(result)
+			fields = append(fields, "result_size", len(result), "result", string(r))
+		}
+	}
+	a.log.Info("rpc access", fields...)
+}
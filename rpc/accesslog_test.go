@@ -0,0 +1,157 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package rpc
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/justoxh/go-toolkit/trace"
+)
+
+// entryLogger keeps the fields of the entries logged at info level.
+type entryLogger struct {
+	mutex   sync.Mutex
+	entries []map[string]interface{}
+}
+
+func (l *entryLogger) Info(f interface{}, args ...interface{}) {
+	entry := map[string]interface{}{"msg": f}
+	for i := 0; i+1 < len(args); i += 2 {
+		entry[args[i].(string)] = args[i+1]
+	}
+	l.mutex.Lock()
+	l.entries = append(l.entries, entry)
+	l.mutex.Unlock()
+}
+
+func (l *entryLogger) last(t *testing.T) map[string]interface{} {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if len(l.entries) == 0 {
+		t.Fatal("no access log entry")
+	}
+	return l.entries[len(l.entries)-1]
+}
+
+func (l *entryLogger) Debug(f interface{}, args ...interface{})  {}
+func (l *entryLogger) Warn(f interface{}, args ...interface{})   {}
+func (l *entryLogger) Printf(f interface{}, args ...interface{}) {}
+func (l *entryLogger) Panic(f interface{}, args ...interface{})  {}
+func (l *entryLogger) Fatal(f interface{}, args ...interface{})  {}
+func (l *entryLogger) Error(f interface{}, args ...interface{})  {}
+func (l *entryLogger) Debugln(args ...interface{})               {}
+func (l *entryLogger) Infoln(args ...interface{})                {}
+func (l *entryLogger) Warnln(args ...interface{})                {}
+func (l *entryLogger) Printfln(args ...interface{})              {}
+func (l *entryLogger) Panicln(args ...interface{})               {}
+func (l *entryLogger) Fatalln(args ...interface{})               {}
+func (l *entryLogger) Errorln(args ...interface{})               {}
+
+type LoginArgs struct {
+	User     string `json:"user"`
+	Password string `json:"password"`
+}
+
+type SessionService struct{}
+
+func (SessionService) Login(args *LoginArgs, reply *string) error {
+	*reply = "token-of-" + args.User
+	return nil
+}
+
+func Test_AccessLog(t *testing.T) {
+	server, _ := NewHTTPServer(nil, nil)
+	server.EnableREST()
+	server.GetServer().RegisterName("session", SessionService{})
+	l := &entryLogger{}
+	server.GetServer().SetAccessLog(l, &AccessLogOptions{SampleRate: 1, Redact: []string{"password"}})
+	// an authentication middleware
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.ServeHTTP(w, r.WithContext(WithSubject(r.Context(), "alice")))
+	}))
+	defer ts.Close()
+
+	post := func(path, body string) *http.Response {
+		resp, err := http.Post(ts.URL+path, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	resp := post("/", `{"jsonrpc":"2.0","id":1,"method":"session.Login","params":[{"user":"bob","password":"secret"}]}`)
+	entry := l.last(t)
+	for name, expected := range map[string]interface{}{
+		"msg":         "rpc access",
+		"transport":   TransportHTTP,
+		"subject":     "alice",
+		"method":      "session.Login",
+		"params_size": len(`{"user":"bob","password":"secret"}`),
+		"result_size": len(`"token-of-bob"`),
+		"code":        0,
+		"request_id":  resp.Header.Get(trace.RequestIDHeader),
+		"params":      `{"password":"[REDACTED]","user":"bob"}`,
+		"result":      `"token-of-bob"`,
+	} {
+		if entry[name] != expected {
+			t.Fatalf("%s: expected %v, got %v", name, expected, entry[name])
+		}
+	}
+	if entry["remote"] == "" || entry["latency"].(time.Duration) <= 0 {
+		t.Fatalf("bad entry %v", entry)
+	}
+
+	post("/session/login", `{"user":"bob","password":"secret"}`)
+	if entry := l.last(t); entry["transport"] != TransportREST || entry["method"] != "session.Login" {
+		t.Fatalf("bad REST entry %v", entry)
+	}
+
+	post("/", `{"jsonrpc":"2.0","id":1,"method":"session.Logout","params":[{}]}`)
+	if entry := l.last(t); entry["code"] != errMethod.Code || entry["method"] != "session.Logout" || entry["params_size"] != nil {
+		t.Fatalf("bad entry of an unknown method %v", entry)
+	}
+}
+
+func Test_AccessLogSampling(t *testing.T) {
+	server := NewServer()
+	server.RegisterName("session", SessionService{})
+	l := &entryLogger{}
+	server.SetAccessLog(l, nil)
+	cli, srv := net.Pipe()
+	go server.ServeCodec(NewServerCodec(srv, server))
+	client := NewClient(cli)
+	defer client.Close()
+
+	var reply string
+	if err := client.Call("session.Login", &LoginArgs{User: "bob"}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	entry := l.last(t)
+	if _, ok := entry["params"]; ok || entry["result_size"] != nil || entry["transport"] != "" {
+		t.Fatalf("expected no params nor sizes logged by default, got %v", entry)
+	}
+}
+
+func Test_ServeWSUpgradeError(t *testing.T) {
+	ws := NewWsRPCServer()
+	ts := httptest.NewServer(http.HandlerFunc(ws.ServeWS))
+	defer ts.Close()
+	// not a websocket handshake
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected a bad request, got %s", resp.Status)
+	}
+}
@@ -0,0 +1,280 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+// Package admin provides the admin namespace, which reports the runtime,
+// the build, the loggers and the connection pools of a process, changes
+// log levels and writes pprof profiles.
+//
+//	admin.Register(privateServer, &admin.Options{
+//		Redis: map[string]admin.RedisPool{"cache": redisService},
+//		MySQL: map[string]*sql.DB{"orders": mysqlService.DB},
+//	})
+//
+// Its methods control the process, so the server it is registered on
+// must only be served on a private address.
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"runtime/pprof"
+	"sort"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+	"github.com/justoxh/go-toolkit/log/logruslogger"
+	"github.com/justoxh/go-toolkit/rpc"
+)
+
+// Namespace is the namespace the admin methods are registered under.
+const Namespace = "admin"
+
+// RedisPool is a redis connection pool, such as *redis.RedisCacheService.
+type RedisPool interface {
+	Stats() redigo.PoolStats
+}
+
+// Options admin options config
+type Options struct {
+	Redis map[string]RedisPool // reported by RedisPools, by name
+	MySQL map[string]*sql.DB   // reported by MySQLPools, by name
+
+	ProfileDir string        // directory the profiles are written to
+	MaxProfile time.Duration // longest CPU profile
+}
+
+func defaultOptions() *Options {
+	return &Options{
+		ProfileDir: os.TempDir(),
+		MaxProfile: 5 * time.Minute,
+	}
+}
+
+// Service is the admin service.
+type Service struct {
+	options Options
+}
+
+// Register registers the admin service on server under Namespace.
+func Register(server *rpc.Server, options *Options) error {
+	def := defaultOptions()
+	if options == nil {
+		options = def
+	}
+	s := &Service{options: *options}
+	if s.options.ProfileDir == "" {
+		s.options.ProfileDir = def.ProfileDir
+	}
+	if s.options.MaxProfile <= 0 {
+		s.options.MaxProfile = def.MaxProfile
+	}
+	return server.RegisterName(Namespace, s)
+}
+
+// ReadOnlyMethods implements rpc.ReadOnly.
+func (s *Service) ReadOnlyMethods() []string {
+	return []string{"Runtime", "Build", "Loggers", "RedisPools", "MySQLPools"}
+}
+
+// RuntimeStats are the goroutine and heap statistics of the process.
+type RuntimeStats struct {
+	NumCPU      int           `json:"numCPU"`
+	GOMAXPROCS  int           `json:"gomaxprocs"`
+	Goroutines  int           `json:"goroutines"`
+	HeapAlloc   uint64        `json:"heapAlloc"`   // bytes of allocated heap objects
+	HeapSys     uint64        `json:"heapSys"`     // bytes of heap memory obtained from the OS
+	HeapInuse   uint64        `json:"heapInuse"`   // bytes in in-use spans
+	HeapObjects uint64        `json:"heapObjects"` // number of allocated heap objects
+	NumGC       uint32        `json:"numGC"`
+	PauseTotal  time.Duration `json:"pauseTotal"` // in nanoseconds
+	LastGC      time.Time     `json:"lastGC"`
+}
+
+// Runtime returns the goroutine and heap statistics of the process.
+func (s *Service) Runtime(args *struct{}, reply *RuntimeStats) error {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	*reply = RuntimeStats{
+		NumCPU:      runtime.NumCPU(),
+		GOMAXPROCS:  runtime.GOMAXPROCS(0),
+		Goroutines:  runtime.NumGoroutine(),
+		HeapAlloc:   m.HeapAlloc,
+		HeapSys:     m.HeapSys,
+		HeapInuse:   m.HeapInuse,
+		HeapObjects: m.HeapObjects,
+		NumGC:       m.NumGC,
+		PauseTotal:  time.Duration(m.PauseTotalNs),
+	}
+	if m.LastGC > 0 {
+		reply.LastGC = time.Unix(0, int64(m.LastGC))
+	}
+	return nil
+}
+
+// BuildInfo describes the build of the binary.
+type BuildInfo struct {
+	GoVersion string            `json:"goVersion"`
+	Path      string            `json:"path"`    // of the main package
+	Version   string            `json:"version"` // of the main module
+	Settings  map[string]string `json:"settings,omitempty"`
+}
+
+// Build returns the build info of the binary.
+func (s *Service) Build(args *struct{}, reply *BuildInfo) error {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		reply.GoVersion = runtime.Version()
+		return nil
+	}
+	*reply = BuildInfo{
+		GoVersion: info.GoVersion,
+		Path:      info.Path,
+		Version:   info.Main.Version,
+	}
+	if len(info.Settings) > 0 {
+		reply.Settings = make(map[string]string, len(info.Settings))
+		for _, setting := range info.Settings {
+			reply.Settings[setting.Key] = setting.Value
+		}
+	}
+	return nil
+}
+
+// LoggerInfo describes a logger of logruslogger.
+type LoggerInfo struct {
+	Name  string `json:"name"`
+	Level string `json:"level"`
+}
+
+// Loggers returns the loggers of logruslogger with their level, sorted by
+// name.
+func (s *Service) Loggers(args *struct{}, reply *[]LoggerInfo) error {
+	loggers := []LoggerInfo{}
+	for name, level := range logruslogger.Loggers() {
+		loggers = append(loggers, LoggerInfo{Name: name, Level: level})
+	}
+	sort.Slice(loggers, func(i, j int) bool { return loggers[i].Name < loggers[j].Name })
+	*reply = loggers
+	return nil
+}
+
+// LogLevelArgs are the params of SetLogLevel.
+type LogLevelArgs struct {
+	Name  string `json:"name" validate:"required"`
+	Level string `json:"level" validate:"oneof=panic fatal error warn info debug"`
+}
+
+// SetLogLevel changes the level of a logger of logruslogger.
+func (s *Service) SetLogLevel(args *LogLevelArgs, reply *bool) error {
+	if err := logruslogger.SetLevel(args.Name, args.Level); err != nil {
+		return err
+	}
+	*reply = true
+	return nil
+}
+
+// RedisPoolStats are the statistics of a redis connection pool.
+type RedisPoolStats struct {
+	Active int `json:"active"` // connections, idle or in use
+	Idle   int `json:"idle"`
+}
+
+// RedisPools returns the statistics of the redis pools of the options.
+func (s *Service) RedisPools(args *struct{}, reply *map[string]RedisPoolStats) error {
+	pools := make(map[string]RedisPoolStats, len(s.options.Redis))
+	for name, pool := range s.options.Redis {
+		stats := pool.Stats()
+		pools[name] = RedisPoolStats{Active: stats.ActiveCount, Idle: stats.IdleCount}
+	}
+	*reply = pools
+	return nil
+}
+
+// MySQLPoolStats are the statistics of a MySQL connection pool.
+type MySQLPoolStats struct {
+	MaxOpen           int           `json:"maxOpen"`
+	Open              int           `json:"open"` // connections, idle or in use
+	InUse             int           `json:"inUse"`
+	Idle              int           `json:"idle"`
+	WaitCount         int64         `json:"waitCount"`    // connections waited for
+	WaitDuration      time.Duration `json:"waitDuration"` // in nanoseconds
+	MaxIdleClosed     int64         `json:"maxIdleClosed"`
+	MaxLifetimeClosed int64         `json:"maxLifetimeClosed"`
+}
+
+// MySQLPools returns the statistics of the MySQL pools of the options.
+func (s *Service) MySQLPools(args *struct{}, reply *map[string]MySQLPoolStats) error {
+	pools := make(map[string]MySQLPoolStats, len(s.options.MySQL))
+	for name, db := range s.options.MySQL {
+		stats := db.Stats()
+		pools[name] = MySQLPoolStats{
+			MaxOpen:           stats.MaxOpenConnections,
+			Open:              stats.OpenConnections,
+			InUse:             stats.InUse,
+			Idle:              stats.Idle,
+			WaitCount:         stats.WaitCount,
+			WaitDuration:      stats.WaitDuration,
+			MaxIdleClosed:     stats.MaxIdleClosed,
+			MaxLifetimeClosed: stats.MaxLifetimeClosed,
+		}
+	}
+	*reply = pools
+	return nil
+}
+
+// ProfileArgs are the params of CPUProfile.
+type ProfileArgs struct {
+	Seconds int `json:"seconds" validate:"min=1"`
+}
+
+// CPUProfile profiles the CPU for args.Seconds, at most MaxProfile, and
+// replies with the path of the profile. The profile stops early when the
+// call is cancelled.
+func (s *Service) CPUProfile(ctx context.Context, args *ProfileArgs, reply *string) error {
+	d := time.Duration(args.Seconds) * time.Second
+	if d > s.options.MaxProfile {
+		return errors.New("admin: profile longer than " + s.options.MaxProfile.String())
+	}
+	f, err := ioutil.TempFile(s.options.ProfileDir, "cpu-*.pprof")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := pprof.StartCPUProfile(f); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	timer := time.NewTimer(d)
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		timer.Stop()
+	}
+	pprof.StopCPUProfile()
+	*reply = f.Name()
+	return nil
+}
+
+// HeapProfile writes a heap profile, after a garbage collection, and
+// replies with its path.
+func (s *Service) HeapProfile(args *struct{}, reply *string) error {
+	f, err := ioutil.TempFile(s.options.ProfileDir, "heap-*.pprof")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	*reply = f.Name()
+	return nil
+}
@@ -0,0 +1,125 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package admin
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"os"
+	"testing"
+
+	redigo "github.com/gomodule/redigo/redis"
+	"github.com/justoxh/go-toolkit/log/logruslogger"
+	"github.com/justoxh/go-toolkit/rpc"
+	"github.com/justoxh/go-toolkit/rpc/rpctest"
+)
+
+type fakePool struct{}
+
+func (fakePool) Stats() redigo.PoolStats {
+	return redigo.PoolStats{ActiveCount: 3, IdleCount: 2}
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	return nil, errors.New("no connection")
+}
+
+func init() {
+	sql.Register("admin-fake", fakeDriver{})
+}
+
+func newAdminClient(t *testing.T, options *Options) *rpc.Client {
+	s := rpctest.NewPipeServer(t)
+	if err := Register(s.RPC, options); err != nil {
+		t.Fatal(err)
+	}
+	return s.Client()
+}
+
+func Test_Stats(t *testing.T) {
+	db, _ := sql.Open("admin-fake", "")
+	db.SetMaxOpenConns(7)
+	defer db.Close()
+	client := newAdminClient(t, &Options{
+		Redis: map[string]RedisPool{"cache": fakePool{}},
+		MySQL: map[string]*sql.DB{"orders": db},
+	})
+
+	var stats RuntimeStats
+	if err := client.Call("admin.Runtime", &struct{}{}, &stats); err != nil || stats.Goroutines == 0 || stats.HeapAlloc == 0 {
+		t.Fatalf("bad runtime stats %+v %v", stats, err)
+	}
+	var build BuildInfo
+	if err := client.Call("admin.Build", &struct{}{}, &build); err != nil || build.GoVersion == "" {
+		t.Fatalf("bad build info %+v %v", build, err)
+	}
+	var redis map[string]RedisPoolStats
+	if err := client.Call("admin.RedisPools", &struct{}{}, &redis); err != nil || redis["cache"] != (RedisPoolStats{Active: 3, Idle: 2}) {
+		t.Fatalf("bad redis stats %+v %v", redis, err)
+	}
+	var mysql map[string]MySQLPoolStats
+	if err := client.Call("admin.MySQLPools", &struct{}{}, &mysql); err != nil || mysql["orders"].MaxOpen != 7 {
+		t.Fatalf("bad mysql stats %+v %v", mysql, err)
+	}
+}
+
+func Test_Loggers(t *testing.T) {
+	logruslogger.GetLoggerWithOptions("admin-test", &logruslogger.Options{Level: "info", DisableConsole: true})
+	// the logger is global, it gets its level back for the next run
+	t.Cleanup(func() { logruslogger.SetLevel("admin-test", "info") })
+	client := newAdminClient(t, nil)
+
+	level := func() string {
+		var loggers []LoggerInfo
+		if err := client.Call("admin.Loggers", &struct{}{}, &loggers); err != nil {
+			t.Fatal(err)
+		}
+		for _, l := range loggers {
+			if l.Name == "admin-test" {
+				return l.Level
+			}
+		}
+		return ""
+	}
+	if l := level(); l != "info" {
+		t.Fatalf("expected info, got %q", l)
+	}
+	var ok bool
+	if err := client.Call("admin.SetLogLevel", &LogLevelArgs{Name: "admin-test", Level: "error"}, &ok); err != nil || !ok {
+		t.Fatalf("set log level: %v %v", ok, err)
+	}
+	if l := level(); l != "error" {
+		t.Fatalf("expected error, got %q", l)
+	}
+	if err := client.Call("admin.SetLogLevel", &LogLevelArgs{Name: "admin-test", Level: "loud"}, &ok); err == nil {
+		t.Fatalf("expected error for unknown level")
+	}
+	if err := client.Call("admin.SetLogLevel", &LogLevelArgs{Name: "missing", Level: "info"}, &ok); err == nil {
+		t.Fatalf("expected error for unknown logger")
+	}
+}
+
+func Test_Profiles(t *testing.T) {
+	dir := t.TempDir()
+	client := newAdminClient(t, &Options{ProfileDir: dir})
+
+	for _, method := range []string{"admin.HeapProfile", "admin.CPUProfile"} {
+		var path string
+		if err := client.Call(method, &ProfileArgs{Seconds: 1}, &path); err != nil {
+			t.Fatal(err)
+		}
+		if info, err := os.Stat(path); err != nil || info.Size() == 0 {
+			t.Fatalf("%s: bad profile %s %v", method, path, err)
+		}
+	}
+	var path string
+	if err := client.Call("admin.CPUProfile", &ProfileArgs{Seconds: 3600}, &path); err == nil {
+		t.Fatalf("expected error for a too long profile")
+	}
+}
@@ -0,0 +1,166 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package rpc
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Codes from -32768 to -32000 are reserved by the JSON-RPC 2.0 specification.
+const (
+	reservedCodeMin = -32768
+	reservedCodeMax = -32000
+)
+
+// CodeError is implemented by application errors which carry their own
+// JSON-RPC error code. A method may return it wrapped, the server finds
+// it with errors.As.
+type CodeError interface {
+	error
+	ErrorCode() int
+}
+
+// DataError is optionally implemented by a CodeError to fill the "data"
+// member of the error object.
+type DataError interface {
+	ErrorData() interface{}
+}
+
+// ErrorRange is a range of error codes owned by an application.
+type ErrorRange struct {
+	Name string
+	Min  int
+	Max  int
+}
+
+var (
+	errorRegistryMutex sync.RWMutex // protects errorRanges, sentinelErrors
+	errorRanges        []ErrorRange
+	sentinelErrors     = make(map[int]CodeError)
+)
+
+// errorMessage converts the error returned by a method into the text of
+// rpc.Response.Error. Typed errors are serialized as error objects, which
+// the codecs pass through as is.
+func errorMessage(err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Error()
+	}
+	var ce CodeError
+	if errors.As(err, &ce) {
+		e = NewError(ce.ErrorCode(), err.Error())
+		var de DataError
+		if errors.As(err, &de) {
+			e.Data = de.ErrorData()
+		}
+		return e.Error()
+	}
+	return err.Error()
+}
+
+// RegisterErrorRange reserves the codes from min to max, inclusive, for the
+// application errors of name. Ranges must not overlap each other nor the
+// codes reserved by JSON-RPC.
+func RegisterErrorRange(name string, min, max int) error {
+	if min > max {
+		return fmt.Errorf("rpc: invalid error range %s [%d, %d]", name, min, max)
+	}
+	if min <= reservedCodeMax && max >= reservedCodeMin {
+		return fmt.Errorf("rpc: error range %s overlaps the reserved codes", name)
+	}
+
+	errorRegistryMutex.Lock()
+	defer errorRegistryMutex.Unlock()
+	for _, r := range errorRanges {
+		if min <= r.Max && max >= r.Min {
+			return fmt.Errorf("rpc: error range %s overlaps %s", name, r.Name)
+		}
+	}
+	errorRanges = append(errorRanges, ErrorRange{Name: name, Min: min, Max: max})
+	return nil
+}
+
+// LookupErrorRange returns the registered range which contains code.
+func LookupErrorRange(code int) (ErrorRange, bool) {
+	errorRegistryMutex.RLock()
+	defer errorRegistryMutex.RUnlock()
+	for _, r := range errorRanges {
+		if code >= r.Min && code <= r.Max {
+			return r, true
+		}
+	}
+	return ErrorRange{}, false
+}
+
+// RegisterError registers a sentinel error so that TypedError can rebuild it
+// from a response. Its code must belong to a registered range.
+func RegisterError(err CodeError) error {
+	code := err.ErrorCode()
+	if _, ok := LookupErrorRange(code); !ok {
+		return fmt.Errorf("rpc: error code %d is not in a registered range", code)
+	}
+
+	errorRegistryMutex.Lock()
+	defer errorRegistryMutex.Unlock()
+	if _, dup := sentinelErrors[code]; dup {
+		return fmt.Errorf("rpc: error code %d already registered", code)
+	}
+	sentinelErrors[code] = err
+	return nil
+}
+
+// ResponseError is an error object received from the server whose code
+// belongs to a registered sentinel error. It unwraps to the sentinel, so
+// callers can use errors.Is and errors.As against it.
+type ResponseError struct {
+	Err      *Error
+	sentinel CodeError
+}
+
+// Error returns JSON representation of the error object.
+func (e *ResponseError) Error() string {
+	return e.Err.Error()
+}
+
+// ErrorCode returns the code of the error object.
+func (e *ResponseError) ErrorCode() int {
+	return e.Err.Code
+}
+
+// ErrorData returns the data of the error object.
+func (e *ResponseError) ErrorData() interface{} {
+	return e.Err.Data
+}
+
+// Unwrap returns the registered sentinel error.
+func (e *ResponseError) Unwrap() error {
+	return e.sentinel
+}
+
+// TypedError converts an error returned by Client.Call() into a
+// *ResponseError when its code has a registered sentinel error, and into
+// an *Error otherwise. Errors which are not error objects, such as
+// rpc.ErrShutdown, are returned as is.
+func TypedError(rpcerr error) error {
+	if rpcerr == nil {
+		return nil
+	}
+	e, err := serverError(rpcerr)
+	if err != nil {
+		return rpcerr
+	}
+
+	errorRegistryMutex.RLock()
+	sentinel, ok := sentinelErrors[e.Code]
+	errorRegistryMutex.RUnlock()
+	if !ok {
+		return e
+	}
+	return &ResponseError{Err: e, sentinel: sentinel}
+}
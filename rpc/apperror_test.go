@@ -0,0 +1,102 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package rpc
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+)
+
+type orderError struct {
+	code int
+	msg  string
+}
+
+func (e *orderError) Error() string  { return e.msg }
+func (e *orderError) ErrorCode() int { return e.code }
+
+var errOrderNotFound = &orderError{1001, "order not found"}
+
+type balanceError struct {
+	Need int64
+}
+
+func (e *balanceError) Error() string          { return "insufficient balance" }
+func (e *balanceError) ErrorCode() int         { return 1002 }
+func (e *balanceError) ErrorData() interface{} { return map[string]int64{"need": e.Need} }
+
+type OrderService struct{}
+
+type OrderArgs struct {
+	ID     int
+	Amount int64
+}
+
+func (OrderService) Get(args *OrderArgs, reply *string) error {
+	return fmt.Errorf("get order %d: %w", args.ID, errOrderNotFound)
+}
+
+func (OrderService) Pay(args *OrderArgs, reply *string) error {
+	return fmt.Errorf("pay: %w", &balanceError{Need: args.Amount})
+}
+
+func init() {
+	if err := RegisterErrorRange("order", 1000, 1999); err != nil {
+		panic(err)
+	}
+	if err := RegisterError(errOrderNotFound); err != nil {
+		panic(err)
+	}
+}
+
+func Test_RegisterErrorRange(t *testing.T) {
+	if err := RegisterErrorRange("jsonrpc", -32100, -32000); err == nil {
+		t.Fatalf("expected error for reserved codes")
+	}
+	if err := RegisterErrorRange("overlap", 1500, 2500); err == nil {
+		t.Fatalf("expected error for overlapping range")
+	}
+	if r, ok := LookupErrorRange(1001); !ok || r.Name != "order" {
+		t.Fatalf("bad range %v", r)
+	}
+	if err := RegisterError(&orderError{3000, "out of range"}); err == nil {
+		t.Fatalf("expected error for code out of registered ranges")
+	}
+}
+
+func Test_TypedError(t *testing.T) {
+	server := NewServer()
+	server.Register(OrderService{})
+	cli, srv := net.Pipe()
+	go server.ServeCodec(NewServerCodec(srv, server))
+	client := NewClient(cli)
+	defer client.Close()
+
+	var reply string
+	err := TypedError(client.Call("OrderService.Get", &OrderArgs{ID: 1}, &reply))
+	if !errors.Is(err, errOrderNotFound) {
+		t.Fatalf("expected errOrderNotFound, got %v", err)
+	}
+	var ce CodeError
+	if !errors.As(err, &ce) || ce.ErrorCode() != 1001 {
+		t.Fatalf("bad code error %v", err)
+	}
+
+	err = TypedError(client.Call("OrderService.Pay", &OrderArgs{Amount: 5}, &reply))
+	e, ok := err.(*Error)
+	if !ok || e.Code != 1002 || e.Message != "pay: insufficient balance" {
+		t.Fatalf("bad error %v", err)
+	}
+	if data, ok := e.Data.(map[string]interface{}); !ok || data["need"] != float64(5) {
+		t.Fatalf("bad error data %v", e.Data)
+	}
+
+	if err := TypedError(errors.New("connection reset")); err.Error() != "connection reset" {
+		t.Fatalf("transport error changed: %v", err)
+	}
+}
@@ -5,9 +5,10 @@
 package rpc
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"net"
-	"net/rpc"
 )
 
 var jErrRequest = json.RawMessage(`{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"invalid request"}}`)
@@ -15,17 +16,25 @@ var jErrRequest = json.RawMessage(`{"jsonrpc":"2.0","id":null,"error":{"code":-3
 // JSONRPC2 is an internal RPC service used to process batch requests.
 type JSONRPC2 struct{}
 
+// isBatchMethod reports whether serviceMethod is an internal batch method,
+// whose calls are the elements of the batch.
+func isBatchMethod(serviceMethod string) bool {
+	return serviceMethod == "JSONRPC2.Batch" || serviceMethod == "MsgpackRPC.Batch"
+}
+
 // BatchArg is a param for internal RPC JSONRPC2.Batch.
 type BatchArg struct {
-	srv  *rpc.Server
+	srv  *Server
 	reqs []*json.RawMessage
 }
 
 // Batch is an internal RPC method used to process batch requests.
-func (JSONRPC2) Batch(arg BatchArg, replies *[]*json.RawMessage) (err error) {
+// The calls of the batch share its request ID and trace context unless
+// they carry their own, but not its idempotency key.
+func (JSONRPC2) Batch(ctx context.Context, arg BatchArg, replies *[]*json.RawMessage) (err error) {
 	cli, srv := net.Pipe()
 	defer cli.Close()
-	go arg.srv.ServeCodec(NewJSONCodec(srv, arg.srv))
+	go arg.srv.ServeCodecContext(withoutIdempotencyKey(ctx), newJSONCodec(srv, arg.srv))
 
 	replyc := make(chan *json.RawMessage, len(arg.reqs))
 	donec := make(chan struct{}, 1)
@@ -64,3 +73,65 @@ func (JSONRPC2) Batch(arg BatchArg, replies *[]*json.RawMessage) (err error) {
 	<-donec
 	return
 }
+
+var mErrRequest = mustMarshalMsgpackError(errRequest)
+
+func mustMarshalMsgpackError(e *Error) []byte {
+	var buf bytes.Buffer
+	if err := writeMsgpackResponse(&buf, newMsgpackEncoder(&buf), nil, nil, e); err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
+
+// MsgpackRPC is an internal RPC service used to process MessagePack batch requests.
+type MsgpackRPC struct{}
+
+// MsgpackBatchArg is a param for internal RPC MsgpackRPC.Batch.
+type MsgpackBatchArg struct {
+	srv  *Server
+	reqs [][]byte
+}
+
+// Batch is an internal RPC method used to process MessagePack batch requests.
+func (MsgpackRPC) Batch(ctx context.Context, arg MsgpackBatchArg, replies *[][]byte) (err error) {
+	cli, srv := net.Pipe()
+	defer cli.Close()
+	go arg.srv.ServeCodecContext(withoutIdempotencyKey(ctx), newMsgpackCodec(srv, arg.srv))
+
+	replyc := make(chan []byte, len(arg.reqs))
+	donec := make(chan struct{}, 1)
+
+	go func() {
+		dec, rd := newMsgpackDecoder(cli)
+		*replies = make([][]byte, 0, len(arg.reqs))
+		for reply := range replyc {
+			if reply != nil {
+				*replies = append(*replies, reply)
+			} else if raw, err := rd.next(dec); err != nil {
+				*replies = append(*replies, mErrRequest)
+			} else {
+				*replies = append(*replies, raw)
+			}
+		}
+		donec <- struct{}{}
+	}()
+
+	var testreq msgpackRequest
+	for _, req := range arg.reqs {
+		if testreq.unmarshal(req) != nil {
+			replyc <- mErrRequest
+		} else {
+			if testreq.ID != nil {
+				replyc <- nil
+			}
+			if _, err = cli.Write(req); err != nil {
+				break
+			}
+		}
+	}
+
+	close(replyc)
+	<-donec
+	return
+}
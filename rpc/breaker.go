@@ -0,0 +1,341 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package rpc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// BreakerState is the state of a circuit.
+type BreakerState int
+
+const (
+	// BreakerClosed lets calls through and counts their failures.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen fails calls fast with ErrBreakerOpen.
+	BreakerOpen
+	// BreakerHalfOpen lets a few trial calls through to decide whether the
+	// circuit closes again.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half_open"
+	default:
+		return "unknown"
+	}
+}
+
+// ErrBreakerOpen is returned, without sending the request, by calls whose
+// circuit is open.
+var ErrBreakerOpen = errors.New("rpc: circuit breaker is open")
+
+// BreakerOptions circuit breaker options config
+type BreakerOptions struct {
+	Window       time.Duration // rolling window over which calls are counted
+	Buckets      int           // number of buckets the window is divided in
+	MinRequests  int           // calls in the window before the circuit can open
+	FailureRatio float64       // ratio of failed calls which opens the circuit
+
+	OpenTimeout      time.Duration // time spent open before trying again
+	HalfOpenRequests int           // successful trial calls needed to close
+
+	// PerMethod keeps a circuit for each method instead of one for each
+	// endpoint.
+	PerMethod bool
+
+	// IsFailure reports whether the error of a call counts as a failure.
+	// It defaults to transport errors, timeouts and internal errors.
+	IsFailure func(err error) bool
+
+	// OnStateChange is called after a circuit changes state.
+	OnStateChange func(name string, from, to BreakerState)
+}
+
+func defaultBreakerOptions() *BreakerOptions {
+	return &BreakerOptions{
+		Window:           10 * time.Second,
+		Buckets:          10,
+		MinRequests:      20,
+		FailureRatio:     0.5,
+		OpenTimeout:      5 * time.Second,
+		HalfOpenRequests: 1,
+		IsFailure:        isBreakerFailure,
+	}
+}
+
+// isBreakerFailure is the default BreakerOptions.IsFailure.
+func isBreakerFailure(err error) bool {
+	if err == nil || err == context.Canceled {
+		return false
+	}
+	if isTransportError(err) {
+		return true
+	}
+	e, perr := serverError(err)
+	return perr == nil && e.Code == errInternal.Code
+}
+
+// Breaker is a set of circuits, one per endpoint or per method, shared by
+// the clients it is set on.
+type Breaker struct {
+	options  BreakerOptions
+	circuits sync.Map // map[string]*circuit
+}
+
+// NewBreaker returns a new Breaker.
+func NewBreaker(options *BreakerOptions) *Breaker {
+	def := defaultBreakerOptions()
+	if options == nil {
+		options = def
+	}
+	b := &Breaker{options: *options}
+	o := &b.options
+	if o.Window <= 0 {
+		o.Window = def.Window
+	}
+	if o.Buckets <= 0 {
+		o.Buckets = def.Buckets
+	}
+	if o.MinRequests <= 0 {
+		o.MinRequests = def.MinRequests
+	}
+	if o.FailureRatio <= 0 || o.FailureRatio > 1 {
+		o.FailureRatio = def.FailureRatio
+	}
+	if o.OpenTimeout <= 0 {
+		o.OpenTimeout = def.OpenTimeout
+	}
+	if o.HalfOpenRequests <= 0 {
+		o.HalfOpenRequests = def.HalfOpenRequests
+	}
+	if o.IsFailure == nil {
+		o.IsFailure = def.IsFailure
+	}
+	return b
+}
+
+// State returns the state of the circuit of name, which is the endpoint
+// address, the method, or both joined by a slash when PerMethod is set on
+// an endpoint client.
+func (b *Breaker) State(name string) BreakerState {
+	if c, ok := b.circuits.Load(name); ok {
+		c := c.(*circuit)
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		return c.state
+	}
+	return BreakerClosed
+}
+
+// circuitName returns the name of the circuit of a call.
+func (b *Breaker) circuitName(endpoint, serviceMethod string) string {
+	if !b.options.PerMethod {
+		return endpoint
+	}
+	if endpoint == "" {
+		return serviceMethod
+	}
+	return endpoint + "/" + serviceMethod
+}
+
+func (b *Breaker) circuit(name string) *circuit {
+	if c, ok := b.circuits.Load(name); ok {
+		return c.(*circuit)
+	}
+	c, _ := b.circuits.LoadOrStore(name, &circuit{
+		name:   name,
+		window: newRollingWindow(b.options.Window, b.options.Buckets),
+	})
+	return c.(*circuit)
+}
+
+// do runs call unless the circuit of name is open, and records its outcome.
+func (b *Breaker) do(name string, call func() error) error {
+	c := b.circuit(name)
+	gen, change, err := c.allow(&b.options)
+	b.notify(c.name, change)
+	if err != nil {
+		return err
+	}
+	err = call()
+	if err == context.Canceled {
+		// the caller gave up, it says nothing about the endpoint
+		c.cancel(gen)
+		return err
+	}
+	b.notify(c.name, c.record(&b.options, gen, b.options.IsFailure(err)))
+	return err
+}
+
+func (b *Breaker) notify(name string, change *stateChange) {
+	if change == nil {
+		return
+	}
+	switch change.to {
+	case BreakerOpen:
+		Metrics.Add(metricBreakerOpened, 1)
+	case BreakerHalfOpen:
+		Metrics.Add(metricBreakerHalfOpened, 1)
+	case BreakerClosed:
+		Metrics.Add(metricBreakerClosed, 1)
+	}
+	if b.options.OnStateChange != nil {
+		b.options.OnStateChange(name, change.from, change.to)
+	}
+}
+
+type stateChange struct {
+	from, to BreakerState
+}
+
+// circuit is the state machine of a Breaker for one name.
+type circuit struct {
+	name string
+
+	mutex    sync.Mutex // protects the fields below
+	state    BreakerState
+	gen      uint64 // incremented on every state change
+	window   *rollingWindow
+	openedAt time.Time
+	trials   int // trial calls let through while half-open
+	passed   int // successful trial calls
+}
+
+func (c *circuit) setState(to BreakerState, now time.Time) *stateChange {
+	change := &stateChange{from: c.state, to: to}
+	c.state = to
+	c.gen++
+	c.trials, c.passed = 0, 0
+	switch to {
+	case BreakerOpen:
+		c.openedAt = now
+	case BreakerClosed:
+		c.window.reset()
+	}
+	return change
+}
+
+// allow reports whether a call may go through and returns the generation
+// its outcome must be recorded with.
+func (c *circuit) allow(o *BreakerOptions) (gen uint64, change *stateChange, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	now := time.Now()
+	if c.state == BreakerOpen {
+		if now.Sub(c.openedAt) < o.OpenTimeout {
+			return 0, nil, ErrBreakerOpen
+		}
+		change = c.setState(BreakerHalfOpen, now)
+	}
+	if c.state == BreakerHalfOpen {
+		if c.trials >= o.HalfOpenRequests {
+			return 0, change, ErrBreakerOpen
+		}
+		c.trials++
+	}
+	return c.gen, change, nil
+}
+
+// record counts the outcome of a call allowed in generation gen. Outcomes
+// of calls started before the last state change are ignored.
+func (c *circuit) record(o *BreakerOptions, gen uint64, failed bool) *stateChange {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if gen != c.gen {
+		return nil
+	}
+	now := time.Now()
+	switch c.state {
+	case BreakerClosed:
+		c.window.add(now, failed)
+		total, failures := c.window.counts(now)
+		if total >= o.MinRequests && float64(failures) >= o.FailureRatio*float64(total) {
+			return c.setState(BreakerOpen, now)
+		}
+	case BreakerHalfOpen:
+		if failed {
+			return c.setState(BreakerOpen, now)
+		}
+		c.passed++
+		if c.passed >= o.HalfOpenRequests {
+			return c.setState(BreakerClosed, now)
+		}
+	}
+	return nil
+}
+
+// cancel gives back the trial slot of a call which was canceled.
+func (c *circuit) cancel(gen uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if gen == c.gen && c.state == BreakerHalfOpen {
+		c.trials--
+	}
+}
+
+// rollingWindow counts calls and failures over the last buckets of width
+// duration.
+type rollingWindow struct {
+	width   time.Duration
+	buckets []windowBucket
+}
+
+type windowBucket struct {
+	epoch    int64 // index of the period of width the bucket counts
+	total    int
+	failures int
+}
+
+func newRollingWindow(window time.Duration, buckets int) *rollingWindow {
+	width := window / time.Duration(buckets)
+	if width <= 0 {
+		width = 1
+	}
+	return &rollingWindow{width: width, buckets: make([]windowBucket, buckets)}
+}
+
+func (w *rollingWindow) epoch(now time.Time) int64 {
+	return now.UnixNano() / int64(w.width)
+}
+
+func (w *rollingWindow) add(now time.Time, failed bool) {
+	epoch := w.epoch(now)
+	b := &w.buckets[epoch%int64(len(w.buckets))]
+	if b.epoch != epoch {
+		*b = windowBucket{epoch: epoch}
+	}
+	b.total++
+	if failed {
+		b.failures++
+	}
+}
+
+func (w *rollingWindow) counts(now time.Time) (total, failures int) {
+	epoch := w.epoch(now)
+	for _, b := range w.buckets {
+		if epoch-b.epoch < int64(len(w.buckets)) {
+			total += b.total
+			failures += b.failures
+		}
+	}
+	return
+}
+
+func (w *rollingWindow) reset() {
+	for i := range w.buckets {
+		w.buckets[i] = windowBucket{}
+	}
+}
@@ -0,0 +1,145 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package rpc
+
+import (
+	"errors"
+	"expvar"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+type FlakyService struct{}
+
+func (FlakyService) Ok(args *Args, reply *Reply) error {
+	return nil
+}
+
+func (FlakyService) Fail(args *Args, reply *Reply) error {
+	return NewError(errInternal.Code, "service degraded")
+}
+
+func (FlakyService) Invalid(args *Args, reply *Reply) error {
+	return errors.New("invalid order")
+}
+
+func newFlakyClient(b *Breaker) *Client {
+	server := NewServer()
+	server.Register(FlakyService{})
+	cli, srv := net.Pipe()
+	go server.ServeCodec(NewServerCodec(srv, server))
+	client := NewClient(cli)
+	client.SetBreaker(b)
+	return client
+}
+
+func Test_Breaker(t *testing.T) {
+	var mutex sync.Mutex
+	var changes []string
+	b := NewBreaker(&BreakerOptions{
+		MinRequests: 4,
+		OpenTimeout: 50 * time.Millisecond,
+		OnStateChange: func(name string, from, to BreakerState) {
+			mutex.Lock()
+			changes = append(changes, from.String()+">"+to.String())
+			mutex.Unlock()
+		},
+	})
+	client := newFlakyClient(b)
+	defer client.Close()
+	opened := metricValue(metricBreakerOpened)
+
+	var reply Reply
+	for _, method := range []string{"FlakyService.Ok", "FlakyService.Invalid", "FlakyService.Fail", "FlakyService.Fail"} {
+		if err := client.Call(method, &Args{}, &reply); err == ErrBreakerOpen {
+			t.Fatalf("%s: circuit opened too early", method)
+		}
+	}
+	// 2 failures out of 4 calls, application errors are not failures.
+	if err := client.Call("FlakyService.Ok", &Args{}, &reply); err != ErrBreakerOpen {
+		t.Fatalf("expected ErrBreakerOpen, got %v", err)
+	}
+	if s := b.State(""); s != BreakerOpen {
+		t.Fatalf("expected open, got %s", s)
+	}
+	if metricValue(metricBreakerOpened) != opened+1 {
+		t.Fatalf("transition not counted")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if err := client.Call("FlakyService.Fail", &Args{}, &reply); err == ErrBreakerOpen {
+		t.Fatalf("expected a trial call")
+	}
+	if err := client.Call("FlakyService.Ok", &Args{}, &reply); err != ErrBreakerOpen {
+		t.Fatalf("expected the failed trial to open the circuit again, got %v", err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if err := client.Call("FlakyService.Ok", &Args{}, &reply); err != nil {
+		t.Fatalf("trial call: %v", err)
+	}
+	if s := b.State(""); s != BreakerClosed {
+		t.Fatalf("expected closed, got %s", s)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	expected := []string{"closed>open", "open>half_open", "half_open>open", "open>half_open", "half_open>closed"}
+	if len(changes) != len(expected) {
+		t.Fatalf("got transitions %v", changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Fatalf("got transitions %v", changes)
+		}
+	}
+}
+
+func Test_Breaker_PerMethod(t *testing.T) {
+	b := NewBreaker(&BreakerOptions{MinRequests: 2, PerMethod: true})
+	client := newFlakyClient(b)
+	defer client.Close()
+
+	var reply Reply
+	client.Call("FlakyService.Fail", &Args{}, &reply)
+	client.Call("FlakyService.Fail", &Args{}, &reply)
+	if err := client.Call("FlakyService.Fail", &Args{}, &reply); err != ErrBreakerOpen {
+		t.Fatalf("expected ErrBreakerOpen, got %v", err)
+	}
+	if err := client.Call("FlakyService.Ok", &Args{}, &reply); err != nil {
+		t.Fatalf("other method blocked: %v", err)
+	}
+	if b.State("FlakyService.Fail") != BreakerOpen || b.State("FlakyService.Ok") != BreakerClosed {
+		t.Fatalf("bad states")
+	}
+}
+
+func Test_RollingWindow(t *testing.T) {
+	w := newRollingWindow(time.Second, 10)
+	now := time.Unix(1000, 0)
+	w.add(now, true)
+	w.add(now.Add(500*time.Millisecond), false)
+	w.add(now.Add(900*time.Millisecond), true)
+	if total, failures := w.counts(now.Add(900 * time.Millisecond)); total != 3 || failures != 2 {
+		t.Fatalf("got %d/%d", failures, total)
+	}
+	// the first bucket left the window
+	if total, failures := w.counts(now.Add(1050 * time.Millisecond)); total != 2 || failures != 1 {
+		t.Fatalf("got %d/%d", failures, total)
+	}
+	if total, _ := w.counts(now.Add(3 * time.Second)); total != 0 {
+		t.Fatalf("expected empty window, got %d", total)
+	}
+}
+
+func metricValue(name string) int64 {
+	if v, ok := Metrics.Get(name).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
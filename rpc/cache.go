@@ -0,0 +1,254 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package rpc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// cacheKeyPrefix prefixes the keys of cached responses in the store.
+const cacheKeyPrefix = "rpc:cache:"
+
+// Cacheable is optionally implemented by a registered service to annotate
+// the methods whose results may be cached, by method name, with their TTL.
+// Only read-only methods should be listed: a cached result is returned
+// without calling the method again for the same params.
+type Cacheable interface {
+	CacheTTL() map[string]time.Duration
+}
+
+// CacheStore stores cached responses.
+type CacheStore interface {
+	Get(key string) ([]byte, bool, error)
+	Set(key string, value []byte, ttl time.Duration) error
+	Delete(key string) error
+	DeletePrefix(prefix string) error
+}
+
+// SetCache sets the store of cached responses. Methods are cached only
+// once a store is set.
+func (server *Server) SetCache(store CacheStore) {
+	server.cache = store
+}
+
+// CacheMethod caches the results of serviceMethod, which must be registered,
+// for ttl. A ttl of 0 disables caching of the method.
+func (server *Server) CacheMethod(serviceMethod string, ttl time.Duration) error {
+	mtype, err := server.lookupMethod(serviceMethod)
+	if err != nil {
+		return err
+	}
+	mtype.Lock()
+	mtype.cacheTTL = ttl
+	mtype.Unlock()
+	return nil
+}
+
+// InvalidateCache removes the cached result of serviceMethod for args, which
+// must be of the argument type of the method. Handlers call it after a write
+// which changes that result.
+func (server *Server) InvalidateCache(serviceMethod string, args interface{}) error {
+	if server.cache == nil {
+		return nil
+	}
+	if name, _, _, err := server.resolveMethod(serviceMethod, ""); err == nil {
+		serviceMethod = name
+	}
+	key, err := cacheKey(serviceMethod, args)
+	if err != nil {
+		return err
+	}
+	return server.cache.Delete(key)
+}
+
+// InvalidateMethodCache removes all cached results of serviceMethod.
+func (server *Server) InvalidateMethodCache(serviceMethod string) error {
+	if server.cache == nil {
+		return nil
+	}
+	if name, _, _, err := server.resolveMethod(serviceMethod, ""); err == nil {
+		serviceMethod = name
+	}
+	return server.cache.DeletePrefix(cacheKeyPrefix + serviceMethod + ":")
+}
+
+func (server *Server) lookupMethod(serviceMethod string) (*methodType, error) {
+	_, _, mtype, err := server.resolveMethod(serviceMethod, "")
+	return mtype, err
+}
+
+// cacheKey returns the key of the result of serviceMethod for args. Params
+// are canonicalised by encoding the decoded argument, so the key does not
+// depend on the order of members, spacing or the codec of the request.
+func cacheKey(serviceMethod string, args interface{}) (string, error) {
+	params, err := paramsHash(args)
+	if err != nil {
+		return "", err
+	}
+	return cacheKeyPrefix + serviceMethod + ":" + params, nil
+}
+
+// paramsHash returns the hex SHA-256 of the canonical params of args.
+func paramsHash(args interface{}) (string, error) {
+	params, err := json.Marshal(args)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(params)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// cachedCall returns the cached result of the call into replyv, or invokes
+// call and caches its result when it succeeds.
+func (server *Server) cachedCall(mtype *methodType, serviceMethod string, argv, replyv reflect.Value, call func() string) string {
+	mtype.Lock()
+	ttl := mtype.cacheTTL
+	mtype.Unlock()
+	if ttl <= 0 || server.cache == nil {
+		return call()
+	}
+
+	key, err := cacheKey(serviceMethod, argv.Interface())
+	if err != nil {
+		return call()
+	}
+	if value, ok, err := server.cache.Get(key); err != nil {
+		server.logError("rpc cache get", "method", serviceMethod, "error", err.Error())
+	} else if ok && json.Unmarshal(value, replyv.Interface()) == nil {
+		Metrics.Add(metricCacheHits, 1)
+		return ""
+	}
+	Metrics.Add(metricCacheMisses, 1)
+
+	errmsg := call()
+	if errmsg != "" {
+		return errmsg
+	}
+	if value, err := json.Marshal(replyv.Interface()); err == nil {
+		if err := server.cache.Set(key, value, ttl); err != nil {
+			server.logError("rpc cache set", "method", serviceMethod, "error", err.Error())
+		}
+	}
+	return ""
+}
+
+// RedisCache is the part of db/redis.Service used as a CacheStore, it is
+// also implemented by *redis.RedisCacheService.
+type RedisCache interface {
+	Get(key string) ([]byte, error)
+	Set(key string, value []byte, ttl int64) error
+	Del(key string) error
+	Dels(keys []string) error
+	Scan(cursor uint64, match string, count int64) (uint64, [][]byte, error)
+}
+
+// scanCount is the count hint of the SCAN pages of DeletePrefix.
+const scanCount = 1000
+
+type redisCacheStore struct {
+	redis RedisCache
+}
+
+// NewRedisCacheStore returns a CacheStore backed by redis.
+func NewRedisCacheStore(redis RedisCache) CacheStore {
+	return &redisCacheStore{redis}
+}
+
+func (s *redisCacheStore) Get(key string) ([]byte, bool, error) {
+	value, err := s.redis.Get(key)
+	if err != nil {
+		return nil, false, err
+	}
+	// missing keys are returned as empty values, cached responses never are
+	return value, len(value) > 0, nil
+}
+
+func (s *redisCacheStore) Set(key string, value []byte, ttl time.Duration) error {
+	return s.redis.Set(key, value, ttlSeconds(ttl))
+}
+
+func (s *redisCacheStore) Delete(key string) error {
+	return s.redis.Del(key)
+}
+
+// DeletePrefix deletes the keys found by SCAN, which unlike KEYS does not
+// block redis on a large keyspace, once the iteration is complete.
+func (s *redisCacheStore) DeletePrefix(prefix string) error {
+	match := globEscaper.Replace(prefix) + "*"
+	var keys []string
+	for cursor := uint64(0); ; {
+		next, page, err := s.redis.Scan(cursor, match, scanCount)
+		if err != nil {
+			return err
+		}
+		for _, key := range page {
+			keys = append(keys, string(key))
+		}
+		if cursor = next; cursor == 0 {
+			break
+		}
+	}
+	for len(keys) > 0 {
+		n := len(keys)
+		if n > scanCount {
+			n = scanCount
+		}
+		if err := s.redis.Dels(keys[:n]); err != nil {
+			return err
+		}
+		keys = keys[n:]
+	}
+	return nil
+}
+
+// globEscaper escapes the special characters of redis glob patterns.
+var globEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
+// LocalCache is the part of *localcache.LocalCacheService used as a CacheStore.
+type LocalCache interface {
+	Get(key string) (interface{}, bool)
+	Set(key string, value interface{}, ttl time.Duration)
+	Delete(key string)
+	DeletePrefix(prefix string)
+}
+
+type localCacheStore struct {
+	cache LocalCache
+}
+
+// NewLocalCacheStore returns a CacheStore backed by an in-process cache.
+func NewLocalCacheStore(cache LocalCache) CacheStore {
+	return &localCacheStore{cache}
+}
+
+func (s *localCacheStore) Get(key string) ([]byte, bool, error) {
+	value, ok := s.cache.Get(key)
+	if !ok {
+		return nil, false, nil
+	}
+	b, ok := value.([]byte)
+	return b, ok, nil
+}
+
+func (s *localCacheStore) Set(key string, value []byte, ttl time.Duration) error {
+	s.cache.Set(key, value, ttl)
+	return nil
+}
+
+func (s *localCacheStore) Delete(key string) error {
+	s.cache.Delete(key)
+	return nil
+}
+
+func (s *localCacheStore) DeletePrefix(prefix string) error {
+	s.cache.DeletePrefix(prefix)
+	return nil
+}
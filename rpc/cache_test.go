@@ -0,0 +1,205 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package rpc
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"path"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/justoxh/go-toolkit/db/localcache"
+)
+
+type QuoteArgs struct {
+	Symbol string
+	Limits map[string]int
+}
+
+type PriceService struct {
+	calls int64
+}
+
+func (s *PriceService) Quote(args *QuoteArgs, reply *Reply) error {
+	atomic.AddInt64(&s.calls, 1)
+	if args.Symbol == "" {
+		return errors.New("no symbol")
+	}
+	reply.C = len(args.Symbol) + len(args.Limits)
+	return nil
+}
+
+func (s *PriceService) Live(args *QuoteArgs, reply *Reply) error {
+	atomic.AddInt64(&s.calls, 1)
+	return nil
+}
+
+func (s *PriceService) CacheTTL() map[string]time.Duration {
+	return map[string]time.Duration{"Quote": time.Minute}
+}
+
+type BadCacheService struct{}
+
+func (BadCacheService) Get(args *Args, reply *Reply) error { return nil }
+
+func (BadCacheService) CacheTTL() map[string]time.Duration {
+	return map[string]time.Duration{"Missing": time.Minute}
+}
+
+func newLocalCacheStore() CacheStore {
+	cache := &localcache.LocalCacheService{}
+	cache.Initialize(localcache.CacheOptions{ExpireTime: 60, CleanupTime: 60})
+	return NewLocalCacheStore(cache)
+}
+
+func Test_Cache(t *testing.T) {
+	svc := &PriceService{}
+	server := NewServer()
+	server.Register(svc)
+	server.SetCache(newLocalCacheStore())
+
+	cli, srv := net.Pipe()
+	go server.ServeCodec(NewServerCodec(srv, server))
+	client := NewClient(cli)
+	defer client.Close()
+
+	call := func(method string, args *QuoteArgs) error {
+		var reply Reply
+		return client.Call(method, args, &reply)
+	}
+	expectCalls := func(n int64) {
+		t.Helper()
+		if calls := atomic.LoadInt64(&svc.calls); calls != n {
+			t.Fatalf("expected %d calls, got %d", n, calls)
+		}
+	}
+
+	args := &QuoteArgs{Symbol: "BTC", Limits: map[string]int{"a": 1, "b": 2}}
+	call("PriceService.Quote", args)
+	call("PriceService.Quote", &QuoteArgs{Symbol: "BTC", Limits: map[string]int{"b": 2, "a": 1}})
+	expectCalls(1)
+
+	// Raw requests with reordered members hit the same entry.
+	fmt.Fprintf(cli, `{"id":9,"params":[{"Limits":{"b":2,"a":1},"Symbol":"BTC"}],"method":"PriceService.Quote","jsonrpc":"2.0"}`)
+	var reply Reply
+	if err := client.Call("PriceService.Quote", args, &reply); err != nil || reply.C != 5 {
+		t.Fatalf("bad cached reply %v %v", reply, err)
+	}
+	expectCalls(1)
+
+	call("PriceService.Quote", &QuoteArgs{Symbol: "ETH"})
+	expectCalls(2)
+
+	// Errors are not cached, nor are methods without annotation.
+	call("PriceService.Quote", &QuoteArgs{})
+	call("PriceService.Quote", &QuoteArgs{})
+	call("PriceService.Live", args)
+	call("PriceService.Live", args)
+	expectCalls(6)
+
+	if err := server.InvalidateCache("PriceService.Quote", args); err != nil {
+		t.Fatal(err)
+	}
+	call("PriceService.Quote", args)
+	call("PriceService.Quote", &QuoteArgs{Symbol: "ETH"})
+	expectCalls(7)
+
+	server.InvalidateMethodCache("PriceService.Quote")
+	call("PriceService.Quote", args)
+	call("PriceService.Quote", &QuoteArgs{Symbol: "ETH"})
+	expectCalls(9)
+
+	if err := server.CacheMethod("PriceService.Live", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	call("PriceService.Live", args)
+	call("PriceService.Live", args)
+	expectCalls(10)
+
+	if err := server.CacheMethod("PriceService.Unknown", time.Minute); err == nil {
+		t.Fatalf("expected error for unknown method")
+	}
+	if err := server.Register(BadCacheService{}); err == nil || !strings.Contains(err.Error(), "Missing") {
+		t.Fatalf("expected error for unknown annotated method, got %v", err)
+	}
+}
+
+type mapRedis map[string][]byte
+
+func (m mapRedis) Get(key string) ([]byte, error) {
+	if v, ok := m[key]; ok {
+		return v, nil
+	}
+	return []byte{}, nil
+}
+
+func (m mapRedis) Set(key string, value []byte, ttl int64) error {
+	m[key] = value
+	return nil
+}
+
+func (m mapRedis) Del(key string) error {
+	delete(m, key)
+	return nil
+}
+
+func (m mapRedis) Dels(keys []string) error {
+	for _, key := range keys {
+		delete(m, key)
+	}
+	return nil
+}
+
+// Scan pages the sorted keys one by one, its cursor is the index of the
+// next key.
+func (m mapRedis) Scan(cursor uint64, match string, count int64) (uint64, [][]byte, error) {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if int(cursor) >= len(keys) {
+		return 0, nil, nil
+	}
+	next := cursor + 1
+	if int(next) == len(keys) {
+		next = 0
+	}
+	if ok, _ := path.Match(match, keys[cursor]); ok {
+		return next, [][]byte{[]byte(keys[cursor])}, nil
+	}
+	return next, nil, nil
+}
+
+func Test_RedisCacheStore(t *testing.T) {
+	redis := mapRedis{}
+	store := NewRedisCacheStore(redis)
+	if _, ok, _ := store.Get("a"); ok {
+		t.Fatalf("unexpected hit")
+	}
+	store.Set("rpc:cache:A.B:1", []byte(`{}`), time.Minute)
+	store.Set("rpc:cache:A.C:1", []byte(`{}`), time.Minute)
+	if v, ok, _ := store.Get("rpc:cache:A.B:1"); !ok || string(v) != `{}` {
+		t.Fatalf("bad value %q", v)
+	}
+	store.Set("rpc:cache:A.B:2", []byte(`{}`), time.Minute)
+	store.DeletePrefix("rpc:cache:A.B:")
+	if _, ok := redis["rpc:cache:A.B:1"]; ok || len(redis) != 1 {
+		t.Fatalf("bad prefix delete %v", redis)
+	}
+
+	// the glob characters of the prefix match themselves only
+	store.Set("rpc:cache:A.*:1", []byte(`{}`), time.Minute)
+	store.DeletePrefix("rpc:cache:A.*:")
+	if _, ok := redis["rpc:cache:A.C:1"]; !ok || len(redis) != 1 {
+		t.Fatalf("bad prefix delete %v", redis)
+	}
+}
@@ -0,0 +1,159 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"math/rand"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/justoxh/go-toolkit/trace"
+)
+
+// Redacted replaces the values of redacted members in captured traffic.
+const Redacted = "[REDACTED]"
+
+// Capture is a call recorded by a Recorder, one per line of its output.
+type Capture struct {
+	Time      time.Time       `json:"time"`
+	RequestID string          `json:"requestId,omitempty"`
+	Method    string          `json:"method"`
+	Params    json.RawMessage `json:"params,omitempty"`
+	Result    json.RawMessage `json:"result,omitempty"`
+	Error     *Error          `json:"error,omitempty"`
+	Duration  time.Duration   `json:"duration"`
+}
+
+// RecorderOptions traffic capture options config
+type RecorderOptions struct {
+	SampleRate float64  // share of calls recorded, from 0 to 1, none if 0
+	Redact     []string // names of members whose values are redacted, at any depth
+}
+
+// Recorder writes the calls served by a Server to a JSON Lines stream. A call
+// which timed out is not written while its method still runs, since the
+// method may still change its params.
+type Recorder struct {
+	sampleRate float64
+	redact     map[string]bool
+
+	mutex sync.Mutex // protects enc, rand
+	enc   *json.Encoder
+	rand  *rand.Rand
+}
+
+// NewRecorder returns a Recorder writing to w. All calls are recorded
+// when options is nil, none when options.SampleRate is 0.
+func NewRecorder(w io.Writer, options *RecorderOptions) *Recorder {
+	r := &Recorder{
+		sampleRate: 1,
+		redact:     make(map[string]bool),
+		enc:        json.NewEncoder(w),
+		rand:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	if options != nil {
+		if options.SampleRate < 1 {
+			r.sampleRate = math.Max(options.SampleRate, 0)
+		}
+		for _, name := range options.Redact {
+			r.redact[strings.ToLower(name)] = true
+		}
+	}
+	return r
+}
+
+// SetRecorder sets the recorder of the calls served by the server.
+func (server *Server) SetRecorder(r *Recorder) {
+	server.recorder = r
+}
+
+func (r *Recorder) sampled() bool {
+	if r.sampleRate >= 1 {
+		return true
+	}
+	if r.sampleRate == 0 {
+		return false
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.rand.Float64() < r.sampleRate
+}
+
+// record writes a call which started at start. Batch calls are not
+// recorded themselves, their elements are.
+func (r *Recorder) record(ctx context.Context, serviceMethod string, start time.Time, argv, replyv reflect.Value, errmsg string) error {
+	if isBatchMethod(serviceMethod) || !r.sampled() {
+		return nil
+	}
+	c := &Capture{
+		Time:      start,
+		RequestID: trace.RequestID(ctx),
+		Method:    serviceMethod,
+		Duration:  time.Since(start),
+	}
+	var err error
+	if c.Params, err = r.marshal(argv.Interface()); err != nil {
+		return err
+	}
+	if errmsg != "" {
+		c.Error = responseError(errmsg)
+	} else if c.Result, err = r.marshal(replyv.Interface()); err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.enc.Encode(c)
+}
+
+// marshal encodes v with the redacted members replaced.
+func (r *Recorder) marshal(v interface{}) (json.RawMessage, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return r.redactJSON(b)
+}
+
+// redactJSON returns the JSON document b with the redacted members replaced.
+func (r *Recorder) redactJSON(b []byte) (json.RawMessage, error) {
+	if len(r.redact) == 0 {
+		return b, nil
+	}
+	// numbers are kept as they are, large integers included
+	var doc interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return json.Marshal(r.redactValue(doc))
+}
+
+func (r *Recorder) redactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for name, member := range v {
+			if r.redact[strings.ToLower(name)] {
+				v[name] = Redacted
+			} else {
+				v[name] = r.redactValue(member)
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = r.redactValue(v[i])
+		}
+	}
+	return v
+}
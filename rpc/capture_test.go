@@ -0,0 +1,96 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package rpc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net"
+	"strings"
+	"testing"
+)
+
+func Test_Recorder(t *testing.T) {
+	server := NewServer()
+	server.Register(new(Arith))
+	var buf bytes.Buffer
+	server.SetRecorder(NewRecorder(&buf, &RecorderOptions{SampleRate: 1, Redact: []string{"a"}}))
+
+	cli, srv := net.Pipe()
+	go server.ServeCodec(NewServerCodec(srv, server))
+	defer cli.Close()
+
+	_, err := cli.Write([]byte(`[{"jsonrpc":"2.0","method":"Arith.Add","params":[{"A":1,"B":2}],"id":1},` +
+		`{"jsonrpc":"2.0","method":"Arith.Div","params":[{"A":1,"B":0}],"id":2}]` + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var replies []json.RawMessage
+	if err := json.NewDecoder(cli).Decode(&replies); err != nil || len(replies) != 2 {
+		t.Fatalf("bad replies %s: %v", replies, err)
+	}
+
+	var captures []*Capture
+	scanner := bufio.NewScanner(strings.NewReader(buf.String()))
+	for scanner.Scan() {
+		c := &Capture{}
+		if err := json.Unmarshal(scanner.Bytes(), c); err != nil {
+			t.Fatalf("bad line %s: %v", scanner.Text(), err)
+		}
+		captures = append(captures, c)
+	}
+	if len(captures) != 2 {
+		t.Fatalf("expected 2 captures, got %d:\n%s", len(captures), buf.String())
+	}
+	add, div := captures[0], captures[1]
+	if add.Method == "Arith.Div" {
+		add, div = div, add
+	}
+	if add.Method != "Arith.Add" || string(add.Params) != `{"A":"[REDACTED]","B":2}` || string(add.Result) != `{"C":3}` || add.Error != nil {
+		t.Fatalf("bad capture %+v", add)
+	}
+	if add.RequestID == "" || add.Time.IsZero() || add.Duration < 0 {
+		t.Fatalf("bad capture timing %+v", add)
+	}
+	if div.Error == nil || div.Error.Code != errServer.Code || div.Error.Message != "divide by zero" || div.Result != nil {
+		t.Fatalf("bad capture %+v", div)
+	}
+}
+
+func Test_RecorderLargeNumbers(t *testing.T) {
+	r := NewRecorder(ioutil.Discard, &RecorderOptions{SampleRate: 1, Redact: []string{"secret"}})
+	b, err := r.marshal(struct {
+		ID     uint64
+		Secret string
+	}{math.MaxUint64, "x"})
+	if err != nil || string(b) != `{"ID":18446744073709551615,"Secret":"[REDACTED]"}` {
+		t.Fatalf("bad params %s: %v", b, err)
+	}
+}
+
+func Test_RecorderSampling(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewRecorder(&buf, &RecorderOptions{SampleRate: 0.1})
+	n := 0
+	for i := 0; i < 10000; i++ {
+		if r.sampled() {
+			n++
+		}
+	}
+	if n < 700 || n > 1300 {
+		t.Fatalf("expected about 1000 sampled calls, got %d", n)
+	}
+
+	if NewRecorder(&buf, &RecorderOptions{}).sampled() {
+		t.Fatalf("expected no call sampled with a zero rate")
+	}
+	if !NewRecorder(&buf, nil).sampled() {
+		t.Fatalf("expected every call sampled without options")
+	}
+}
@@ -5,6 +5,7 @@
 package rpc
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
@@ -19,7 +20,7 @@ const seqNotify = math.MaxUint64
 
 type clientCodec struct {
 	dec *json.Decoder // for reading JSON values
-	enc *json.Encoder // for writing JSON values
+	w   io.Writer     // for writing JSON values
 	c   io.Closer
 
 	// temporary work space
@@ -31,13 +32,15 @@ type clientCodec struct {
 	// and then look it up by request ID when filling out the rpc Response.
 	mutex   sync.Mutex        // protects pending
 	pending map[uint64]string // map request id to method name
+
+	jsonrpc1 bool // requests are sent with JSON-RPC 1.0
 }
 
 // NewClientCodec returns a new rpc.ClientCodec using JSON-RPC 2.0 on conn.
 func NewClientCodec(conn io.ReadWriteCloser) rpc.ClientCodec {
 	return &clientCodec{
 		dec:     json.NewDecoder(conn),
-		enc:     json.NewEncoder(conn),
+		w:       conn,
 		c:       conn,
 		pending: make(map[uint64]string),
 	}
@@ -48,12 +51,78 @@ type clientRequest struct {
 	Method  string         `json:"method"`
 	Params  [1]interface{} `json:"params,omitempty"`
 	ID      *uint64        `json:"id,omitempty"`
+	Meta    *callMeta      `json:"meta,omitempty"`
 }
 
 func (c *clientCodec) WriteRequest(r *rpc.Request, param interface{}) error {
-	// If return error: it will be returned as is for this call.
-	// Allow param to be only Array, Slice, Map or Struct.
-	// When param is nil or uninitialized Map or Slice - omit "params".
+	encode := encodeRequest
+	if c.jsonrpc1 {
+		encode = encodeRequest1
+	}
+	buf, err := encode(r, param)
+	if err != nil {
+		return err
+	}
+	if r.Seq != seqNotify {
+		c.mutex.Lock()
+		c.pending[r.Seq] = r.ServiceMethod
+		c.mutex.Unlock()
+	}
+	if _, err := c.w.Write(append(buf, '\n')); err != nil {
+		return connError(err)
+	}
+	return nil
+}
+
+// encodeRequest returns the JSON-RPC 2.0 request object of r.
+func encodeRequest(r *rpc.Request, param interface{}) ([]byte, error) {
+	meta, param := unwrapParam(param)
+	param, err := normalizeParam(param)
+	if err != nil {
+		return nil, err
+	}
+
+	var req clientRequest
+	if r.Seq != seqNotify {
+		req.ID = &r.Seq
+	}
+	req.Version = jsonrpcVersion
+	req.Method = r.ServiceMethod
+	req.Params[0] = param
+	req.Meta = meta
+	buf, err := json.Marshal(&req)
+	if err != nil {
+		return nil, NewError(errInternal.Code, err.Error())
+	}
+	return buf, nil
+}
+
+// connError returns the error reported to callers when the connection
+// fails, as opposed to an error object sent by the server.
+func connError(err error) *Error {
+	e := NewError(errInternal.Code, err.Error())
+	e.conn = true
+	return e
+}
+
+// isTransportError reports whether err comes from the connection rather
+// than from an error object sent by the server.
+func isTransportError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if e, ok := err.(*Error); ok {
+		return e.conn
+	}
+	e, perr := serverError(err)
+	return perr != nil || e.conn
+}
+
+// normalizeParam checks the param of an outgoing request.
+// If return error: it will be returned as is for this call.
+// Allow param to be only Array, Slice, Map or Struct.
+// When param is nil or uninitialized Map or Slice - omit "params".
+func normalizeParam(param interface{}) (interface{}, error) {
 	if param != nil {
 		switch k := reflect.TypeOf(param).Kind(); k {
 		case reflect.Map:
@@ -81,27 +150,13 @@ func (c *clientCodec) WriteRequest(r *rpc.Request, param interface{}) error {
 				}
 			case reflect.Array, reflect.Struct, reflect.String, reflect.Ptr, reflect.Interface:
 			default:
-				return NewError(errInternal.Code, "unsupported param type: Ptr to "+k.String())
+				return nil, NewError(errInternal.Code, "unsupported param type: Ptr to "+k.String())
 			}
 		default:
-			return NewError(errInternal.Code, "unsupported param type: "+k.String())
+			return nil, NewError(errInternal.Code, "unsupported param type: "+k.String())
 		}
 	}
-
-	var req clientRequest
-	if r.Seq != seqNotify {
-		c.mutex.Lock()
-		c.pending[r.Seq] = r.ServiceMethod
-		c.mutex.Unlock()
-		req.ID = &r.Seq
-	}
-	req.Version = jsonrpcVersion
-	req.Method = r.ServiceMethod
-	req.Params[0] = param
-	if err := c.enc.Encode(&req); err != nil {
-		return NewError(errInternal.Code, err.Error())
-	}
-	return nil
+	return param, nil
 }
 
 type clientResponse struct {
@@ -133,7 +188,12 @@ func (r *clientResponse) UnmarshalJSON(raw []byte) error {
 	_, okID := respMap["id"]
 	_, okRes := respMap["result"]
 	_, okErr := respMap["error"]
-	if !okVer || !okID || !(okRes || okErr) || (okRes && okErr) || len(respMap) > 3 {
+	// the warning of a deprecated method is the only other member allowed
+	members := len(respMap)
+	if _, okWarn := respMap["warning"]; okWarn {
+		members--
+	}
+	if !okVer || !okID || !(okRes || okErr) || (okRes && okErr) || members > 3 {
 		return errors.New("bad response: " + string(raw))
 	}
 	if r.Version != jsonrpcVersion {
@@ -170,11 +230,11 @@ func (c *clientCodec) ReadResponseHeader(r *rpc.Response) error {
 	// - it will be returned as is for all pending calls
 	// - client will be shutdown
 	// So, return io.EOF as is, return *Error for all other errors.
-	if err := c.dec.Decode(&c.resp); err != nil {
+	if err := c.decodeResponse(); err != nil {
 		if err == io.EOF {
 			return err
 		}
-		return NewError(errInternal.Code, err.Error())
+		return connError(err)
 	}
 	if c.resp.ID == nil {
 		return c.resp.Error
@@ -193,16 +253,31 @@ func (c *clientCodec) ReadResponseHeader(r *rpc.Response) error {
 	return nil
 }
 
+func (c *clientCodec) decodeResponse() error {
+	if !c.jsonrpc1 {
+		return c.dec.Decode(&c.resp)
+	}
+	var raw json.RawMessage
+	if err := c.dec.Decode(&raw); err != nil {
+		return err
+	}
+	return c.resp.unmarshalJSONRPC1(raw)
+}
+
 func (c *clientCodec) ReadResponseBody(x interface{}) error {
 	// If x!=nil and return error e:
 	// - this call get e.Error() appended to "reading body "
 	// - other pending calls get error as is XXX actually other calls
 	//   shouldn't be affected by this error at all, so let's at least
 	//   provide different error message for other calls
+	return unmarshalResult(c.resp.Result, x)
+}
+
+func unmarshalResult(result *json.RawMessage, x interface{}) error {
 	if x == nil {
 		return nil
 	}
-	if err := json.Unmarshal(*c.resp.Result, x); err != nil {
+	if err := json.Unmarshal(*result, x); err != nil {
 		e := NewError(errInternal.Code, err.Error())
 		e.Data = NewError(errInternal.Code, "failed to unmarshal Reply when some other Call")
 		return e
@@ -223,6 +298,9 @@ func (c *clientCodec) Close() error {
 type Client struct {
 	*rpc.Client
 	codec rpc.ClientCodec
+
+	endpoint string   // address given to Dial, names the circuit of breaker
+	breaker  *Breaker // nil if calls are not guarded
 }
 
 // Notify try to invoke the named function. It return error only in case
@@ -235,6 +313,48 @@ func (c Client) Notify(serviceMethod string, args interface{}) error {
 	return c.codec.WriteRequest(req, args)
 }
 
+// SetBreaker guards the calls of the client with the circuit breaker b.
+// While its circuit is open, Call and CallContext fail with ErrBreakerOpen
+// without sending the request.
+func (c *Client) SetBreaker(b *Breaker) {
+	c.breaker = b
+}
+
+// Call invokes the named function, waits for it to complete, and returns
+// its error status.
+func (c *Client) Call(serviceMethod string, args interface{}, reply interface{}) error {
+	return c.CallContext(context.Background(), serviceMethod, args, reply)
+}
+
+// CallContext is like Call but sends the request ID and a child of the
+// trace context carried by ctx along with the request. It returns
+// ctx.Err() if ctx is done before the reply arrives, in which case reply
+// must not be used.
+func (c *Client) CallContext(ctx context.Context, serviceMethod string, args interface{}, reply interface{}) error {
+	if c.breaker != nil {
+		return c.breaker.do(c.breaker.circuitName(c.endpoint, serviceMethod), func() error {
+			return c.callContext(ctx, serviceMethod, args, reply)
+		})
+	}
+	return c.callContext(ctx, serviceMethod, args, reply)
+}
+
+func (c *Client) callContext(ctx context.Context, serviceMethod string, args interface{}, reply interface{}) error {
+	call := c.Go(serviceMethod, wrapArgs(ctx, c.codec, args), reply, make(chan *rpc.Call, 1))
+	select {
+	case <-call.Done:
+		return call.Error
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// NotifyContext is like Notify but sends the request ID and a child of the
+// trace context carried by ctx along with the request.
+func (c *Client) NotifyContext(ctx context.Context, serviceMethod string, args interface{}) error {
+	return c.Notify(serviceMethod, wrapArgs(ctx, c.codec, args))
+}
+
 // NewClient returns a new Client to handle requests to the
 // set of services at the other end of the connection.
 func NewClient(conn io.ReadWriteCloser) *Client {
@@ -244,7 +364,7 @@ func NewClient(conn io.ReadWriteCloser) *Client {
 // NewClientWithCodec returns a new Client using the given rpc.ClientCodec.
 func NewClientWithCodec(codec rpc.ClientCodec) *Client {
 	client := rpc.NewClientWithCodec(codec)
-	return &Client{client, codec}
+	return &Client{Client: client, codec: codec}
 }
 
 // Dial connects to a JSON-RPC 2.0 server at the specified network address.
@@ -253,5 +373,7 @@ func Dial(network, address string) (*Client, error) {
 	if err != nil {
 		return nil, err
 	}
-	return NewClient(conn), err
+	client := NewClient(conn)
+	client.endpoint = address
+	return client, err
 }
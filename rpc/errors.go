@@ -13,6 +13,9 @@ import (
 var (
 	errServer      = NewError(-32000, "Server error")
 	errServerError = NewError(-32001, "Jsonrpc2.Error: json.Marshal failed")
+	errBusy        = NewError(-32003, "Server busy")
+	errTimeout     = NewError(-32004, "Call timeout")
+	errInProgress  = NewError(-32005, "Call in progress")
 	errRequest     = NewError(-32600, "Invalid request")
 	errMethod      = NewError(-32601, "Method not found")
 	errParams      = NewError(-32602, "Invalid params")
@@ -25,6 +28,8 @@ type Error struct {
 	Code    int         `json:"code"`
 	Message string      `json:"message"`
 	Data    interface{} `json:"data,omitempty"`
+
+	conn bool // set by the client codecs when the connection failed
 }
 
 // NewError returns an Error with given code and message.
@@ -50,17 +55,26 @@ func newError(message string) *Error {
 // User should check for rpc.ErrShutdown and io.ErrUnexpectedEOF before
 // calling ServerError.
 func ServerError(rpcerr error) *Error {
+	e, err := serverError(rpcerr)
+	if err != nil {
+		panic(fmt.Sprintf("not a jsonrpc2 error: %s (%#q)", err, rpcerr))
+	}
+	return e
+}
+
+// serverError is ServerError which reports errors instead of panicking.
+func serverError(rpcerr error) (*Error, error) {
 	if rpcerr == nil {
-		return nil
+		return nil, nil
 	}
 	if err, ok := rpcerr.(*Error); ok {
 		if err.Code == errInternal.Code && err.Data != nil {
 			if err2, ok := err.Data.(*Error); ok {
 				// Use alternate error when ReadResponseBody fail on other call.
-				return err2
+				return err2, nil
 			}
 		}
-		return err
+		return err, nil
 	}
 	keepData := true
 	errmsg := rpcerr.Error()
@@ -69,21 +83,34 @@ func ServerError(rpcerr error) *Error {
 		errmsg = errmsg[s:]
 		keepData = false
 	}
-	e := &Error{}
+	e := &transportError{Error: &Error{}}
 	err := json.Unmarshal([]byte(errmsg), e)
 	if err != nil {
-		panic(fmt.Sprintf("not a jsonrpc2 error: %s (%#q)", err, rpcerr))
+		return nil, err
 	}
+	e.conn = e.Transport
 	if e.Code == errInternal.Code && e.Data != nil && !keepData {
 		// ReadResponseBody fail on this call.
 		e.Data = nil
 	}
-	return e
+	return e.Error, nil
+}
+
+// transportError is the JSON representation of an Error of the connection.
+// Its flag survives the string of the errors which net/rpc reports to the
+// callers, as the HTTP client codec fails a single call with one.
+type transportError struct {
+	*Error
+	Transport bool `json:"transport,omitempty"`
 }
 
 // Error returns JSON representation of Error.
 func (e *Error) Error() string {
-	buf, err := json.Marshal(e)
+	var v interface{} = e
+	if e.conn {
+		v = &transportError{Error: e, Transport: true}
+	}
+	buf, err := json.Marshal(v)
 	if err != nil {
 		msg, err := json.Marshal(err.Error())
 		if err != nil {
@@ -93,3 +120,13 @@ func (e *Error) Error() string {
 	}
 	return string(buf)
 }
+
+// ErrorCode returns the code of the error object.
+func (e *Error) ErrorCode() int {
+	return e.Code
+}
+
+// ErrorData returns the data of the error object.
+func (e *Error) ErrorData() interface{} {
+	return e.Data
+}
@@ -0,0 +1,400 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	stdlog "log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/justoxh/go-toolkit/log"
+	"github.com/justoxh/go-toolkit/rpc"
+	"github.com/justoxh/go-toolkit/trace"
+)
+
+const jsonrpcVersion = "2.0"
+
+var (
+	errParse    = rpc.NewError(-32700, "Parse error")
+	errRequest  = rpc.NewError(-32600, "Invalid request")
+	errMethod   = rpc.NewError(-32601, "Method not found")
+	errUpstream = rpc.NewError(-32002, "Upstream unavailable")
+)
+
+var null = json.RawMessage("null")
+
+// Route sends the methods whose name starts with Prefix followed by a dot
+// to Upstreams, the URLs of JSON-RPC HTTP endpoints. The longest matching
+// prefix wins and the empty prefix matches every method.
+type Route struct {
+	Prefix    string
+	Upstreams []string
+}
+
+// Options gateway options config
+type Options struct {
+	Routes []Route
+
+	Timeout     time.Duration // timeout of a request to an upstream
+	MaxFails    int           // consecutive failures before an upstream is marked down
+	FailTimeout time.Duration // how long an upstream stays down
+	MaxBodySize int64         // max size of an incoming request body
+
+	Transport http.RoundTripper // used to reach the upstreams, http.DefaultTransport if nil
+}
+
+func defaultOptions() *Options {
+	return &Options{
+		Timeout:     30 * time.Second,
+		MaxFails:    3,
+		FailTimeout: 10 * time.Second,
+		MaxBodySize: 1 << 20,
+	}
+}
+
+// Gateway is an http.Handler which routes JSON-RPC requests, including each
+// element of a batch, to upstreams by the namespace of their method, and
+// merges batch results back in the original order.
+type Gateway struct {
+	routes      []*route
+	client      *http.Client
+	maxFails    int
+	failTimeout time.Duration
+	maxBodySize int64
+	log         log.Logger
+}
+
+// New returns a new Gateway for the routes of options.
+func New(options *Options) (*Gateway, error) {
+	if options == nil || len(options.Routes) == 0 {
+		return nil, errors.New("gateway: no routes")
+	}
+	def := defaultOptions()
+	g := &Gateway{
+		client:      &http.Client{Transport: options.Transport, Timeout: options.Timeout},
+		maxFails:    options.MaxFails,
+		failTimeout: options.FailTimeout,
+		maxBodySize: options.MaxBodySize,
+	}
+	if g.client.Timeout <= 0 {
+		g.client.Timeout = def.Timeout
+	}
+	if g.maxFails <= 0 {
+		g.maxFails = def.MaxFails
+	}
+	if g.failTimeout <= 0 {
+		g.failTimeout = def.FailTimeout
+	}
+	if g.maxBodySize <= 0 {
+		g.maxBodySize = def.MaxBodySize
+	}
+
+	prefixes := make(map[string]bool)
+	for _, r := range options.Routes {
+		if len(r.Upstreams) == 0 {
+			return nil, fmt.Errorf("gateway: route %q has no upstreams", r.Prefix)
+		}
+		if prefixes[r.Prefix] {
+			return nil, fmt.Errorf("gateway: duplicate route %q", r.Prefix)
+		}
+		prefixes[r.Prefix] = true
+		rt := &route{prefix: r.Prefix}
+		for _, url := range r.Upstreams {
+			rt.upstreams = append(rt.upstreams, &upstream{url: url})
+		}
+		g.routes = append(g.routes, rt)
+	}
+	sortRoutes(g.routes)
+	return g, nil
+}
+
+// SetLogger sets the logger used to report upstream failures.
+func (g *Gateway) SetLogger(l log.Logger) {
+	g.log = l
+}
+
+// logError logs through the gateway logger, or the standard logger if none is set.
+func (g *Gateway) logError(f interface{}, args ...interface{}) {
+	if g.log != nil {
+		g.log.Error(f, args...)
+		return
+	}
+	stdlog.Println(append([]interface{}{f}, args...)...)
+}
+
+// call is a request of the incoming message.
+type call struct {
+	raw    json.RawMessage
+	method string
+	id     json.RawMessage // nil for a notification
+	reply  json.RawMessage // nil until replied, never set for a notification
+}
+
+// parseCall checks a request just enough to route it.
+func parseCall(raw json.RawMessage) (*call, error) {
+	var req map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return nil, errRequest
+	}
+	var version, method string
+	if json.Unmarshal(req["jsonrpc"], &version) != nil || version != jsonrpcVersion {
+		return nil, errRequest
+	}
+	if json.Unmarshal(req["method"], &method) != nil || method == "" {
+		return nil, errRequest
+	}
+	c := &call{raw: raw, method: method}
+	if id, ok := req["id"]; ok {
+		c.id = id
+	}
+	return c, nil
+}
+
+// idKey returns the canonical form of a request id, used to match replies.
+func idKey(id json.RawMessage) string {
+	var buf bytes.Buffer
+	if json.Compact(&buf, id) != nil {
+		return string(id)
+	}
+	return buf.String()
+}
+
+func errorReply(id json.RawMessage, e *rpc.Error) json.RawMessage {
+	if id == nil {
+		id = null
+	}
+	b, _ := json.Marshal(struct {
+		Version string          `json:"jsonrpc"`
+		ID      json.RawMessage `json:"id"`
+		Error   *rpc.Error      `json:"error"`
+	}{jsonrpcVersion, id, e})
+	return b
+}
+
+// ServeHTTP implements an http.Handler that proxies JSON-RPC POST requests.
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		io.WriteString(w, "405 must POST\n")
+		return
+	}
+
+	ctx := trace.FromHeader(req.Context(), req.Header)
+	if trace.RequestID(ctx) == "" {
+		ctx = trace.WithRequestID(ctx, trace.NewRequestID())
+	}
+	w.Header().Set(trace.RequestIDHeader, trace.RequestID(ctx))
+	w.Header().Set("Content-Type", "application/json")
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, g.maxBodySize))
+	if err != nil {
+		w.Write(errorReply(nil, rpc.NewError(errParse.Code, err.Error())))
+		return
+	}
+	body = bytes.TrimSpace(body)
+
+	if len(body) == 0 || body[0] != '[' {
+		if !json.Valid(body) {
+			w.Write(errorReply(nil, errParse))
+			return
+		}
+		c, err := parseCall(body)
+		if err != nil {
+			w.Write(errorReply(nil, err.(*rpc.Error)))
+			return
+		}
+		g.dispatch(ctx, []*call{c}, false)
+		if c.reply != nil {
+			w.Write(c.reply)
+		}
+		return
+	}
+
+	var raws []json.RawMessage
+	if err := json.Unmarshal(body, &raws); err != nil {
+		w.Write(errorReply(nil, errParse))
+		return
+	}
+	if len(raws) == 0 {
+		w.Write(errorReply(nil, errRequest))
+		return
+	}
+	calls := make([]*call, len(raws))
+	var valid []*call
+	for i, raw := range raws {
+		c, err := parseCall(raw)
+		if err != nil {
+			calls[i] = &call{reply: errorReply(nil, err.(*rpc.Error))}
+			continue
+		}
+		calls[i] = c
+		valid = append(valid, c)
+	}
+	g.dispatch(ctx, valid, true)
+
+	var replies []json.RawMessage
+	for _, c := range calls {
+		if c.reply != nil {
+			replies = append(replies, c.reply)
+		}
+	}
+	if len(replies) == 0 {
+		return
+	}
+	json.NewEncoder(w).Encode(replies)
+}
+
+// dispatch groups calls by route and forwards each group to an upstream,
+// concurrently. It returns once every call with an id has a reply.
+func (g *Gateway) dispatch(ctx context.Context, calls []*call, batch bool) {
+	groups := make(map[*route][]*call)
+	var order []*route
+	for _, c := range calls {
+		r := g.match(c.method)
+		if r == nil {
+			if c.id != nil {
+				c.reply = errorReply(c.id, rpc.NewError(errMethod.Code, "gateway: no route for method "+c.method))
+			}
+			continue
+		}
+		if _, ok := groups[r]; !ok {
+			order = append(order, r)
+		}
+		groups[r] = append(groups[r], c)
+	}
+
+	var wg sync.WaitGroup
+	for _, r := range order {
+		wg.Add(1)
+		go func(r *route, calls []*call) {
+			defer wg.Done()
+			g.forward(ctx, r, calls, batch)
+		}(r, groups[r])
+	}
+	wg.Wait()
+}
+
+func (g *Gateway) match(method string) *route {
+	for _, r := range g.routes {
+		if r.match(method) {
+			return r
+		}
+	}
+	return nil
+}
+
+// forward sends calls to an upstream of r, as a batch if the incoming
+// message was one, and sets their replies.
+func (g *Gateway) forward(ctx context.Context, r *route, calls []*call, batch bool) {
+	u := r.pick()
+	body := calls[0].raw
+	if batch {
+		raws := make([]json.RawMessage, len(calls))
+		for i, c := range calls {
+			raws[i] = c.raw
+		}
+		body, _ = json.Marshal(raws)
+	}
+
+	reply, err := g.post(ctx, u, body)
+	if err != nil {
+		g.logError("gateway upstream failed", "upstream", u.url, "request_id", trace.RequestID(ctx), "error", err.Error())
+		for _, c := range calls {
+			if c.id != nil {
+				c.reply = errorReply(c.id, rpc.NewError(errUpstream.Code, err.Error()))
+			}
+		}
+		return
+	}
+
+	reply = bytes.TrimSpace(reply)
+	if !batch {
+		if len(reply) > 0 {
+			calls[0].reply = reply
+		}
+		return
+	}
+
+	// Match the replies of the batch to the calls by id.
+	var replies []json.RawMessage
+	if len(reply) > 0 && reply[0] == '[' {
+		json.Unmarshal(reply, &replies)
+	} else if len(reply) > 0 {
+		replies = []json.RawMessage{reply}
+	}
+	byID := make(map[string][]json.RawMessage)
+	for _, rep := range replies {
+		var resp struct {
+			ID json.RawMessage `json:"id"`
+		}
+		if json.Unmarshal(rep, &resp) == nil && resp.ID != nil {
+			key := idKey(resp.ID)
+			byID[key] = append(byID[key], rep)
+		}
+	}
+	for _, c := range calls {
+		if c.id == nil {
+			continue
+		}
+		key := idKey(c.id)
+		if reps := byID[key]; len(reps) > 0 {
+			c.reply = reps[0]
+			byID[key] = reps[1:]
+		} else {
+			c.reply = errorReply(c.id, rpc.NewError(errUpstream.Code, "gateway: no reply from upstream"))
+		}
+	}
+}
+
+// post sends body to u and returns the response body. Transport errors and
+// 5xx responses count as failures of the upstream.
+func (g *Gateway) post(ctx context.Context, u *upstream, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodPost, u.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(trace.RequestIDHeader, trace.RequestID(ctx))
+	if tp := trace.ChildTraceParent(trace.TraceParent(ctx)); tp != "" {
+		req.Header.Set(trace.TraceParentHeader, tp)
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		g.report(u, false)
+		return nil, err
+	}
+	defer resp.Body.Close()
+	reply, err := ioutil.ReadAll(resp.Body)
+	if err != nil || resp.StatusCode >= http.StatusInternalServerError {
+		g.report(u, false)
+		if err == nil {
+			err = fmt.Errorf("gateway: upstream status %s", resp.Status)
+		}
+		return nil, err
+	}
+	g.report(u, true)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("gateway: upstream status %s", resp.Status)
+	}
+	return reply, nil
+}
+
+func (g *Gateway) report(u *upstream, ok bool) {
+	if u.report(ok, g.maxFails, g.failTimeout) {
+		g.logError("gateway upstream down", "upstream", u.url, "for", g.failTimeout.String())
+	}
+}
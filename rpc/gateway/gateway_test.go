@@ -0,0 +1,180 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/justoxh/go-toolkit/rpc"
+)
+
+type Args struct {
+	A, B int
+}
+
+type Named struct {
+	name string
+}
+
+func (n *Named) Name(args *Args, reply *string) error {
+	*reply = n.name
+	return nil
+}
+
+func (n *Named) Add(args *Args, reply *int) error {
+	*reply = args.A + args.B
+	return nil
+}
+
+func newUpstream(namespace, name string) *httptest.Server {
+	server, _ := rpc.NewHTTPServer(nil, nil)
+	server.GetServer().RegisterName(namespace, &Named{name})
+	return httptest.NewServer(server)
+}
+
+type reply struct {
+	ID     interface{}
+	Result interface{}
+	Error  *rpc.Error
+}
+
+func post(t *testing.T, g *Gateway, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "http://url.com", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, req)
+	return w
+}
+
+func Test_Gateway_Batch(t *testing.T) {
+	order := newUpstream("Order", "order")
+	defer order.Close()
+	user := newUpstream("User", "user")
+	defer user.Close()
+
+	g, err := New(&Options{Routes: []Route{
+		{Prefix: "Order", Upstreams: []string{order.URL}},
+		{Prefix: "User", Upstreams: []string{user.URL}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := post(t, g, `{"jsonrpc":"2.0","method":"User.Name","id":1,"params":[{}]}`)
+	var single reply
+	if err := json.Unmarshal(w.Body.Bytes(), &single); err != nil || single.Result != "user" {
+		t.Fatalf("bad reply %s", w.Body)
+	}
+	if w.Header().Get("X-Request-ID") == "" {
+		t.Fatalf("missing request id")
+	}
+
+	w = post(t, g, `[
+		{"jsonrpc":"2.0","method":"User.Name","id":"a","params":[{}]},
+		{"jsonrpc":"2.0","method":"Order.Add","id":"b","params":[{"A":1,"B":2}]},
+		"bad",
+		{"jsonrpc":"2.0","method":"Order.Name","params":[{}]},
+		{"jsonrpc":"2.0","method":"Stock.Get","id":"c","params":[{}]},
+		{"jsonrpc":"2.0","method":"Order.Name","id":"d","params":[{}]},
+		{"jsonrpc":"2.0","method":"User.Add","id":"e","params":[{"A":3,"B":4}]}
+	]`)
+	var replies []reply
+	if err := json.Unmarshal(w.Body.Bytes(), &replies); err != nil {
+		t.Fatalf("bad batch reply %s: %s", w.Body, err)
+	}
+	// The notification gets no reply, the others keep their order.
+	expected := []reply{
+		{ID: "a", Result: "user"},
+		{ID: "b", Result: float64(3)},
+		{ID: nil, Error: rpc.NewError(-32600, "")},
+		{ID: "c", Error: rpc.NewError(-32601, "")},
+		{ID: "d", Result: "order"},
+		{ID: "e", Result: float64(7)},
+	}
+	if len(replies) != len(expected) {
+		t.Fatalf("expected %d replies, got %s", len(expected), w.Body)
+	}
+	for i, r := range replies {
+		e := expected[i]
+		if r.ID != e.ID || r.Result != e.Result || (r.Error == nil) != (e.Error == nil) || (r.Error != nil && r.Error.Code != e.Error.Code) {
+			t.Fatalf("reply %d: got %+v expected %+v", i, r, e)
+		}
+	}
+
+	if w = post(t, g, `[]`); !strings.Contains(w.Body.String(), "-32600") {
+		t.Fatalf("expected invalid request for empty batch, got %s", w.Body)
+	}
+	if w = post(t, g, `{"jsonrpc":`); !strings.Contains(w.Body.String(), "-32700") {
+		t.Fatalf("expected parse error, got %s", w.Body)
+	}
+}
+
+func Test_Gateway_Balance(t *testing.T) {
+	a := newUpstream("Echo", "a")
+	defer a.Close()
+	b := newUpstream("Echo", "b")
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer down.Close()
+
+	g, err := New(&Options{
+		Routes:      []Route{{Prefix: "", Upstreams: []string{a.URL, b.URL, down.URL}}},
+		MaxFails:    1,
+		FailTimeout: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.SetLogger(nopLogger{})
+
+	names := func(n int) map[interface{}]int {
+		seen := make(map[interface{}]int)
+		for i := 0; i < n; i++ {
+			var r reply
+			w := post(t, g, `{"jsonrpc":"2.0","method":"Echo.Name","id":1,"params":[{}]}`)
+			json.Unmarshal(w.Body.Bytes(), &r)
+			if r.Error != nil {
+				seen[r.Error.Code]++
+			} else {
+				seen[r.Result]++
+			}
+		}
+		return seen
+	}
+
+	// The failing upstream answers once, then it is down.
+	if seen := names(7); seen["a"] != 3 || seen["b"] != 3 || seen[-32002] != 1 {
+		t.Fatalf("bad balance %v", seen)
+	}
+
+	b.Close()
+	if seen := names(4); seen["a"] != 3 || seen[-32002] != 1 {
+		t.Fatalf("bad balance after closing b %v", seen)
+	}
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(f interface{}, args ...interface{})  {}
+func (nopLogger) Info(f interface{}, args ...interface{})   {}
+func (nopLogger) Warn(f interface{}, args ...interface{})   {}
+func (nopLogger) Printf(f interface{}, args ...interface{}) {}
+func (nopLogger) Panic(f interface{}, args ...interface{})  {}
+func (nopLogger) Fatal(f interface{}, args ...interface{})  {}
+func (nopLogger) Error(f interface{}, args ...interface{})  {}
+func (nopLogger) Debugln(args ...interface{})               {}
+func (nopLogger) Infoln(args ...interface{})                {}
+func (nopLogger) Warnln(args ...interface{})                {}
+func (nopLogger) Printfln(args ...interface{})              {}
+func (nopLogger) Panicln(args ...interface{})               {}
+func (nopLogger) Fatalln(args ...interface{})               {}
+func (nopLogger) Errorln(args ...interface{})               {}
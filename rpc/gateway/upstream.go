@@ -0,0 +1,87 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package gateway
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// upstream is a JSON-RPC endpoint behind the gateway. It is marked down for
+// failTimeout after maxFails consecutive failures, like nginx's max_fails.
+type upstream struct {
+	url string
+
+	mutex     sync.Mutex // protects fails, downUntil
+	fails     int
+	downUntil time.Time
+}
+
+func (u *upstream) healthy(now time.Time) bool {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	return !now.Before(u.downUntil)
+}
+
+// report records the outcome of a forwarded request.
+func (u *upstream) report(ok bool, maxFails int, failTimeout time.Duration) (down bool) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	if ok {
+		u.fails = 0
+		return false
+	}
+	u.fails++
+	if u.fails >= maxFails {
+		u.fails = 0
+		u.downUntil = time.Now().Add(failTimeout)
+		return true
+	}
+	return false
+}
+
+// route sends the methods of a namespace prefix to a set of upstreams.
+type route struct {
+	prefix    string
+	upstreams []*upstream
+
+	mutex sync.Mutex // protects next
+	next  int
+}
+
+// pick returns the next healthy upstream in round-robin order. When all of
+// them are down it still returns one rather than failing the request.
+func (r *route) pick() *upstream {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	now := time.Now()
+	for i := 0; i < len(r.upstreams); i++ {
+		u := r.upstreams[(r.next+i)%len(r.upstreams)]
+		if u.healthy(now) {
+			r.next = (r.next + i + 1) % len(r.upstreams)
+			return u
+		}
+	}
+	u := r.upstreams[r.next]
+	r.next = (r.next + 1) % len(r.upstreams)
+	return u
+}
+
+// match reports whether method belongs to the namespace prefix of r.
+// The empty prefix matches every method.
+func (r *route) match(method string) bool {
+	return r.prefix == "" || strings.HasPrefix(method, r.prefix+".")
+}
+
+// sortRoutes orders routes from the longest prefix to the shortest one,
+// so the most specific route matches first.
+func sortRoutes(routes []*route) {
+	sort.SliceStable(routes, func(i, j int) bool {
+		return len(routes[i].prefix) > len(routes[j].prefix)
+	})
+}
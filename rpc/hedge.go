@@ -0,0 +1,95 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package rpc
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// maxHedgeTokens bounds the hedges a MultiClient saves up while its calls
+// are fast, so that a slow spell can not hedge a burst of calls.
+const maxHedgeTokens = 10
+
+// hedgeBudget is a token bucket refilled by ratio of a token per call,
+// a hedge takes a whole token, so that at most ratio of the calls are
+// hedged.
+type hedgeBudget struct {
+	mutex  sync.Mutex
+	ratio  float64
+	tokens float64
+}
+
+func (b *hedgeBudget) deposit() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.tokens += b.ratio
+	if b.tokens > maxHedgeTokens {
+		b.tokens = maxHedgeTokens
+	}
+}
+
+func (b *hedgeBudget) withdraw() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// hedgeResult is the outcome of an attempt of a hedged call.
+type hedgeResult struct {
+	reply reflect.Value
+	err   error
+	hedge bool
+}
+
+// hedgedCall sends an idempotent call, and a duplicate to another endpoint
+// if no reply arrived after HedgeDelay. Each attempt decodes its own reply,
+// the first one received is copied to replyv and the other attempt is
+// cancelled. An attempt which failed in transport does not win while the
+// other is in progress.
+func (m *MultiClient) hedgedCall(ctx context.Context, serviceMethod string, args interface{}, replyv reflect.Value) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	tried := newTriedEndpoints()
+	results := make(chan hedgeResult, 2)
+	attempt := func(hedge bool) {
+		reply := reflect.New(replyv.Type().Elem())
+		err := m.call(ctx, serviceMethod, args, reply.Interface(), true, tried)
+		results <- hedgeResult{reply: reply, err: err, hedge: hedge}
+	}
+	go attempt(false)
+
+	timer := time.NewTimer(m.options.HedgeDelay)
+	defer timer.Stop()
+	for pending := 1; ; {
+		select {
+		case <-timer.C:
+			if m.untried(tried) && m.hedges.withdraw() {
+				Metrics.Add(metricHedgedCalls, 1)
+				pending++
+				go attempt(true)
+			}
+		case r := <-results:
+			pending--
+			if r.err != nil && isTransportError(r.err) && pending > 0 {
+				continue
+			}
+			if r.err == nil {
+				replyv.Elem().Set(r.reply.Elem())
+				if r.hedge {
+					Metrics.Add(metricHedgeWins, 1)
+				}
+			}
+			return r.err
+		}
+	}
+}
@@ -0,0 +1,70 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package rpc
+
+import (
+	"testing"
+	"time"
+)
+
+func newHedgedClient(t *testing.T, delay time.Duration, options *MultiClientOptions) *MultiClient {
+	slow := listenNameService(t, &NameService{name: "slow", delay: delay})
+	fast := listenName(t, "fast")
+	t.Cleanup(func() {
+		slow.Close()
+		fast.Close()
+	})
+	// the first attempt of every call goes to the slow endpoint
+	options.Strategy = PriorityFailover
+	options.HedgeDelay = 20 * time.Millisecond
+	m, err := NewMultiClient([]string{slow.Addr().String(), fast.Addr().String()}, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+func Test_MultiClient_Hedge(t *testing.T) {
+	m := newHedgedClient(t, time.Second, &MultiClientOptions{
+		Idempotent:  func(string) bool { return true },
+		HedgeBudget: 1,
+	})
+	hedged, wins := metricValue(metricHedgedCalls), metricValue(metricHedgeWins)
+	start := time.Now()
+	var name string
+	if err := m.Call("Node.Name", &Args{}, &name); err != nil || name != "fast" {
+		t.Fatalf("expected the hedge to reply, got %s %v", name, err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Fatalf("hedged call took %s", d)
+	}
+	if metricValue(metricHedgedCalls) != hedged+1 || metricValue(metricHedgeWins) != wins+1 {
+		t.Fatalf("expected a hedge counted")
+	}
+}
+
+func Test_MultiClient_HedgeIdempotentOnly(t *testing.T) {
+	m := newHedgedClient(t, 100*time.Millisecond, &MultiClientOptions{HedgeBudget: 1})
+	var name string
+	if err := m.Call("Node.Name", &Args{}, &name); err != nil || name != "slow" {
+		t.Fatalf("expected no hedge of a non idempotent call, got %s %v", name, err)
+	}
+}
+
+func Test_MultiClient_HedgeBudget(t *testing.T) {
+	m := newHedgedClient(t, 50*time.Millisecond, &MultiClientOptions{
+		Idempotent:  func(string) bool { return true },
+		HedgeBudget: 0.25,
+	})
+	hedged := metricValue(metricHedgedCalls)
+	if seen := callNames(t, m, 8); seen["fast"] != 2 || seen["slow"] != 6 {
+		t.Fatalf("expected a quarter of the calls hedged, got %v", seen)
+	}
+	if n := metricValue(metricHedgedCalls) - hedged; n != 2 {
+		t.Fatalf("expected 2 hedges, got %d", n)
+	}
+}
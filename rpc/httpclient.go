@@ -0,0 +1,138 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/rpc"
+	"sync"
+)
+
+// httpReply is the outcome of a request posted by httpClientCodec.
+type httpReply struct {
+	seq    uint64
+	method string
+	body   []byte
+	err    error
+}
+
+// httpClientCodec sends each request in its own POST, so calls do not wait
+// for each other.
+type httpClientCodec struct {
+	url    string
+	client *http.Client
+
+	replies   chan *httpReply
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	jsonrpc1 bool // requests are posted with JSON-RPC 1.0
+
+	// temporary work space
+	resp clientResponse
+}
+
+// NewHTTPClient returns a new Client which posts JSON-RPC 2.0 requests to
+// url, as served by HTTPServer. http.DefaultClient is used when client is
+// nil.
+func NewHTTPClient(url string, client *http.Client) *Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	c := NewClientWithCodec(&httpClientCodec{
+		url:     url,
+		client:  client,
+		replies: make(chan *httpReply),
+		closed:  make(chan struct{}),
+	})
+	c.endpoint = url
+	return c
+}
+
+func (c *httpClientCodec) WriteRequest(r *rpc.Request, param interface{}) error {
+	encode := encodeRequest
+	if c.jsonrpc1 {
+		encode = encodeRequest1
+	}
+	buf, err := encode(r, param)
+	if err != nil {
+		return err
+	}
+	go func(seq uint64, method string) {
+		body, err := c.post(buf)
+		if seq == seqNotify {
+			return
+		}
+		select {
+		case c.replies <- &httpReply{seq: seq, method: method, body: body, err: err}:
+		case <-c.closed:
+		}
+	}(r.Seq, r.ServiceMethod)
+	return nil
+}
+
+func (c *httpClientCodec) post(buf []byte) ([]byte, error) {
+	resp, err := c.client.Post(c.url, "application/json", bytes.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return body, nil
+}
+
+func (c *httpClientCodec) ReadResponseHeader(r *rpc.Response) error {
+	var reply *httpReply
+	select {
+	case reply = <-c.replies:
+	case <-c.closed:
+		return io.EOF
+	}
+	r.Seq = reply.seq
+	r.ServiceMethod = reply.method
+	r.Error = ""
+	c.resp.reset()
+
+	// A failed POST fails its call only, unlike a broken connection.
+	if reply.err != nil {
+		r.Error = connError(reply.err).Error()
+		return nil
+	}
+	var err error
+	if c.jsonrpc1 {
+		err = c.resp.unmarshalJSONRPC1(reply.body)
+	} else {
+		err = json.Unmarshal(reply.body, &c.resp)
+	}
+	if err != nil {
+		r.Error = connError(err).Error()
+		return nil
+	}
+	if c.resp.Error != nil {
+		r.Error = c.resp.Error.Error()
+	}
+	return nil
+}
+
+func (c *httpClientCodec) ReadResponseBody(x interface{}) error {
+	return unmarshalResult(c.resp.Result, x)
+}
+
+func (c *httpClientCodec) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return nil
+}
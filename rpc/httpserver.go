@@ -8,11 +8,13 @@ package rpc
 import (
 	"errors"
 	"io"
+	"mime"
 	"net"
 	"net/http"
 	"net/rpc"
 	"strings"
 
+	"github.com/justoxh/go-toolkit/trace"
 	"github.com/rs/cors"
 )
 
@@ -23,18 +25,21 @@ var (
 
 // HTTPServer represents a HTTP RPC server
 type HTTPServer struct {
-	rpc *rpc.Server
+	rpc  *Server
+	rest bool    // serve the REST routes
+	sse  *sseHub // nil if the SSE endpoint is not served
 }
 
 // NewHTTPServer returns a new HttpServer and a http handler used by cors
 func NewHTTPServer(whitehosts []string, corsList []string) (*HTTPServer, *hostFilter) {
 	server := &HTTPServer{
-		rpc: &rpc.Server{},
+		rpc: NewServer(),
 	}
+	server.rpc.netrpc = new(rpc.Server)
 	// cors
 	c := cors.New(cors.Options{
 		AllowedOrigins: corsList,
-		AllowedMethods: []string{http.MethodPost, http.MethodConnect},
+		AllowedMethods: []string{http.MethodGet, http.MethodPost, http.MethodConnect},
 		AllowedHeaders: []string{"*"},
 		MaxAge:         600,
 	})
@@ -53,14 +58,56 @@ func NewHTTPServer(whitehosts []string, corsList []string) (*HTTPServer, *hostFi
 // Supports POST and CONNECT http method.
 // POST handles requests from the browser
 // CONNECT handles requests form other go rpc.Client
+//
+// A POST request takes its request ID from the X-Request-ID header, or gets
+// a new one which is sent back in the same header, and its trace context
+// from the traceparent header. Its Idempotency-Key header is the key of
+// the idempotent calls without one in their params.
+//
+// The API version of the calls is selected by a path prefix naming a
+// registered version, such as "/v2", or the X-API-Version header.
+//
+// With EnableREST, GET and POST requests at "/namespace/Method" of a
+// registered method are served as REST calls. With EnableSSE, requests at
+// the SSE endpoint open subscriptions.
 func (server *HTTPServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	path := req.URL.Path
+	version := req.Header.Get(VersionHeader)
+	if v, rest := server.rpc.pathVersion(path); v != "" {
+		version, path = v, rest
+	}
+	ctx := WithTransport(req.Context(), TransportHTTP, req.RemoteAddr)
+	req = req.WithContext(withResponseHeader(withVersion(ctx, version), w.Header()))
+
+	if server.sse != nil && path == server.sse.options.Path {
+		server.serveSSE(w, req)
+		return
+	}
+	if server.rest {
+		if serviceMethod, mtype := server.restMethod(path, version); mtype != nil {
+			server.serveREST(w, req, serviceMethod, mtype)
+			return
+		}
+	}
 	switch req.Method {
 	case http.MethodConnect:
 		server.rpc.ServeHTTP(w, req)
 	case http.MethodPost:
-		w.Header().Set("Content-Type", "application/json")
+		ctx := trace.FromHeader(req.Context(), req.Header)
+		if trace.RequestID(ctx) == "" {
+			ctx = trace.WithRequestID(ctx, trace.NewRequestID())
+		}
+		w.Header().Set(trace.RequestIDHeader, trace.RequestID(ctx))
+		ctx = withIdempotencyKey(ctx, req.Header.Get(IdempotencyKeyHeader))
+
 		conn := &httpReadWriteCloser{req.Body, w}
-		server.rpc.ServeRequest(NewJSONCodec(conn, server.rpc))
+		if isMsgpackContentType(req.Header.Get("Content-Type")) {
+			w.Header().Set("Content-Type", MsgpackContentType)
+			server.rpc.ServeRequestContext(ctx, NewMsgpackServerCodec(conn, server.rpc))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		server.rpc.ServeRequestContext(ctx, NewServerCodec(conn, server.rpc))
 	default:
 		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -68,11 +115,29 @@ func (server *HTTPServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
-// GetRPCServer return rpc server of the HTTPServer
-func (server *HTTPServer) GetRPCServer() *rpc.Server {
+// GetServer returns the rpc server of the HTTPServer
+func (server *HTTPServer) GetServer() *Server {
 	return server.rpc
 }
 
+// GetRPCServer returns the net/rpc server of the HTTPServer, whose services
+// are served when GetServer has none of the name. Its calls are served
+// without the limits, cache and idempotency of Server.
+//
+// Deprecated: register the services on GetServer.
+func (server *HTTPServer) GetRPCServer() *rpc.Server {
+	return server.rpc.netrpc
+}
+
+// isMsgpackContentType reports whether the request body is MessagePack encoded.
+func isMsgpackContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == MsgpackContentType || mediaType == "application/x-msgpack"
+}
+
 // httpReadWriteCloser wraps a io.Reader and io.Writer
 type httpReadWriteCloser struct {
 	io.Reader
@@ -6,9 +6,12 @@
 package rpc
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/rpc"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -63,3 +66,115 @@ func Test_HTTPServe(t *testing.T) {
 		t.Fatalf("HTTPServe test failed")
 	}
 }
+
+func Test_HTTPClient(t *testing.T) {
+	serve, _ := NewHTTPServer(nil, nil)
+	serve.GetServer().Register(new(Arith))
+	ts := httptest.NewServer(serve)
+	defer ts.Close()
+
+	client := NewHTTPClient(ts.URL, nil)
+	defer client.Close()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var reply Reply
+			if err := client.Call("Arith.Add", &Args{i, 1}, &reply); err != nil || reply.C != i+1 {
+				t.Errorf("bad reply %d: %v", reply.C, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	var reply Reply
+	if err := client.Call("Arith.Div", &Args{1, 0}, &reply); err == nil || ServerError(err).Message != "divide by zero" {
+		t.Fatalf("bad error %v", err)
+	}
+
+	// a failed POST fails its call, not the client
+	down := NewHTTPClient("http://127.0.0.1:1", nil)
+	defer down.Close()
+	if err := down.Call("Arith.Add", &Args{1, 1}, &reply); err == nil || ServerError(err).Code != errInternal.Code {
+		t.Fatalf("bad error %v", err)
+	}
+	if err := down.Call("Arith.Add", &Args{1, 1}, &reply); err == rpc.ErrShutdown {
+		t.Fatalf("client shut down")
+	}
+}
+
+func Test_HTTPServer_NetRPC(t *testing.T) {
+	serve, _ := NewHTTPServer(nil, nil)
+	serve.GetRPCServer().Register(new(Arith))
+	serve.GetServer().RegisterName("Node", &NameService{name: "node"})
+	ts := httptest.NewServer(serve)
+	defer ts.Close()
+
+	client := NewHTTPClient(ts.URL, nil)
+	defer client.Close()
+	var reply Reply
+	if err := client.Call("Arith.Add", &Args{1, 2}, &reply); err != nil || reply.C != 3 {
+		t.Fatalf("bad reply %d: %v", reply.C, err)
+	}
+	var name string
+	if err := client.Call("Node.Name", &Args{}, &name); err != nil || name != "node" {
+		t.Fatalf("bad name %q: %v", name, err)
+	}
+
+	// the calls of a batch are served by either server
+	body := `[{"jsonrpc":"2.0","method":"Arith.Add","id":1,"params":[{"A":1,"B":2}]},` +
+		`{"jsonrpc":"2.0","method":"Node.Name","id":2,"params":[{}]},` +
+		`{"jsonrpc":"2.0","method":"Other.Name","id":3,"params":[{}]}]`
+	resp, err := http.Post(ts.URL, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var replies []struct {
+		ID     int             `json:"id"`
+		Result json.RawMessage `json:"result"`
+		Error  *Error          `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&replies); err != nil || len(replies) != 3 {
+		t.Fatalf("bad replies %v: %v", replies, err)
+	}
+	for _, r := range replies {
+		switch {
+		case r.ID == 1 && string(r.Result) != `{"C":3}`,
+			r.ID == 2 && string(r.Result) != `"node"`,
+			r.ID == 3 && (r.Error == nil || r.Error.Code != errMethod.Code):
+			t.Fatalf("bad reply %d: %s %v", r.ID, r.Result, r.Error)
+		}
+	}
+}
+
+func Test_HTTPServer_NetRPCPanic(t *testing.T) {
+	serve, _ := NewHTTPServer(nil, nil)
+	serve.GetRPCServer().Register(new(Arith))
+	serve.GetRPCServer().RegisterName("transfer", TransferService{})
+	l := &entryLogger{}
+	serve.GetServer().SetAccessLog(l, nil)
+	ts := httptest.NewServer(serve)
+	defer ts.Close()
+	client := NewHTTPClient(ts.URL, nil)
+	defer client.Close()
+	panics := PanicCount()
+
+	var reply Reply
+	if err := client.Call("Arith.Error", &Args{1, 2}, &reply); errorCode(err) != errInternal.Code {
+		t.Fatalf("expected internal error, got %v", err)
+	}
+	if PanicCount() != panics+1 {
+		t.Fatalf("panic count not increased")
+	}
+	if entry := l.last(t); entry["method"] != "Arith.Error" || entry["code"] != errInternal.Code {
+		t.Fatalf("bad entry %v", entry)
+	}
+	if err := client.Call("Arith.Add", &Args{1, 2}, &reply); err != nil || reply.C != 3 {
+		t.Fatalf("bad reply %d: %v", reply.C, err)
+	}
+	var sent int64
+	if err := client.Call("transfer.Send", &TransferArgs{}, &sent); errorCode(err) != errParams.Code {
+		t.Fatalf("expected invalid params, got %v", err)
+	}
+}
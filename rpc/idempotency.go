@@ -0,0 +1,206 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"time"
+)
+
+// IdempotencyKeyHeader is the HTTP header carrying the idempotency key of a
+// call. It applies to every call of the request, the calls of a batch take
+// their key from their params instead.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// idempotencyKeyPrefix prefixes the keys of idempotent responses in redis.
+const idempotencyKeyPrefix = "rpc:idempotency:"
+
+// Idempotent is optionally implemented by a registered service to list the
+// methods, by name, which require an idempotency key. Such a method runs
+// once per key: the calls repeating the key get the response of the first
+// call, or fail with code -32005 while it is still executing.
+type Idempotent interface {
+	IdempotentMethods() []string
+}
+
+// IdempotencyParams is embedded in the argument of an idempotent method to
+// take the idempotency key from the reserved params member "idempotencyKey",
+// which wins over the header.
+//
+//	type SubmitArgs struct {
+//		rpc.IdempotencyParams
+//		Items []Item `json:"items"`
+//	}
+type IdempotencyParams struct {
+	IdempotencyKey string `json:"idempotencyKey,omitempty"`
+}
+
+func (p IdempotencyParams) idempotencyKey() string {
+	return p.IdempotencyKey
+}
+
+type idempotencyKeyer interface {
+	idempotencyKey() string
+}
+
+// IdempotencyRedis is the part of db/redis.Service storing the responses of
+// idempotent calls.
+type IdempotencyRedis interface {
+	SetNX(key string, value int64, ttl int) (bool, error)
+	Get(key string) ([]byte, error)
+	Set(key string, value []byte, ttl int64) error
+}
+
+// IdempotencyOptions idempotency store options config
+type IdempotencyOptions struct {
+	TTL     time.Duration // time the response of a call is kept
+	LockTTL time.Duration // time a call which never completes is reported in progress
+}
+
+func defaultIdempotencyOptions() *IdempotencyOptions {
+	return &IdempotencyOptions{
+		TTL:     24 * time.Hour,
+		LockTTL: 5 * time.Minute,
+	}
+}
+
+type idempotencyStore struct {
+	redis   IdempotencyRedis
+	options IdempotencyOptions
+}
+
+// SetIdempotencyStore sets the redis storing the responses of the idempotent
+// methods. The calls of these methods fail until it is set.
+func (server *Server) SetIdempotencyStore(redis IdempotencyRedis, options *IdempotencyOptions) {
+	def := defaultIdempotencyOptions()
+	if options == nil {
+		options = def
+	}
+	store := &idempotencyStore{redis: redis, options: *options}
+	if store.options.TTL <= 0 {
+		store.options.TTL = def.TTL
+	}
+	if store.options.LockTTL <= 0 {
+		store.options.LockTTL = def.LockTTL
+	}
+	server.idempotency = store
+}
+
+// idempotencyKeyKey is the context key of the idempotency key taken from
+// the transport.
+type idempotencyKeyKey struct{}
+
+func withIdempotencyKey(ctx context.Context, key string) context.Context {
+	if key == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, idempotencyKeyKey{}, key)
+}
+
+// withoutIdempotencyKey hides the idempotency key taken from the transport
+// from the calls of a batch, which take theirs from their params.
+func withoutIdempotencyKey(ctx context.Context) context.Context {
+	if ctx.Value(idempotencyKeyKey{}) == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, idempotencyKeyKey{}, "")
+}
+
+// idempotentResponse is the response of an idempotent call stored in redis.
+type idempotentResponse struct {
+	Params string          `json:"params"` // hash of the params
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// idempotentCall runs call once per idempotency key of an idempotent method,
+// and stores its response whatever its outcome, since the method ran. The
+// calls repeating the key get that response back, unless their params
+// differ.
+func (server *Server) idempotentCall(ctx context.Context, mtype *methodType, serviceMethod string, argv, replyv reflect.Value, call func() string) string {
+	if !mtype.idempotent {
+		return call()
+	}
+	var key string
+	if k, ok := argv.Interface().(idempotencyKeyer); ok {
+		key = k.idempotencyKey()
+	}
+	if key == "" {
+		key, _ = ctx.Value(idempotencyKeyKey{}).(string)
+	}
+	if key == "" {
+		return NewError(errParams.Code, "rpc: "+serviceMethod+" requires an idempotency key").Error()
+	}
+	store := server.idempotency
+	if store == nil {
+		return NewError(errInternal.Code, "rpc: no idempotency store for "+serviceMethod).Error()
+	}
+	params, err := paramsHash(argv.Interface())
+	if err != nil {
+		return NewError(errParams.Code, err.Error()).Error()
+	}
+
+	rkey := idempotencyKeyPrefix + serviceMethod + ":" + key
+	first, err := store.redis.SetNX(rkey, 0, int(ttlSeconds(store.options.LockTTL)))
+	if err != nil {
+		server.logError("rpc idempotency setnx", "method", serviceMethod, "error", err.Error())
+		return NewError(errInternal.Code, "rpc: idempotency store: "+err.Error()).Error()
+	}
+	if !first {
+		return server.idempotentReplay(store, serviceMethod, rkey, params, replyv)
+	}
+
+	errmsg := call()
+	resp := idempotentResponse{Params: params, Error: errmsg}
+	if errmsg == "" {
+		resp.Result, err = json.Marshal(replyv.Interface())
+	}
+	if err == nil {
+		var value []byte
+		if value, err = json.Marshal(&resp); err == nil {
+			err = store.redis.Set(rkey, value, ttlSeconds(store.options.TTL))
+		}
+	}
+	if err != nil {
+		server.logError("rpc idempotency set", "method", serviceMethod, "error", err.Error())
+	}
+	return errmsg
+}
+
+// idempotentReplay returns the stored response of the key into replyv.
+func (server *Server) idempotentReplay(store *idempotencyStore, serviceMethod, rkey, params string, replyv reflect.Value) string {
+	value, err := store.redis.Get(rkey)
+	if err != nil {
+		server.logError("rpc idempotency get", "method", serviceMethod, "error", err.Error())
+		return NewError(errInternal.Code, "rpc: idempotency store: "+err.Error()).Error()
+	}
+	// the lock is "0", missing keys are returned empty
+	if len(value) == 0 || string(value) == "0" {
+		return NewError(errInProgress.Code, "rpc: "+serviceMethod+" with this idempotency key is in progress").Error()
+	}
+	var resp idempotentResponse
+	if err := json.Unmarshal(value, &resp); err != nil {
+		return NewError(errInternal.Code, "rpc: idempotency store: "+err.Error()).Error()
+	}
+	if resp.Params != params {
+		return NewError(errParams.Code, "rpc: idempotency key of "+serviceMethod+" reused with other params").Error()
+	}
+	Metrics.Add(metricIdempotentReplays, 1)
+	if resp.Error != "" {
+		return resp.Error
+	}
+	if err := json.Unmarshal(resp.Result, replyv.Interface()); err != nil {
+		return NewError(errInternal.Code, "rpc: idempotency store: "+err.Error()).Error()
+	}
+	return ""
+}
+
+// ttlSeconds returns d in whole seconds, rounded up, for redis.
+func ttlSeconds(d time.Duration) int64 {
+	return int64((d + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,235 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// lockedRedis is an IdempotencyRedis in memory.
+type lockedRedis struct {
+	mutex sync.Mutex
+	m     map[string][]byte
+}
+
+func newLockedRedis() *lockedRedis {
+	return &lockedRedis{m: make(map[string][]byte)}
+}
+
+func (r *lockedRedis) SetNX(key string, value int64, ttl int) (bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.m[key]; ok {
+		return false, nil
+	}
+	r.m[key] = []byte("0")
+	return true, nil
+}
+
+func (r *lockedRedis) Get(key string) ([]byte, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.m[key], nil
+}
+
+func (r *lockedRedis) Set(key string, value []byte, ttl int64) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.m[key] = value
+	return nil
+}
+
+type PaymentArgs struct {
+	IdempotencyParams
+	Amount int `json:"amount"`
+}
+
+type PaymentService struct {
+	calls   int64
+	release chan struct{} // blocks Place when not nil
+}
+
+func (s *PaymentService) IdempotentMethods() []string {
+	return []string{"Place"}
+}
+
+func (s *PaymentService) Place(args *PaymentArgs, reply *int64) error {
+	if s.release != nil {
+		<-s.release
+	}
+	n := atomic.AddInt64(&s.calls, 1)
+	if args.Amount <= 0 {
+		return errors.New("bad amount")
+	}
+	*reply = n
+	return nil
+}
+
+func newPaymentServer(t *testing.T) (*Server, *PaymentService) {
+	server := NewServer()
+	svc := &PaymentService{}
+	if err := server.RegisterName("payment", svc); err != nil {
+		t.Fatal(err)
+	}
+	server.SetIdempotencyStore(newLockedRedis(), nil)
+	return server, svc
+}
+
+func Test_IdempotencyHeader(t *testing.T) {
+	server, svc := newPaymentServer(t)
+	ts := httptest.NewServer(&HTTPServer{rpc: server})
+	defer ts.Close()
+
+	post := func(key string) string {
+		body := `{"jsonrpc":"2.0","id":1,"method":"payment.Place","params":[{"amount":5}]}`
+		req, _ := http.NewRequest(http.MethodPost, ts.URL, strings.NewReader(body))
+		req.Header.Set(IdempotencyKeyHeader, key)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var buf bytes.Buffer
+		buf.ReadFrom(resp.Body)
+		return strings.TrimSpace(buf.String())
+	}
+	replays := metricValue(metricIdempotentReplays)
+	first := post("a")
+	if again := post("a"); again != first || !strings.Contains(first, `"result":1`) {
+		t.Fatalf("expected the same result, got %s and %s", first, again)
+	}
+	if metricValue(metricIdempotentReplays) != replays+1 {
+		t.Fatalf("replay not counted")
+	}
+	if other := post("b"); !strings.Contains(other, `"result":2`) {
+		t.Fatalf("expected a new call, got %s", other)
+	}
+	if calls := atomic.LoadInt64(&svc.calls); calls != 2 {
+		t.Fatalf("expected 2 calls, got %d", calls)
+	}
+}
+
+func Test_IdempotencyHeaderBatch(t *testing.T) {
+	server, svc := newPaymentServer(t)
+	ts := httptest.NewServer(&HTTPServer{rpc: server})
+	defer ts.Close()
+
+	// the header key does not apply to the calls of a batch, which would
+	// all share it
+	body := `[{"jsonrpc":"2.0","id":1,"method":"payment.Place","params":[{"amount":5}]},` +
+		`{"jsonrpc":"2.0","id":2,"method":"payment.Place","params":[{"amount":7}]},` +
+		`{"jsonrpc":"2.0","id":3,"method":"payment.Place","params":[{"idempotencyKey":"c","amount":9}]}]`
+	req, _ := http.NewRequest(http.MethodPost, ts.URL, strings.NewReader(body))
+	req.Header.Set(IdempotencyKeyHeader, "a")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var replies []struct {
+		ID     int    `json:"id"`
+		Result int64  `json:"result"`
+		Error  *Error `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&replies); err != nil || len(replies) != 3 {
+		t.Fatalf("bad replies %v: %v", replies, err)
+	}
+	for _, r := range replies {
+		if r.ID != 3 && (r.Error == nil || r.Error.Code != errParams.Code) {
+			t.Fatalf("expected a missing key error for %d, got %v", r.ID, r.Error)
+		}
+		if r.ID == 3 && (r.Error != nil || r.Result != 1) {
+			t.Fatalf("bad reply %v", r)
+		}
+	}
+	if calls := atomic.LoadInt64(&svc.calls); calls != 1 {
+		t.Fatalf("expected 1 call, got %d", calls)
+	}
+}
+
+func Test_IdempotencyParams(t *testing.T) {
+	server, svc := newPaymentServer(t)
+	cli, srv := net.Pipe()
+	go server.ServeCodec(NewServerCodec(srv, server))
+	client := NewClient(cli)
+	defer client.Close()
+
+	var reply int64
+	if err := client.Call("payment.Place", &PaymentArgs{Amount: 5}, &reply); errorCode(err) != errParams.Code {
+		t.Fatalf("expected idempotency key required, got %v", err)
+	}
+	args := &PaymentArgs{IdempotencyParams{"k"}, 5}
+	for i := 0; i < 2; i++ {
+		if err := client.Call("payment.Place", args, &reply); err != nil || reply != 1 {
+			t.Fatalf("expected 1, got %d %v", reply, err)
+		}
+	}
+	if err := client.Call("payment.Place", &PaymentArgs{IdempotencyParams{"k"}, 6}, &reply); errorCode(err) != errParams.Code || !strings.Contains(err.Error(), "other params") {
+		t.Fatalf("expected key reused error, got %v", err)
+	}
+
+	// errors are stored as well
+	bad := &PaymentArgs{IdempotencyParams{"bad"}, 0}
+	for i := 0; i < 2; i++ {
+		if err := client.Call("payment.Place", bad, &reply); err == nil || ServerError(err).Message != "bad amount" {
+			t.Fatalf("expected bad amount, got %v", err)
+		}
+	}
+	if calls := atomic.LoadInt64(&svc.calls); calls != 2 {
+		t.Fatalf("expected 2 calls, got %d", calls)
+	}
+}
+
+func Test_IdempotencyInProgress(t *testing.T) {
+	server, svc := newPaymentServer(t)
+	svc.release = make(chan struct{})
+	cli, srv := net.Pipe()
+	go server.ServeCodec(NewServerCodec(srv, server))
+	client := NewClient(cli)
+	defer client.Close()
+
+	args := &PaymentArgs{IdempotencyParams{"k"}, 5}
+	var first, reply int64
+	call := client.Go("payment.Place", args, &first, nil)
+	time.Sleep(50 * time.Millisecond)
+	if err := client.Call("payment.Place", args, &reply); errorCode(err) != errInProgress.Code {
+		t.Fatalf("expected call in progress, got %v", err)
+	}
+	close(svc.release)
+	if (<-call.Done).Error != nil || first != 1 {
+		t.Fatalf("expected 1, got %d %v", first, call.Error)
+	}
+	if err := client.Call("payment.Place", args, &reply); err != nil || reply != 1 {
+		t.Fatalf("expected 1, got %d %v", reply, err)
+	}
+}
+
+func Test_IdempotencyRegister(t *testing.T) {
+	server := NewServer()
+	if err := server.Register(BadIdempotentService{}); err == nil || !strings.Contains(err.Error(), "Missing") {
+		t.Fatalf("expected error for unknown annotated method, got %v", err)
+	}
+}
+
+type BadIdempotentService struct{}
+
+func (BadIdempotentService) IdempotentMethods() []string {
+	return []string{"Missing"}
+}
+
+func (BadIdempotentService) Place(args *PaymentArgs, reply *int64) error {
+	return nil
+}
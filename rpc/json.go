@@ -9,6 +9,7 @@ import (
 	"errors"
 	"io"
 	"net/rpc"
+	"reflect"
 	"sync"
 )
 
@@ -20,7 +21,7 @@ type jsonCodec struct {
 	dec *json.Decoder // for reading JSON values
 	enc *json.Encoder // for writing JSON values
 	c   io.Closer
-	srv *rpc.Server
+	srv *Server
 
 	// temporary work space
 	req jsonRequest
@@ -35,20 +36,36 @@ type jsonCodec struct {
 	encmutex sync.Mutex // protects enc
 	seq      uint64
 	pending  map[uint64]*json.RawMessage
+	jsonrpc1 map[uint64]bool   // seq of the JSON-RPC 1.0 requests
+	warnings map[uint64]string // warnings of the responses, by seq
 }
 
-// NewJSONCodec returns a new rpc.ServerCodec using JSON-RPC on conn.
+// NewJSONCodec returns a new rpc.ServerCodec using JSON-RPC on conn, for
+// the net/rpc server srv, or rpc.DefaultServer if nil. NewServerCodec
+// returns the codec for a Server.
 func NewJSONCodec(conn io.ReadWriteCloser, srv *rpc.Server) rpc.ServerCodec {
 	if srv == nil {
 		srv = rpc.DefaultServer
 	}
+	return newJSONCodec(conn, newNetRPCServer(srv))
+}
+
+// NewServerCodec returns a new rpc.ServerCodec using JSON-RPC on conn, for
+// the Server srv.
+func NewServerCodec(conn io.ReadWriteCloser, srv *Server) rpc.ServerCodec {
 	srv.Register(JSONRPC2{})
+	return newJSONCodec(conn, srv)
+}
+
+func newJSONCodec(conn io.ReadWriteCloser, srv *Server) *jsonCodec {
 	return &jsonCodec{
-		dec:     json.NewDecoder(conn),
-		enc:     json.NewEncoder(conn),
-		c:       conn,
-		srv:     srv,
-		pending: make(map[uint64]*json.RawMessage),
+		dec:      json.NewDecoder(conn),
+		enc:      json.NewEncoder(conn),
+		c:        conn,
+		srv:      srv,
+		pending:  make(map[uint64]*json.RawMessage),
+		jsonrpc1: make(map[uint64]bool),
+		warnings: make(map[uint64]string),
 	}
 }
 
@@ -57,6 +74,7 @@ type jsonRequest struct {
 	Method  string           `json:"method"`
 	Params  *json.RawMessage `json:"params"`
 	ID      *json.RawMessage `json:"id"`
+	Meta    *callMeta        `json:"meta"`
 }
 
 func (r *jsonRequest) UnmarshalJSON(raw []byte) error {
@@ -75,7 +93,16 @@ func (r *jsonRequest) UnmarshalJSON(raw []byte) error {
 	}
 	_, okID := reqMap["id"]
 	_, okParams := reqMap["params"]
-	if len(reqMap) == 3 && !(okID || okParams) || len(reqMap) == 4 && !(okID && okParams) || len(reqMap) > 4 {
+	_, okMeta := reqMap["meta"]
+	n := len(reqMap)
+	if okMeta {
+		// "meta" is an extension member, it must be an object.
+		if reqMap["meta"] == nil || r.Meta == nil {
+			return errors.New("bad request")
+		}
+		n--
+	}
+	if n == 3 && !(okID || okParams) || n == 4 && !(okID && okParams) || n > 4 {
 		return errors.New("bad request")
 	}
 	if r.Version != "2.0" {
@@ -87,7 +114,8 @@ func (r *jsonRequest) UnmarshalJSON(raw []byte) error {
 		}
 	}
 	if okID && r.ID == nil {
-		r.ID = nil
+		// a request with a null id, unlike a notification, gets a response
+		r.ID = &null
 	}
 	if okID {
 		if len(*r.ID) == 0 {
@@ -107,6 +135,7 @@ func (r *jsonRequest) reset() {
 	r.Method = ""
 	r.Params = nil
 	r.ID = nil
+	r.Meta = nil
 }
 
 type jsonResponse struct {
@@ -114,6 +143,7 @@ type jsonResponse struct {
 	ID      *json.RawMessage `json:"id"`
 	Result  interface{}      `json:"result,omitempty"`
 	Error   interface{}      `json:"error,omitempty"`
+	Warning string           `json:"warning,omitempty"`
 }
 
 func (c *jsonCodec) ReadRequestHeader(r *rpc.Request) error {
@@ -130,7 +160,8 @@ func (c *jsonCodec) ReadRequestHeader(r *rpc.Request) error {
 		c.req.Method = "JSONRPC2.Batch"
 		c.req.Params = &raw
 		c.req.ID = &null
-	} else if err := json.Unmarshal(raw, &c.req); err != nil {
+		c.req.Meta = nil
+	} else if err := c.unmarshalRequest(raw); err != nil {
 		if err.Error() == "bad request" {
 			c.encmutex.Lock()
 			c.enc.Encode(jsonResponse{Version: jsonrpcVersion, ID: &null, Error: errRequest})
@@ -147,6 +178,9 @@ func (c *jsonCodec) ReadRequestHeader(r *rpc.Request) error {
 	c.mutex.Lock()
 	c.seq++
 	c.pending[c.seq] = c.req.ID
+	if c.req.Version == jsonrpc1Version {
+		c.jsonrpc1[c.seq] = true
+	}
 	c.req.ID = nil
 	r.Seq = c.seq
 	c.mutex.Unlock()
@@ -154,6 +188,17 @@ func (c *jsonCodec) ReadRequestHeader(r *rpc.Request) error {
 	return nil
 }
 
+func (c *jsonCodec) unmarshalRequest(raw []byte) error {
+	if c.srv.jsonrpc1 {
+		return c.req.unmarshalJSONRPC1(raw)
+	}
+	return json.Unmarshal(raw, &c.req)
+}
+
+func (c *jsonCodec) requestMeta() *callMeta {
+	return c.req.Meta
+}
+
 func (c *jsonCodec) ReadRequestBody(x interface{}) error {
 	if x == nil {
 		return nil
@@ -178,6 +223,10 @@ func (c *jsonCodec) ReadRequestBody(x interface{}) error {
 		if len(arg.reqs) == 0 {
 			return errRequest
 		}
+	} else if c.req.Version == jsonrpc1Version && isPositional(reflect.TypeOf(x)) {
+		if err := json.Unmarshal(*c.req.Params, x); err != nil {
+			return NewError(errParams.Code, err.Error())
+		}
 	} else if err := json.Unmarshal(*c.req.Params, &params); err != nil {
 		return NewError(errParams.Code, err.Error())
 	}
@@ -195,6 +244,10 @@ func (c *jsonCodec) WriteResponse(r *rpc.Response, x interface{}) error {
 		return errors.New("invalid sequence number in response")
 	}
 	delete(c.pending, r.Seq)
+	jsonrpc1 := c.jsonrpc1[r.Seq]
+	delete(c.jsonrpc1, r.Seq)
+	warning := c.warnings[r.Seq]
+	delete(c.warnings, r.Seq)
 	c.mutex.Unlock()
 
 	if replies, ok := x.(*[]*json.RawMessage); r.ServiceMethod == "JSONRPC2.Batch" && ok {
@@ -207,10 +260,10 @@ func (c *jsonCodec) WriteResponse(r *rpc.Response, x interface{}) error {
 	}
 
 	if b == nil {
-		// Invalid request so no id. Use JSON null.
-		b = &null
+		// Notification, the client expects no reply.
+		return nil
 	}
-	resp := jsonResponse{Version: jsonrpcVersion, ID: b}
+	resp := jsonResponse{Version: jsonrpcVersion, ID: b, Warning: warning}
 	if r.Error == "" {
 		if x == nil {
 			resp.Result = &null
@@ -226,9 +279,19 @@ func (c *jsonCodec) WriteResponse(r *rpc.Response, x interface{}) error {
 	}
 	c.encmutex.Lock()
 	defer c.encmutex.Unlock()
+	if jsonrpc1 {
+		return c.enc.Encode(jsonResponse1{Result: resp.Result, Error: resp.Error, ID: b})
+	}
 	return c.enc.Encode(resp)
 }
 
+// warn adds warning to the response of seq.
+func (c *jsonCodec) warn(seq uint64, warning string) {
+	c.mutex.Lock()
+	c.warnings[seq] = warning
+	c.mutex.Unlock()
+}
+
 func (c *jsonCodec) Close() error {
 	return c.c.Close()
 }
@@ -236,6 +299,8 @@ func (c *jsonCodec) Close() error {
 // ServeConn runs the JSON-RPC server on a single connection.
 // ServeConn blocks, serving the connection until the client hangs up.
 // The caller typically invokes ServeConn with go-routine.
+// It serves the services of rpc.DefaultServer.
 func ServeConn(conn io.ReadWriteCloser) {
-	rpc.ServeCodec(NewJSONCodec(conn, nil))
+	srv := newNetRPCServer(rpc.DefaultServer)
+	srv.ServeCodec(newJSONCodec(conn, srv))
 }
@@ -135,6 +135,28 @@ func Test_Server(t *testing.T) {
 	}
 }
 
+func Test_ServerBatch(t *testing.T) {
+	cli, srv := net.Pipe()
+	defer cli.Close()
+	go ServeConn(srv)
+	dec := json.NewDecoder(cli)
+
+	fmt.Fprintf(cli, `[{"jsonrpc":"2.0","method":"Arith.Add","id":1,"params":[{"A":1,"B":2}]},`+
+		`{"jsonrpc":"2.0","method":"Arith.Mul","id":2,"params":[{"A":2,"B":3}]}]`)
+	var replies []ArithAddResp
+	if err := dec.Decode(&replies); err != nil {
+		t.Fatalf("Decode: %s", err)
+	}
+	if len(replies) != 2 {
+		t.Fatalf("expected 2 replies, got %v", replies)
+	}
+	for _, reply := range replies {
+		if reply.Error != nil || reply.Result.C != map[float64]int{1: 3, 2: 6}[reply.ID.(float64)] {
+			t.Fatalf("bad reply %v", reply)
+		}
+	}
+}
+
 func Test_MalformedInput(t *testing.T) {
 	cli, srv := net.Pipe()
 	go func() {
@@ -0,0 +1,232 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package rpc
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/rpc"
+	"reflect"
+)
+
+// JSON-RPC 1.0 is still spoken by some legacy wallets and miners. Its
+// requests have no "jsonrpc" member, or "jsonrpc":"1.0", and take their
+// params as an array. Its responses carry both "result" and "error", one of
+// them null:
+//
+//	--> {"method":"wallet.GetBalance","params":[{"Account":"main"}],"id":1}
+//	<-- {"result":12.5,"error":null,"id":1}
+//
+// A request with a null id is a notification. As in JSON-RPC 2.0 the params
+// array holds the argument of the method, except for a method taking a
+// slice or an array, which receives the params array itself, so that the
+// positional params of legacy clients can be served. There is no batch in
+// JSON-RPC 1.0.
+
+const jsonrpc1Version = "1.0"
+
+// EnableJSONRPC1 makes the JSON codecs of the server accept JSON-RPC 1.0
+// requests along with JSON-RPC 2.0 ones, and reply to each in the dialect
+// of its request. It must be called before serving.
+func (server *Server) EnableJSONRPC1() {
+	server.jsonrpc1 = true
+}
+
+// unmarshalJSONRPC1 is UnmarshalJSON accepting JSON-RPC 1.0 requests too,
+// whose Version is set to "1.0".
+func (r *jsonRequest) unmarshalJSONRPC1(raw []byte) error {
+	var reqMap map[string]*json.RawMessage
+	if err := json.Unmarshal(raw, &reqMap); err != nil {
+		return errors.New("bad request")
+	}
+	var version string
+	if v := reqMap["jsonrpc"]; v != nil {
+		json.Unmarshal(*v, &version)
+	}
+	if version == jsonrpcVersion {
+		return r.UnmarshalJSON(raw)
+	}
+	if _, ok := reqMap["jsonrpc"]; ok && version != jsonrpc1Version {
+		return errors.New("bad request")
+	}
+
+	r.reset()
+	type req *jsonRequest
+	if err := json.Unmarshal(raw, req(r)); err != nil {
+		return errors.New("bad request")
+	}
+	for name := range reqMap {
+		switch name {
+		case "jsonrpc", "method", "params", "id", "meta":
+		default:
+			return errors.New("bad request")
+		}
+	}
+	if reqMap["method"] == nil {
+		return errors.New("bad request")
+	}
+	if _, ok := reqMap["meta"]; ok && r.Meta == nil {
+		return errors.New("bad request")
+	}
+	if r.Params != nil && (len(*r.Params) == 0 || (*r.Params)[0] != '[') {
+		return errors.New("bad request")
+	}
+	if r.ID != nil {
+		if len(*r.ID) == 0 {
+			return errors.New("bad request")
+		}
+		switch []byte(*r.ID)[0] {
+		case 't', 'f', '{', '[':
+			return errors.New("bad request")
+		}
+	}
+	r.Version = jsonrpc1Version
+	return nil
+}
+
+// jsonResponse1 is a JSON-RPC 1.0 response object.
+type jsonResponse1 struct {
+	Result interface{}      `json:"result"`
+	Error  interface{}      `json:"error"`
+	ID     *json.RawMessage `json:"id"`
+}
+
+// isPositional reports whether arguments of type t are given the whole
+// params array of a JSON-RPC 1.0 request.
+func isPositional(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t.Elem().Kind() != reflect.Uint8
+}
+
+// clientRequest1 is a JSON-RPC 1.0 request object. The request ID and the
+// trace context are not sent, legacy servers would not expect them.
+type clientRequest1 struct {
+	Method string      `json:"method"`
+	Params interface{} `json:"params"`
+	ID     *uint64     `json:"id"`
+}
+
+// encodeRequest1 returns the JSON-RPC 1.0 request object of r.
+func encodeRequest1(r *rpc.Request, param interface{}) ([]byte, error) {
+	_, param = unwrapParam(param)
+	param, err := normalizeParam(param)
+	if err != nil {
+		return nil, err
+	}
+
+	req := clientRequest1{Method: r.ServiceMethod, Params: []interface{}{}}
+	if r.Seq != seqNotify {
+		req.ID = &r.Seq
+	}
+	if param != nil {
+		if isPositional(reflect.TypeOf(param)) {
+			req.Params = param
+		} else {
+			req.Params = []interface{}{param}
+		}
+	}
+	buf, err := json.Marshal(&req)
+	if err != nil {
+		return nil, NewError(errInternal.Code, err.Error())
+	}
+	return buf, nil
+}
+
+// unmarshalJSONRPC1 is UnmarshalJSON accepting JSON-RPC 1.0 responses too.
+// An error which is not an error object is reported with code -32000.
+func (r *clientResponse) unmarshalJSONRPC1(raw []byte) error {
+	var respMap map[string]*json.RawMessage
+	if err := json.Unmarshal(raw, &respMap); err != nil {
+		return errors.New("bad response: " + string(raw))
+	}
+	var version string
+	if v := respMap["jsonrpc"]; v != nil {
+		json.Unmarshal(*v, &version)
+	}
+	if version == jsonrpcVersion {
+		return r.UnmarshalJSON(raw)
+	}
+
+	r.reset()
+	_, okVer := respMap["jsonrpc"]
+	_, okID := respMap["id"]
+	result, okRes := respMap["result"]
+	e, okErr := respMap["error"]
+	if okVer && version != jsonrpc1Version || !okID || !(okRes || okErr) || len(respMap) > 4 || !okVer && len(respMap) > 3 {
+		return errors.New("bad response: " + string(raw))
+	}
+	if id := respMap["id"]; id != nil {
+		if err := json.Unmarshal(*id, &r.ID); err != nil {
+			return errors.New("bad response: " + string(raw))
+		}
+	}
+	if e != nil {
+		r.Error = jsonrpc1Error(*e)
+	} else if result != nil {
+		r.Result = result
+	} else {
+		r.Result = &null
+	}
+	if r.ID == nil && r.Error == nil {
+		return errors.New("bad response: " + string(raw))
+	}
+	return nil
+}
+
+// jsonrpc1Error returns the Error of the error member of a JSON-RPC 1.0
+// response, which may be any value.
+func jsonrpc1Error(raw json.RawMessage) *Error {
+	var oe map[string]*json.RawMessage
+	if json.Unmarshal(raw, &oe) == nil && oe["code"] != nil && oe["message"] != nil {
+		var e Error
+		if json.Unmarshal(raw, &e) == nil {
+			return &e
+		}
+	}
+	var message string
+	if json.Unmarshal(raw, &message) != nil {
+		message = string(raw)
+	}
+	return NewError(errServer.Code, message)
+}
+
+// NewJSONRPC1ClientCodec returns a new rpc.ClientCodec using JSON-RPC 1.0
+// on conn. It reads JSON-RPC 2.0 responses too.
+func NewJSONRPC1ClientCodec(conn io.ReadWriteCloser) rpc.ClientCodec {
+	c := NewClientCodec(conn).(*clientCodec)
+	c.jsonrpc1 = true
+	return c
+}
+
+// NewJSONRPC1Client returns a new Client calling with JSON-RPC 1.0 the
+// services at the other end of the connection.
+func NewJSONRPC1Client(conn io.ReadWriteCloser) *Client {
+	return NewClientWithCodec(NewJSONRPC1ClientCodec(conn))
+}
+
+// DialJSONRPC1 connects to a JSON-RPC 1.0 server at the specified network
+// address.
+func DialJSONRPC1(network, address string) (*Client, error) {
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	client := NewJSONRPC1Client(conn)
+	client.endpoint = address
+	return client, nil
+}
+
+// NewJSONRPC1HTTPClient is NewHTTPClient posting JSON-RPC 1.0 requests.
+func NewJSONRPC1HTTPClient(url string, client *http.Client) *Client {
+	c := NewHTTPClient(url, client)
+	c.codec.(*httpClientCodec).jsonrpc1 = true
+	return c
+}
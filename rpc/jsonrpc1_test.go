@@ -0,0 +1,156 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package rpc
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"net/rpc"
+	"strings"
+	"testing"
+)
+
+type LegacyService struct{}
+
+func (LegacyService) Join(args []string, reply *string) error {
+	*reply = strings.Join(args, ",")
+	return nil
+}
+
+func newJSONRPC1Server() *Server {
+	server := NewServer()
+	server.Register(new(Arith))
+	server.RegisterName("legacy", LegacyService{})
+	server.EnableJSONRPC1()
+	return server
+}
+
+func Test_JSONRPC1Server(t *testing.T) {
+	cli, srv := net.Pipe()
+	defer cli.Close()
+	server := newJSONRPC1Server()
+	go server.ServeCodec(NewServerCodec(srv, server))
+	r := bufio.NewReader(cli)
+
+	exchange := func(request, response string) {
+		t.Helper()
+		if _, err := cli.Write([]byte(request + "\n")); err != nil {
+			t.Fatal(err)
+		}
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.TrimSpace(line) != response {
+			t.Fatalf("%s: expected %s, got %s", request, response, line)
+		}
+	}
+
+	exchange(`{"method":"Arith.Add","params":[{"A":1,"B":2}],"id":1}`, `{"result":{"C":3},"error":null,"id":1}`)
+	exchange(`{"jsonrpc":"1.0","method":"Arith.Div","params":[{"A":1,"B":0}],"id":"a"}`,
+		`{"result":null,"error":{"code":-32000,"message":"divide by zero"},"id":"a"}`)
+	exchange(`{"method":"legacy.Join","params":["a","b"],"id":2}`, `{"result":"a,b","error":null,"id":2}`)
+	// a notification is not answered
+	cli.Write([]byte(`{"method":"Arith.Add","params":[{"A":1,"B":2}],"id":null}` + "\n"))
+	exchange(`{"jsonrpc":"2.0","method":"Arith.Add","params":[{"A":2,"B":2}],"id":3}`, `{"jsonrpc":"2.0","id":3,"result":{"C":4}}`)
+	exchange(`{"method":"Arith.Add","params":{"A":1},"id":4}`, `{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"Invalid request"}}`)
+}
+
+func Test_JSONRPC1Disabled(t *testing.T) {
+	cli, srv := net.Pipe()
+	defer cli.Close()
+	server := NewServer()
+	server.Register(new(Arith))
+	go server.ServeCodec(NewServerCodec(srv, server))
+
+	cli.Write([]byte(`{"method":"Arith.Add","params":[{"A":1,"B":2}],"id":1}` + "\n"))
+	var resp struct {
+		Error *Error `json:"error"`
+	}
+	if err := json.NewDecoder(cli).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Error == nil || resp.Error.Code != errRequest.Code {
+		t.Fatalf("expected invalid request, got %v", resp.Error)
+	}
+}
+
+func Test_JSONRPC1Client(t *testing.T) {
+	cli, srv := net.Pipe()
+	server := newJSONRPC1Server()
+	go server.ServeCodec(NewServerCodec(srv, server))
+	client := NewJSONRPC1Client(cli)
+	defer client.Close()
+
+	var reply Reply
+	if err := client.Call("Arith.Add", &Args{1, 2}, &reply); err != nil || reply.C != 3 {
+		t.Fatalf("bad reply %d: %v", reply.C, err)
+	}
+	if err := client.Call("Arith.Div", &Args{1, 0}, &reply); err == nil || ServerError(err).Message != "divide by zero" {
+		t.Fatalf("bad error %v", err)
+	}
+	var joined string
+	if err := client.Call("legacy.Join", []string{"a", "b"}, &joined); err != nil || joined != "a,b" {
+		t.Fatalf("bad reply %q: %v", joined, err)
+	}
+
+	// the requests of a legacy server
+	serve, _ := NewHTTPServer(nil, nil)
+	serve.GetServer().Register(new(Arith))
+	serve.GetServer().EnableJSONRPC1()
+	ts := httptest.NewServer(serve)
+	defer ts.Close()
+	httpClient := NewJSONRPC1HTTPClient(ts.URL, nil)
+	defer httpClient.Close()
+	if err := httpClient.Call("Arith.Mul", &Args{3, 4}, &reply); err != nil || reply.C != 12 {
+		t.Fatalf("bad reply %d: %v", reply.C, err)
+	}
+}
+
+func Test_JSONRPC1Response(t *testing.T) {
+	req, err := encodeRequest1(&rpc.Request{ServiceMethod: "getwork", Seq: 7}, nil)
+	if err != nil || string(req) != `{"method":"getwork","params":[],"id":7}` {
+		t.Fatalf("bad request %s: %v", req, err)
+	}
+	req, _ = encodeRequest1(&rpc.Request{ServiceMethod: "notify", Seq: seqNotify}, &Args{1, 2})
+	if string(req) != `{"method":"notify","params":[{"A":1,"B":2}],"id":null}` {
+		t.Fatalf("bad notification %s", req)
+	}
+
+	for _, test := range []struct {
+		raw     string
+		ok      bool
+		result  string
+		message string
+	}{
+		{`{"result":1,"error":null,"id":1}`, true, "1", ""},
+		{`{"result":null,"error":null,"id":1}`, true, "null", ""},
+		{`{"result":null,"error":"boom","id":1}`, true, "", "boom"},
+		{`{"result":null,"error":{"code":-5,"message":"no wallet"},"id":1}`, true, "", "no wallet"},
+		{`{"jsonrpc":"2.0","result":1,"id":1}`, true, "1", ""},
+		{`{"jsonrpc":"2.0","result":1,"error":null,"id":1}`, false, "", ""},
+		{`{"result":1,"error":null}`, false, "", ""},
+		{`{"result":1,"error":null,"id":1,"extra":0}`, false, "", ""},
+	} {
+		var resp clientResponse
+		err := resp.unmarshalJSONRPC1([]byte(test.raw))
+		if (err == nil) != test.ok {
+			t.Fatalf("%s: unexpected error %v", test.raw, err)
+		}
+		if !test.ok {
+			continue
+		}
+		if test.message != "" {
+			if resp.Error == nil || resp.Error.Message != test.message {
+				t.Fatalf("%s: bad error %v", test.raw, resp.Error)
+			}
+		} else if resp.Error != nil || string(*resp.Result) != test.result {
+			t.Fatalf("%s: bad result %v", test.raw, resp.Error)
+		}
+	}
+}
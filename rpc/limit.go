@@ -0,0 +1,151 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package rpc
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+// MethodLimit limits the calls of a namespace or of a method. It is usually
+// loaded with the application config, such as in TOML:
+//
+//	[[limits]]
+//	name = "report"
+//	timeout = "5s"
+//	maxconcurrent = 4
+//
+//	[[limits]]
+//	name = "order.Submit"
+//	timeout = "2s"
+//	maxconcurrent = 100
+//	queue = true
+type MethodLimit struct {
+	// Name is a namespace, or a method as "namespace.Method".
+	Name string
+	// Timeout is the maximum time of a call, including its wait in the
+	// queue. No limit if 0.
+	Timeout time.Duration
+	// MaxConcurrent is the maximum number of calls executing at once. The
+	// calls of a namespace are counted together. No limit if 0.
+	MaxConcurrent int
+	// Queue makes the calls over MaxConcurrent wait for their turn, until
+	// their timeout, rather than being rejected at once.
+	Queue bool
+}
+
+// limiter enforces a MethodLimit.
+type limiter struct {
+	MethodLimit
+	slots chan struct{} // nil if the concurrency is not limited
+}
+
+// SetLimits replaces the limits of the calls served by the server, whatever
+// the transport. The limit of a method applies instead of the limit of its
+// namespace, and the calls of a batch are limited one by one.
+//
+// A call rejected for concurrency fails with code -32003, a call which does
+// not complete in time fails with code -32004. A method which takes a
+// context.Context sees it done at its timeout.
+func (server *Server) SetLimits(limits []MethodLimit) error {
+	limiters := make(map[string]*limiter, len(limits))
+	for _, limit := range limits {
+		if limit.Name == "" || strings.HasPrefix(limit.Name, ".") || strings.HasSuffix(limit.Name, ".") {
+			return errors.New("rpc: invalid limit name " + limit.Name)
+		}
+		if _, dup := limiters[limit.Name]; dup {
+			return errors.New("rpc: limit already defined: " + limit.Name)
+		}
+		if limit.Timeout < 0 || limit.MaxConcurrent < 0 {
+			return errors.New("rpc: negative limit of " + limit.Name)
+		}
+		l := &limiter{MethodLimit: limit}
+		if limit.MaxConcurrent > 0 {
+			l.slots = make(chan struct{}, limit.MaxConcurrent)
+		}
+		limiters[limit.Name] = l
+	}
+
+	server.limitsMutex.Lock()
+	server.limits = limiters
+	server.limitsMutex.Unlock()
+	return nil
+}
+
+// limiter returns the limiter of serviceMethod, nil if it is not limited.
+func (server *Server) limiter(serviceMethod string) *limiter {
+	server.limitsMutex.RLock()
+	defer server.limitsMutex.RUnlock()
+	if l, ok := server.limits[serviceMethod]; ok {
+		return l
+	}
+	if l, ok := server.limits[unversioned(serviceMethod)]; ok {
+		return l
+	}
+	if dot := strings.LastIndex(serviceMethod, "."); dot > 0 {
+		return server.limits[serviceMethod[:dot]]
+	}
+	return nil
+}
+
+// limitedCall runs call within the limits of serviceMethod. A call which
+// times out keeps its slot until it returns, its result is dropped, and
+// running is true since call may still use the params and the reply.
+func (server *Server) limitedCall(ctx context.Context, serviceMethod string, call func(ctx context.Context) string) (errmsg string, running bool) {
+	l := server.limiter(serviceMethod)
+	if l == nil {
+		return call(ctx), false
+	}
+	if l.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, l.Timeout)
+		defer cancel()
+	}
+
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		default:
+			if !l.Queue {
+				Metrics.Add(metricLimitRejections, 1)
+				return NewError(errBusy.Code, "rpc: too many concurrent calls of "+serviceMethod).Error(), false
+			}
+			select {
+			case l.slots <- struct{}{}:
+			case <-ctx.Done():
+				return timeoutMessage(ctx, serviceMethod), false
+			}
+		}
+	}
+	release := func() {
+		if l.slots != nil {
+			<-l.slots
+		}
+	}
+	if l.Timeout == 0 {
+		defer release()
+		return call(ctx), false
+	}
+
+	done := make(chan string, 1)
+	go func() {
+		defer release()
+		done <- call(ctx)
+	}()
+	select {
+	case errmsg := <-done:
+		return errmsg, false
+	case <-ctx.Done():
+		return timeoutMessage(ctx, serviceMethod), true
+	}
+}
+
+func timeoutMessage(ctx context.Context, serviceMethod string) string {
+	Metrics.Add(metricLimitTimeouts, 1)
+	return NewError(errTimeout.Code, "rpc: "+serviceMethod+": "+ctx.Err().Error()).Error()
+}
@@ -0,0 +1,225 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type SleepArgs struct {
+	Duration time.Duration
+}
+
+type SlowService struct {
+	release chan struct{}
+}
+
+// Sleep ignores its context.
+func (s *SlowService) Sleep(args *SleepArgs, reply *bool) error {
+	time.Sleep(args.Duration)
+	*reply = true
+	return nil
+}
+
+// Touch changes its args once it slept.
+func (s *SlowService) Touch(args *SleepArgs, reply *bool) error {
+	time.Sleep(args.Duration)
+	args.Duration = 0
+	*reply = true
+	return nil
+}
+
+// Wait returns when released or at the timeout of the call.
+func (s *SlowService) Wait(ctx context.Context, args *SleepArgs, reply *bool) error {
+	select {
+	case <-s.release:
+		*reply = true
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func newLimitedServer(t *testing.T, limits ...MethodLimit) (*Server, *SlowService) {
+	svc := &SlowService{release: make(chan struct{})}
+	server := NewServer()
+	server.RegisterName("slow", svc)
+	if err := server.SetLimits(limits); err != nil {
+		t.Fatal(err)
+	}
+	return server, svc
+}
+
+func errorCode(err error) int {
+	if e, _ := serverError(err); e != nil {
+		return e.Code
+	}
+	return 0
+}
+
+func Test_SetLimits(t *testing.T) {
+	server := NewServer()
+	for _, limits := range [][]MethodLimit{
+		{{Name: ""}},
+		{{Name: "slow."}},
+		{{Name: "slow", MaxConcurrent: -1}},
+		{{Name: "slow"}, {Name: "slow"}},
+	} {
+		if err := server.SetLimits(limits); err == nil {
+			t.Fatalf("expected error for %v", limits)
+		}
+	}
+}
+
+func Test_LimitConcurrency(t *testing.T) {
+	server, svc := newLimitedServer(t, MethodLimit{Name: "slow", MaxConcurrent: 1})
+	cli, srv := net.Pipe()
+	go server.ServeCodec(NewServerCodec(srv, server))
+	client := NewClient(cli)
+	defer client.Close()
+
+	var reply bool
+	call := client.Go("slow.Wait", &SleepArgs{}, &reply, nil)
+	time.Sleep(50 * time.Millisecond)
+	rejections := metricValue(metricLimitRejections)
+	if err := client.Call("slow.Sleep", &SleepArgs{}, &reply); errorCode(err) != errBusy.Code {
+		t.Fatalf("expected busy error, got %v", err)
+	}
+	if metricValue(metricLimitRejections) != rejections+1 {
+		t.Fatalf("rejection not counted")
+	}
+	svc.release <- struct{}{}
+	if (<-call.Done).Error != nil {
+		t.Fatal(call.Error)
+	}
+	if err := client.Call("slow.Sleep", &SleepArgs{}, &reply); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_LimitQueue(t *testing.T) {
+	server, svc := newLimitedServer(t,
+		MethodLimit{Name: "slow", MaxConcurrent: 1},
+		MethodLimit{Name: "slow.Sleep", MaxConcurrent: 1, Queue: true, Timeout: time.Second})
+	cli, srv := net.Pipe()
+	go server.ServeCodec(NewServerCodec(srv, server))
+	client := NewClient(cli)
+	defer client.Close()
+
+	// the limit of slow.Sleep replaces the limit of the namespace
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var reply bool
+			if err := client.Call("slow.Sleep", &SleepArgs{50 * time.Millisecond}, &reply); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	var reply bool
+	call := client.Go("slow.Wait", &SleepArgs{}, &reply, nil)
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Fatalf("queued calls ran concurrently in %v", elapsed)
+	}
+	svc.release <- struct{}{}
+	if (<-call.Done).Error != nil {
+		t.Fatal(call.Error)
+	}
+}
+
+func Test_LimitTimeout(t *testing.T) {
+	server, _ := newLimitedServer(t, MethodLimit{Name: "slow", Timeout: 50 * time.Millisecond})
+	handler := NewWsRPCServer()
+	handler.rpc = server
+	ts := httptest.NewServer(http.HandlerFunc(handler.ServeWS))
+	defer ts.Close()
+	client, err := DialWebsocket("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var reply bool
+	start := time.Now()
+	if err := client.Call("slow.Sleep", &SleepArgs{time.Second}, &reply); errorCode(err) != errTimeout.Code {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+	if err := client.Call("slow.Wait", &SleepArgs{}, &reply); errorCode(err) != errTimeout.Code {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("calls not timed out: %v", elapsed)
+	}
+}
+
+func Test_LimitTimeoutRecorded(t *testing.T) {
+	server, _ := newLimitedServer(t, MethodLimit{Name: "slow", Timeout: 20 * time.Millisecond})
+	var capture bytes.Buffer
+	server.SetRecorder(NewRecorder(&capture, nil))
+	l := &entryLogger{}
+	server.SetAccessLog(l, &AccessLogOptions{SampleRate: 1})
+	cli, srv := net.Pipe()
+	go server.ServeCodec(NewServerCodec(srv, server))
+	client := NewClient(cli)
+	defer client.Close()
+
+	// the method still runs with its args when the call times out
+	var reply bool
+	if err := client.Call("slow.Touch", &SleepArgs{50 * time.Millisecond}, &reply); errorCode(err) != errTimeout.Code {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if capture.Len() != 0 {
+		t.Fatalf("expected no capture, got %s", capture.String())
+	}
+	if entry := l.last(t); entry["params_size"] != nil || entry["code"] != errTimeout.Code {
+		t.Fatalf("expected a timeout without params, got %v", entry)
+	}
+}
+
+func Test_LimitBatch(t *testing.T) {
+	server, _ := newLimitedServer(t, MethodLimit{Name: "slow.Sleep", MaxConcurrent: 1})
+	handler := &HTTPServer{rpc: server}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	body := `[{"jsonrpc":"2.0","method":"slow.Sleep","params":[{"Duration":200000000}],"id":1},` +
+		`{"jsonrpc":"2.0","method":"slow.Sleep","params":[{"Duration":200000000}],"id":2}]`
+	resp, err := http.Post(ts.URL, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var replies []struct {
+		Result *bool
+		Error  *Error
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&replies); err != nil || len(replies) != 2 {
+		t.Fatalf("bad replies %v: %v", replies, err)
+	}
+	busy := 0
+	for _, r := range replies {
+		if r.Error != nil && r.Error.Code == errBusy.Code {
+			busy++
+		}
+	}
+	if busy != 1 {
+		t.Fatalf("expected one busy reply, got %d", busy)
+	}
+}
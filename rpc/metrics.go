@@ -0,0 +1,51 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package rpc
+
+import (
+	"expvar"
+)
+
+// Metrics holds the counters of the rpc package. It is published by
+// expvar as "rpc", so it is served on /debug/vars with the default mux.
+var Metrics = expvar.NewMap("rpc")
+
+const (
+	// metricPanics counts panics recovered in RPC methods.
+	metricPanics = "panics"
+	// metricEjections counts endpoints ejected by a MultiClient.
+	metricEjections = "endpoint_ejections"
+	// metricCacheHits and metricCacheMisses count lookups of cached responses.
+	metricCacheHits   = "cache_hits"
+	metricCacheMisses = "cache_misses"
+	// metricLimitRejections and metricLimitTimeouts count the calls failed
+	// by a MethodLimit.
+	metricLimitRejections = "limit_rejections"
+	metricLimitTimeouts   = "limit_timeouts"
+	// metricIdempotentReplays counts the calls answered with the stored
+	// response of their idempotency key.
+	metricIdempotentReplays = "idempotent_replays"
+	// metricDeprecatedCalls counts the calls of deprecated methods, in a
+	// map by method.
+	metricDeprecatedCalls = "deprecated_calls"
+	// metricHedgedCalls counts the duplicates sent by a MultiClient for slow
+	// calls, and metricHedgeWins the ones which replied first.
+	metricHedgedCalls = "hedged_calls"
+	metricHedgeWins   = "hedge_wins"
+	// metricBreakerOpened, metricBreakerHalfOpened and metricBreakerClosed
+	// count the transitions of the circuits of a Breaker to each state.
+	metricBreakerOpened     = "breaker_open"
+	metricBreakerHalfOpened = "breaker_half_open"
+	metricBreakerClosed     = "breaker_closed"
+)
+
+// PanicCount returns the number of panics recovered in RPC methods.
+func PanicCount() int64 {
+	if v, ok := Metrics.Get(metricPanics).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
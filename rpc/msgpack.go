@@ -0,0 +1,455 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package rpc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/rpc"
+	"sync"
+
+	"github.com/vmihailenco/msgpack"
+	"github.com/vmihailenco/msgpack/codes"
+)
+
+// MsgpackContentType is the HTTP Content-Type which selects the MessagePack codec.
+const MsgpackContentType = "application/msgpack"
+
+var errBadMsgpackRequest = errors.New("bad request")
+
+// msgpackNull is the id of the responses to requests without one, which
+// are not notifications, such as a batch.
+var msgpackNull = []byte{byte(codes.Nil)}
+
+// msgpackReader records the bytes consumed by a msgpack.Decoder so that
+// a value can be kept undecoded, the same way json.RawMessage is used
+// by the JSON codec.
+type msgpackReader struct {
+	s interface {
+		io.Reader
+		io.ByteScanner
+	}
+	rec       []byte
+	recording bool
+}
+
+func newMsgpackReader(r io.Reader) *msgpackReader {
+	if s, ok := r.(*bytes.Reader); ok {
+		return &msgpackReader{s: s}
+	}
+	return &msgpackReader{s: bufio.NewReader(r)}
+}
+
+func (r *msgpackReader) Read(p []byte) (int, error) {
+	n, err := r.s.Read(p)
+	if r.recording {
+		r.rec = append(r.rec, p[:n]...)
+	}
+	return n, err
+}
+
+func (r *msgpackReader) ReadByte() (byte, error) {
+	c, err := r.s.ReadByte()
+	if err == nil && r.recording {
+		r.rec = append(r.rec, c)
+	}
+	return c, err
+}
+
+func (r *msgpackReader) UnreadByte() error {
+	err := r.s.UnreadByte()
+	if err == nil && r.recording && len(r.rec) > 0 {
+		r.rec = r.rec[:len(r.rec)-1]
+	}
+	return err
+}
+
+// next returns the encoding of the next value read by dec.
+func (r *msgpackReader) next(dec *msgpack.Decoder) ([]byte, error) {
+	r.rec = make([]byte, 0, 64)
+	r.recording = true
+	err := dec.Skip()
+	r.recording = false
+	raw := r.rec
+	r.rec = nil
+	return raw, err
+}
+
+func newMsgpackDecoder(r io.Reader) (*msgpack.Decoder, *msgpackReader) {
+	rd := newMsgpackReader(r)
+	return msgpack.NewDecoder(rd).UseJSONTag(true), rd
+}
+
+func newMsgpackEncoder(w io.Writer) *msgpack.Encoder {
+	return msgpack.NewEncoder(w).UseJSONTag(true)
+}
+
+func isMsgpackArray(raw []byte) bool {
+	if len(raw) == 0 {
+		return false
+	}
+	c := codes.Code(raw[0])
+	return codes.IsFixedArray(c) || c == codes.Array16 || c == codes.Array32
+}
+
+func isMsgpackMap(raw []byte) bool {
+	if len(raw) == 0 {
+		return false
+	}
+	c := codes.Code(raw[0])
+	return codes.IsFixedMap(c) || c == codes.Map16 || c == codes.Map32
+}
+
+// msgpackRequest is the MessagePack form of jsonRequest.
+// Params and ID keep their raw encoding.
+type msgpackRequest struct {
+	Version string
+	Method  string
+	Params  []byte
+	ID      []byte
+	Meta    *callMeta
+}
+
+func (r *msgpackRequest) reset() {
+	r.Version = ""
+	r.Method = ""
+	r.Params = nil
+	r.ID = nil
+	r.Meta = nil
+}
+
+// unmarshal applies the same rules as jsonRequest.UnmarshalJSON.
+func (r *msgpackRequest) unmarshal(raw []byte) error {
+	r.reset()
+	if !isMsgpackMap(raw) {
+		return errBadMsgpackRequest
+	}
+	dec, rd := newMsgpackDecoder(bytes.NewReader(raw))
+	n, err := dec.DecodeMapLen()
+	if err != nil || n > 5 {
+		return errBadMsgpackRequest
+	}
+
+	var okVer, okMethod, okParams, okID, okMeta bool
+	for i := 0; i < n; i++ {
+		key, err := dec.DecodeString()
+		if err != nil {
+			return errBadMsgpackRequest
+		}
+		switch key {
+		case "jsonrpc":
+			okVer = true
+			if r.Version, err = dec.DecodeString(); err != nil {
+				return errBadMsgpackRequest
+			}
+		case "method":
+			okMethod = true
+			if r.Method, err = dec.DecodeString(); err != nil {
+				return errBadMsgpackRequest
+			}
+		case "params":
+			okParams = true
+			if r.Params, err = rd.next(dec); err != nil {
+				return errBadMsgpackRequest
+			}
+		case "id":
+			okID = true
+			if r.ID, err = rd.next(dec); err != nil {
+				return errBadMsgpackRequest
+			}
+		case "meta":
+			okMeta = true
+			if c, err := dec.PeekCode(); err != nil || !(codes.IsFixedMap(c) || c == codes.Map16 || c == codes.Map32) {
+				return errBadMsgpackRequest
+			}
+			r.Meta = &callMeta{}
+			if err := dec.Decode(r.Meta); err != nil {
+				return errBadMsgpackRequest
+			}
+		default:
+			return errBadMsgpackRequest
+		}
+	}
+
+	if !okVer || !okMethod || r.Version != jsonrpcVersion {
+		return errBadMsgpackRequest
+	}
+	if n == 5 && !okMeta {
+		return errBadMsgpackRequest
+	}
+	if okParams && len(r.Params) == 1 && codes.Code(r.Params[0]) == codes.Nil {
+		return errBadMsgpackRequest
+	}
+	if okID {
+		c := codes.Code(r.ID[0])
+		if c == codes.True || c == codes.False || isMsgpackArray(r.ID) || isMsgpackMap(r.ID) {
+			return errBadMsgpackRequest
+		}
+	}
+	return nil
+}
+
+type msgpackCodec struct {
+	dec *msgpack.Decoder // for reading MessagePack values
+	rd  *msgpackReader
+	w   io.Writer
+	c   io.Closer
+	srv *Server
+
+	// temporary work space
+	req msgpackRequest
+
+	// Same as jsonCodec: incoming request IDs are kept raw in pending
+	// and replaced with uint64 sequence numbers for package rpc.
+	mutex    sync.Mutex // protects seq, pending
+	encmutex sync.Mutex // protects buf, enc and w
+	buf      bytes.Buffer
+	enc      *msgpack.Encoder
+	seq      uint64
+	pending  map[uint64][]byte
+}
+
+// NewMsgpackCodec returns a new rpc.ServerCodec using MessagePack encoded
+// JSON-RPC 2.0 envelopes on conn, for the net/rpc server srv, or
+// rpc.DefaultServer if nil.
+func NewMsgpackCodec(conn io.ReadWriteCloser, srv *rpc.Server) rpc.ServerCodec {
+	if srv == nil {
+		srv = rpc.DefaultServer
+	}
+	return newMsgpackCodec(conn, newNetRPCServer(srv))
+}
+
+// NewMsgpackServerCodec returns a new rpc.ServerCodec using MessagePack
+// encoded JSON-RPC 2.0 envelopes on conn, for the Server srv.
+func NewMsgpackServerCodec(conn io.ReadWriteCloser, srv *Server) rpc.ServerCodec {
+	srv.Register(MsgpackRPC{})
+	return newMsgpackCodec(conn, srv)
+}
+
+func newMsgpackCodec(conn io.ReadWriteCloser, srv *Server) *msgpackCodec {
+	dec, rd := newMsgpackDecoder(conn)
+	c := &msgpackCodec{
+		dec:     dec,
+		rd:      rd,
+		w:       conn,
+		c:       conn,
+		srv:     srv,
+		pending: make(map[uint64][]byte),
+	}
+	c.enc = newMsgpackEncoder(&c.buf)
+	return c
+}
+
+func (c *msgpackCodec) writeError(e *Error) {
+	c.encmutex.Lock()
+	defer c.encmutex.Unlock()
+	c.buf.Reset()
+	if writeMsgpackResponse(&c.buf, c.enc, nil, nil, e) == nil {
+		c.w.Write(c.buf.Bytes())
+	}
+}
+
+func (c *msgpackCodec) ReadRequestHeader(r *rpc.Request) error {
+	raw, err := c.rd.next(c.dec)
+	if err != nil {
+		if err != io.EOF {
+			c.writeError(errParse)
+		}
+		return err
+	}
+
+	if isMsgpackArray(raw) {
+		c.req.Version = jsonrpcVersion
+		c.req.Method = "MsgpackRPC.Batch"
+		c.req.Params = raw
+		c.req.ID = msgpackNull
+		c.req.Meta = nil
+	} else if err := c.req.unmarshal(raw); err != nil {
+		c.writeError(errRequest)
+		return err
+	}
+
+	r.ServiceMethod = c.req.Method
+
+	c.mutex.Lock()
+	c.seq++
+	c.pending[c.seq] = c.req.ID
+	c.req.ID = nil
+	r.Seq = c.seq
+	c.mutex.Unlock()
+
+	return nil
+}
+
+func (c *msgpackCodec) requestMeta() *callMeta {
+	return c.req.Meta
+}
+
+func (c *msgpackCodec) ReadRequestBody(x interface{}) error {
+	if x == nil {
+		return nil
+	}
+
+	if c.req.Params == nil {
+		return errParams
+	}
+
+	if c.req.Method == "MsgpackRPC.Batch" {
+		arg := x.(*MsgpackBatchArg)
+		arg.srv = c.srv
+		reqs, err := splitMsgpackArray(c.req.Params)
+		if err != nil {
+			return NewError(errParams.Code, err.Error())
+		}
+		if len(reqs) == 0 {
+			return errRequest
+		}
+		arg.reqs = reqs
+		return nil
+	}
+
+	// Params is an array whose first element is the RPC argument,
+	// the same shape the JSON codec accepts.
+	if !isMsgpackArray(c.req.Params) {
+		return NewError(errParams.Code, "msgpack: params must be an array")
+	}
+	dec := msgpack.NewDecoder(bytes.NewReader(c.req.Params)).UseJSONTag(true)
+	n, err := dec.DecodeArrayLen()
+	if err != nil {
+		return NewError(errParams.Code, err.Error())
+	}
+	if n > 0 {
+		if err := dec.Decode(x); err != nil {
+			return NewError(errParams.Code, err.Error())
+		}
+	}
+	return nil
+}
+
+func (c *msgpackCodec) WriteResponse(r *rpc.Response, x interface{}) error {
+	c.mutex.Lock()
+	id, ok := c.pending[r.Seq]
+	if !ok {
+		c.mutex.Unlock()
+		return errors.New("invalid sequence number in response")
+	}
+	delete(c.pending, r.Seq)
+	c.mutex.Unlock()
+
+	c.encmutex.Lock()
+	defer c.encmutex.Unlock()
+	c.buf.Reset()
+
+	if replies, ok := x.(*[][]byte); r.ServiceMethod == "MsgpackRPC.Batch" && ok {
+		if len(*replies) == 0 {
+			return nil
+		}
+		if err := c.enc.EncodeArrayLen(len(*replies)); err != nil {
+			return err
+		}
+		for _, reply := range *replies {
+			c.buf.Write(reply)
+		}
+		_, err := c.w.Write(c.buf.Bytes())
+		return err
+	}
+
+	if id == nil {
+		// Notification, the client expects no reply.
+		return nil
+	}
+
+	var err error
+	if r.Error == "" {
+		err = writeMsgpackResponse(&c.buf, c.enc, id, x, nil)
+	} else {
+		err = writeMsgpackResponse(&c.buf, c.enc, id, nil, responseError(r.Error))
+	}
+	if err != nil {
+		return err
+	}
+	_, err = c.w.Write(c.buf.Bytes())
+	return err
+}
+
+func (c *msgpackCodec) Close() error {
+	return c.c.Close()
+}
+
+// responseError converts rpc.Response.Error into an Error object.
+// Pre-serialized errors are decoded, others get an auto-detected code.
+func responseError(msg string) *Error {
+	if msg[0] == '{' && msg[len(msg)-1] == '}' {
+		e := &Error{}
+		if json.Unmarshal([]byte(msg), e) == nil {
+			return e
+		}
+	}
+	return newError(msg)
+}
+
+// writeMsgpackResponse encodes a response envelope into buf using enc,
+// which must write to buf. A nil id is encoded as nil.
+func writeMsgpackResponse(buf *bytes.Buffer, enc *msgpack.Encoder, id []byte, result interface{}, e *Error) error {
+	if err := enc.EncodeMapLen(3); err != nil {
+		return err
+	}
+	if err := enc.EncodeString("jsonrpc"); err != nil {
+		return err
+	}
+	if err := enc.EncodeString(jsonrpcVersion); err != nil {
+		return err
+	}
+	if err := enc.EncodeString("id"); err != nil {
+		return err
+	}
+	if id == nil {
+		if err := enc.EncodeNil(); err != nil {
+			return err
+		}
+	} else {
+		buf.Write(id)
+	}
+	if e != nil {
+		if err := enc.EncodeString("error"); err != nil {
+			return err
+		}
+		return enc.Encode(e)
+	}
+	if err := enc.EncodeString("result"); err != nil {
+		return err
+	}
+	return enc.Encode(result)
+}
+
+// splitMsgpackArray returns the raw encoding of each element of an array.
+func splitMsgpackArray(raw []byte) ([][]byte, error) {
+	dec, rd := newMsgpackDecoder(bytes.NewReader(raw))
+	n, err := dec.DecodeArrayLen()
+	if err != nil {
+		return nil, err
+	}
+	elems := make([][]byte, 0, n)
+	for i := 0; i < n; i++ {
+		elem, err := rd.next(dec)
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, elem)
+	}
+	return elems, nil
+}
+
+// ServeMsgpackConn runs the MessagePack RPC server on a single connection.
+// ServeMsgpackConn blocks, serving the connection until the client hangs up.
+// It serves the services of rpc.DefaultServer.
+func ServeMsgpackConn(conn io.ReadWriteCloser) {
+	srv := newNetRPCServer(rpc.DefaultServer)
+	srv.ServeCodec(newMsgpackCodec(conn, srv))
+}
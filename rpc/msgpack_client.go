@@ -0,0 +1,269 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package rpc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"net/rpc"
+	"sync"
+
+	"github.com/vmihailenco/msgpack"
+	"github.com/vmihailenco/msgpack/codes"
+)
+
+type msgpackClientCodec struct {
+	dec *msgpack.Decoder // for reading MessagePack values
+	rd  *msgpackReader
+	w   io.Writer
+	c   io.Closer
+
+	// temporary work space
+	resp msgpackClientResponse
+
+	mutex    sync.Mutex        // protects pending
+	pending  map[uint64]string // map request id to method name
+	encmutex sync.Mutex        // protects buf, enc and w
+	buf      bytes.Buffer
+	enc      *msgpack.Encoder
+}
+
+// NewMsgpackClientCodec returns a new rpc.ClientCodec using MessagePack
+// encoded JSON-RPC 2.0 envelopes on conn.
+func NewMsgpackClientCodec(conn io.ReadWriteCloser) rpc.ClientCodec {
+	dec, rd := newMsgpackDecoder(conn)
+	c := &msgpackClientCodec{
+		dec:     dec,
+		rd:      rd,
+		w:       conn,
+		c:       conn,
+		pending: make(map[uint64]string),
+	}
+	c.enc = newMsgpackEncoder(&c.buf)
+	return c
+}
+
+func (c *msgpackClientCodec) WriteRequest(r *rpc.Request, param interface{}) error {
+	meta, param := unwrapParam(param)
+	param, err := normalizeParam(param)
+	if err != nil {
+		return err
+	}
+
+	fields := 3
+	if meta != nil {
+		fields++
+	}
+	if r.Seq != seqNotify {
+		c.mutex.Lock()
+		c.pending[r.Seq] = r.ServiceMethod
+		c.mutex.Unlock()
+		fields++
+	}
+
+	c.encmutex.Lock()
+	defer c.encmutex.Unlock()
+	c.buf.Reset()
+	if err := c.writeRequest(r, param, meta, fields); err != nil {
+		return NewError(errInternal.Code, err.Error())
+	}
+	if _, err := c.w.Write(c.buf.Bytes()); err != nil {
+		return connError(err)
+	}
+	return nil
+}
+
+func (c *msgpackClientCodec) writeRequest(r *rpc.Request, param interface{}, meta *callMeta, fields int) error {
+	enc := c.enc
+	if err := enc.EncodeMapLen(fields); err != nil {
+		return err
+	}
+	if err := enc.EncodeString("jsonrpc"); err != nil {
+		return err
+	}
+	if err := enc.EncodeString(jsonrpcVersion); err != nil {
+		return err
+	}
+	if err := enc.EncodeString("method"); err != nil {
+		return err
+	}
+	if err := enc.EncodeString(r.ServiceMethod); err != nil {
+		return err
+	}
+	if err := enc.EncodeString("params"); err != nil {
+		return err
+	}
+	if err := enc.Encode([1]interface{}{param}); err != nil {
+		return err
+	}
+	if meta != nil {
+		if err := enc.EncodeString("meta"); err != nil {
+			return err
+		}
+		if err := enc.Encode(meta); err != nil {
+			return err
+		}
+	}
+	if r.Seq != seqNotify {
+		if err := enc.EncodeString("id"); err != nil {
+			return err
+		}
+		return enc.EncodeUint64(r.Seq)
+	}
+	return nil
+}
+
+// msgpackClientResponse is the MessagePack form of clientResponse.
+type msgpackClientResponse struct {
+	Version string
+	ID      *uint64
+	Result  []byte
+	Error   *Error
+}
+
+func (r *msgpackClientResponse) reset() {
+	r.Version = ""
+	r.ID = nil
+	r.Result = nil
+	r.Error = nil
+}
+
+// unmarshal applies the same rules as clientResponse.UnmarshalJSON.
+func (r *msgpackClientResponse) unmarshal(raw []byte) error {
+	r.reset()
+	bad := errors.New("bad response")
+	if !isMsgpackMap(raw) {
+		return bad
+	}
+	dec, rd := newMsgpackDecoder(bytes.NewReader(raw))
+	n, err := dec.DecodeMapLen()
+	if err != nil || n > 3 {
+		return bad
+	}
+
+	var okVer, okID, okRes, okErr, nilID bool
+	for i := 0; i < n; i++ {
+		key, err := dec.DecodeString()
+		if err != nil {
+			return bad
+		}
+		switch key {
+		case "jsonrpc":
+			okVer = true
+			if r.Version, err = dec.DecodeString(); err != nil {
+				return bad
+			}
+		case "id":
+			okID = true
+			if c, err := dec.PeekCode(); err != nil {
+				return bad
+			} else if c == codes.Nil {
+				nilID = true
+				if err := dec.DecodeNil(); err != nil {
+					return bad
+				}
+			} else {
+				id, err := dec.DecodeUint64()
+				if err != nil {
+					return bad
+				}
+				r.ID = &id
+			}
+		case "result":
+			okRes = true
+			if r.Result, err = rd.next(dec); err != nil {
+				return bad
+			}
+		case "error":
+			okErr = true
+			e := &Error{}
+			if err := dec.Decode(e); err != nil {
+				return bad
+			}
+			r.Error = e
+		default:
+			return bad
+		}
+	}
+
+	if !okVer || !okID || !(okRes || okErr) || (okRes && okErr) {
+		return bad
+	}
+	if r.Version != jsonrpcVersion {
+		return bad
+	}
+	if okErr && r.Error == nil {
+		return bad
+	}
+	if nilID && !okErr {
+		return bad
+	}
+	return nil
+}
+
+func (c *msgpackClientCodec) ReadResponseHeader(r *rpc.Response) error {
+	// Same error contract as clientCodec.ReadResponseHeader.
+	raw, err := c.rd.next(c.dec)
+	if err != nil {
+		if err == io.EOF {
+			return err
+		}
+		return connError(err)
+	}
+	if err := c.resp.unmarshal(raw); err != nil {
+		return connError(err)
+	}
+	if c.resp.ID == nil {
+		return c.resp.Error
+	}
+
+	c.mutex.Lock()
+	r.ServiceMethod = c.pending[*c.resp.ID]
+	delete(c.pending, *c.resp.ID)
+	c.mutex.Unlock()
+
+	r.Error = ""
+	r.Seq = *c.resp.ID
+	if c.resp.Error != nil {
+		r.Error = c.resp.Error.Error()
+	}
+	return nil
+}
+
+func (c *msgpackClientCodec) ReadResponseBody(x interface{}) error {
+	if x == nil {
+		return nil
+	}
+	dec := msgpack.NewDecoder(bytes.NewReader(c.resp.Result)).UseJSONTag(true)
+	if err := dec.Decode(x); err != nil {
+		e := NewError(errInternal.Code, err.Error())
+		e.Data = NewError(errInternal.Code, "failed to unmarshal Reply when some other Call")
+		return e
+	}
+	return nil
+}
+
+func (c *msgpackClientCodec) Close() error {
+	return c.c.Close()
+}
+
+// NewMsgpackClient returns a new Client using the MessagePack codec on conn.
+func NewMsgpackClient(conn io.ReadWriteCloser) *Client {
+	return NewClientWithCodec(NewMsgpackClientCodec(conn))
+}
+
+// DialMsgpack connects to a MessagePack RPC server at the specified network address.
+func DialMsgpack(network, address string) (*Client, error) {
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	client := NewMsgpackClient(conn)
+	client.endpoint = address
+	return client, err
+}
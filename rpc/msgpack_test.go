@@ -0,0 +1,159 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package rpc
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+func Test_Msgpack_Client(t *testing.T) {
+	cli, srv := net.Pipe()
+	go ServeMsgpackConn(srv)
+	client := NewMsgpackClient(cli)
+	defer client.Close()
+
+	var reply Reply
+	if err := client.Call("Arith.Add", &Args{7, 8}, &reply); err != nil {
+		t.Fatalf("Add: %s", err)
+	}
+	if reply.C != 15 {
+		t.Fatalf("Add: got %d expected 15", reply.C)
+	}
+
+	err := client.Call("Arith.Div", &Args{7, 0}, &reply)
+	if err == nil {
+		t.Fatalf("Div: expected error")
+	}
+	if e := ServerError(err); e.Code != errServer.Code || e.Message != "divide by zero" {
+		t.Fatalf("Div: unexpected error %v", e)
+	}
+
+	err = client.Call("Arith.Unknown", &Args{7, 8}, &reply)
+	if e := ServerError(err); e == nil || e.Code != errMethod.Code {
+		t.Fatalf("Unknown: unexpected error %v", err)
+	}
+}
+
+func Test_Msgpack_NullID(t *testing.T) {
+	cli, srv := net.Pipe()
+	defer cli.Close()
+	go ServeMsgpackConn(srv)
+	dec := msgpack.NewDecoder(cli)
+
+	// an empty batch is invalid, its error has a null id
+	var buf bytes.Buffer
+	msgpack.NewEncoder(&buf).Encode([]interface{}{})
+	go cli.Write(buf.Bytes())
+	var resp map[string]interface{}
+	if err := dec.Decode(&resp); err != nil {
+		t.Fatalf("Decode: %s", err)
+	}
+	if id, ok := resp["id"]; !ok || id != nil || resp["error"] == nil {
+		t.Fatalf("bad response %v", resp)
+	}
+}
+
+func Test_Msgpack_Batch(t *testing.T) {
+	cli, srv := net.Pipe()
+	defer cli.Close()
+	go ServeMsgpackConn(srv)
+
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.Encode([]interface{}{
+		map[string]interface{}{"jsonrpc": "2.0", "method": "Arith.Add", "id": 1, "params": []interface{}{map[string]int{"A": 1, "B": 2}}},
+		"bad",
+		map[string]interface{}{"jsonrpc": "2.0", "method": "Arith.Mul", "id": "x", "params": []interface{}{map[string]int{"A": 3, "B": 4}}},
+	})
+	go cli.Write(buf.Bytes())
+
+	var resp []struct {
+		ID     interface{} `msgpack:"id"`
+		Result *Reply      `msgpack:"result"`
+		Error  *Error      `msgpack:"error"`
+	}
+	dec, _ := newMsgpackDecoder(cli)
+	if err := dec.Decode(&resp); err != nil {
+		t.Fatalf("Decode: %s", err)
+	}
+	if len(resp) != 3 {
+		t.Fatalf("expected 3 replies, got %d", len(resp))
+	}
+	// Replies of a batch may come in any order, match them by id.
+	var invalid *Error
+	var mul *Reply
+	for _, r := range resp {
+		switch {
+		case r.ID == nil:
+			invalid = r.Error
+		case r.ID == "x":
+			mul = r.Result
+		}
+	}
+	if invalid == nil || invalid.Code != errRequest.Code {
+		t.Fatalf("expected error for invalid request, got %v", resp)
+	}
+	if mul == nil || mul.C != 12 {
+		t.Fatalf("bad reply for id x: %v", resp)
+	}
+}
+
+func Test_Msgpack_HTTP(t *testing.T) {
+	server, _ := NewHTTPServer(nil, nil)
+	server.GetServer().Register(new(Arith))
+
+	var body bytes.Buffer
+	msgpack.NewEncoder(&body).Encode(map[string]interface{}{
+		"jsonrpc": "2.0", "method": "Arith.Add", "id": 1, "params": []interface{}{map[string]int{"A": 2, "B": 3}},
+	})
+	req := httptest.NewRequest(http.MethodPost, "http://url.com", &body)
+	req.Header.Set("Content-Type", MsgpackContentType)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	if ct := w.Header().Get("Content-Type"); ct != MsgpackContentType {
+		t.Fatalf("bad content type %q", ct)
+	}
+	var resp msgpackClientResponse
+	if err := resp.unmarshal(w.Body.Bytes()); err != nil {
+		t.Fatalf("unmarshal: %s", err)
+	}
+	var reply Reply
+	if err := msgpack.Unmarshal(resp.Result, &reply); err != nil || reply.C != 5 {
+		t.Fatalf("bad result %v %v", reply, err)
+	}
+}
+
+func benchmarkCodec(b *testing.B, client *Client) {
+	defer client.Close()
+	args := &Args{7, 8}
+	var reply Reply
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := client.Call("Arith.Add", args, &reply); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func Benchmark_JSONCodec(b *testing.B) {
+	cli, srv := net.Pipe()
+	go ServeConn(srv)
+	benchmarkCodec(b, NewClient(cli))
+}
+
+func Benchmark_MsgpackCodec(b *testing.B) {
+	cli, srv := net.Pipe()
+	go ServeMsgpackConn(srv)
+	benchmarkCodec(b, NewMsgpackClient(cli))
+}
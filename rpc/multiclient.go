@@ -0,0 +1,371 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package rpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/rpc"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Strategy selects the endpoint of a MultiClient used for a call.
+type Strategy int
+
+const (
+	// RoundRobin spreads calls evenly over the endpoints.
+	RoundRobin Strategy = iota
+	// LeastInFlight picks the endpoint with the fewest calls in progress.
+	LeastInFlight
+	// PriorityFailover picks the first endpoint of the list which is not
+	// ejected, so later endpoints are only used as fallbacks.
+	PriorityFailover
+)
+
+// ErrNoEndpoint is returned when a MultiClient has no endpoint left to try.
+var ErrNoEndpoint = errors.New("rpc: no endpoint available")
+
+// MultiClientOptions multi-endpoint client options config
+type MultiClientOptions struct {
+	Strategy Strategy
+
+	MaxFails      int           // consecutive failures before an endpoint is ejected
+	EjectDuration time.Duration // how long an endpoint stays ejected before it is probed
+	Retries       int           // other endpoints tried when an idempotent call fails
+
+	// Idempotent reports whether a method can safely be sent again to
+	// another endpoint after a failure. No method is retried if nil.
+	Idempotent func(serviceMethod string) bool
+
+	// Dial connects to an endpoint, it defaults to Dial("tcp", address)
+	// within DialTimeout.
+	Dial        func(address string) (*Client, error)
+	DialTimeout time.Duration
+
+	// Breaker guards the calls to each endpoint. An endpoint whose circuit
+	// is open is skipped.
+	Breaker *Breaker
+
+	// HedgeDelay is how long an idempotent call waits for its reply before
+	// a duplicate is sent to another endpoint. Calls are not hedged if 0.
+	HedgeDelay time.Duration
+	// HedgeBudget caps the share of the calls which are hedged, from 0 to 1.
+	HedgeBudget float64
+}
+
+func defaultMultiClientOptions() *MultiClientOptions {
+	return &MultiClientOptions{
+		Strategy:      RoundRobin,
+		MaxFails:      3,
+		EjectDuration: 10 * time.Second,
+		Retries:       1,
+		DialTimeout:   3 * time.Second,
+		HedgeBudget:   0.05,
+	}
+}
+
+// endpoint is an address of a MultiClient and its connection.
+type endpoint struct {
+	address  string
+	inFlight int64 // atomic
+
+	mutex       sync.Mutex // protects client, dialing, fails, ejectedTill
+	client      *Client
+	dialing     *dialCall // in progress, nil if none
+	fails       int
+	ejectedTill time.Time
+}
+
+// dialCall is a dial of an endpoint, whose result is shared by the calls
+// which wait for it.
+type dialCall struct {
+	done   chan struct{}
+	client *Client
+	err    error
+}
+
+func (e *endpoint) available(now time.Time) bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return !now.Before(e.ejectedTill)
+}
+
+// connect returns the connection of the endpoint, dialing it if needed.
+// The endpoint is dialed once at a time, out of its lock, so that a slow
+// dial does not block the calls picking another endpoint.
+func (e *endpoint) connect(dial func(string) (*Client, error), breaker *Breaker) (*Client, error) {
+	e.mutex.Lock()
+	if client := e.client; client != nil {
+		e.mutex.Unlock()
+		return client, nil
+	}
+	d := e.dialing
+	if d != nil {
+		e.mutex.Unlock()
+		<-d.done
+		return d.client, d.err
+	}
+	d = &dialCall{done: make(chan struct{})}
+	e.dialing = d
+	e.mutex.Unlock()
+
+	d.client, d.err = dial(e.address)
+	if d.err == nil {
+		d.client.endpoint = e.address
+		d.client.SetBreaker(breaker)
+	}
+	e.mutex.Lock()
+	e.dialing = nil
+	e.client = d.client
+	e.mutex.Unlock()
+	close(d.done)
+	return d.client, d.err
+}
+
+// report records the outcome of a call. The endpoint is ejected after
+// maxFails consecutive failures; once the ejection is over, the next call
+// probes it, and a single failure ejects it again.
+func (e *endpoint) report(err error, maxFails int, eject time.Duration) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if err == nil {
+		e.fails = 0
+		return
+	}
+	if rerr, ok := err.(*Error); err == rpc.ErrShutdown || err == io.ErrUnexpectedEOF || ok && rerr.conn {
+		// the connection is broken, dial again on next use
+		if e.client != nil {
+			e.client.Close()
+			e.client = nil
+		}
+	}
+	e.fails++
+	if e.fails >= maxFails {
+		e.fails = maxFails - 1
+		e.ejectedTill = time.Now().Add(eject)
+		Metrics.Add(metricEjections, 1)
+	}
+}
+
+func (e *endpoint) close() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.client == nil {
+		return nil
+	}
+	err := e.client.Close()
+	e.client = nil
+	return err
+}
+
+// MultiClient is a client of a service reachable at several addresses.
+// It balances calls over them, ejects the ones which keep failing, and
+// retries or hedges idempotent calls on another endpoint.
+type MultiClient struct {
+	endpoints []*endpoint
+	options   MultiClientOptions
+	next      uint64 // atomic, round-robin counter
+	hedges    *hedgeBudget
+}
+
+// NewMultiClient returns a new MultiClient for addresses. Endpoints are
+// dialed on their first use.
+func NewMultiClient(addresses []string, options *MultiClientOptions) (*MultiClient, error) {
+	if len(addresses) == 0 {
+		return nil, errors.New("rpc: no endpoint address")
+	}
+	def := defaultMultiClientOptions()
+	if options == nil {
+		options = def
+	}
+	m := &MultiClient{options: *options}
+	if m.options.MaxFails <= 0 {
+		m.options.MaxFails = def.MaxFails
+	}
+	if m.options.EjectDuration <= 0 {
+		m.options.EjectDuration = def.EjectDuration
+	}
+	if m.options.Retries < 0 {
+		m.options.Retries = 0
+	}
+	if m.options.HedgeBudget <= 0 {
+		m.options.HedgeBudget = def.HedgeBudget
+	}
+	if m.options.HedgeBudget > 1 {
+		m.options.HedgeBudget = 1
+	}
+	m.hedges = &hedgeBudget{ratio: m.options.HedgeBudget}
+	if m.options.DialTimeout <= 0 {
+		m.options.DialTimeout = def.DialTimeout
+	}
+	if m.options.Dial == nil {
+		timeout := m.options.DialTimeout
+		m.options.Dial = func(address string) (*Client, error) {
+			conn, err := net.DialTimeout("tcp", address, timeout)
+			if err != nil {
+				return nil, err
+			}
+			return NewClient(conn), nil
+		}
+	}
+	for _, address := range addresses {
+		m.endpoints = append(m.endpoints, &endpoint{address: address})
+	}
+	return m, nil
+}
+
+// triedEndpoints are the endpoints tried by a call, shared with its hedge.
+type triedEndpoints struct {
+	mutex sync.Mutex
+	set   map[*endpoint]bool
+}
+
+func newTriedEndpoints() *triedEndpoints {
+	return &triedEndpoints{set: make(map[*endpoint]bool)}
+}
+
+// take picks the endpoint for the next attempt of a call, and marks it
+// tried.
+func (m *MultiClient) take(t *triedEndpoints) *endpoint {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	e := m.pick(t.set)
+	if e != nil {
+		t.set[e] = true
+	}
+	return e
+}
+
+// untried reports whether an endpoint is left for another attempt.
+func (m *MultiClient) untried(t *triedEndpoints) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return len(t.set) < len(m.endpoints)
+}
+
+// pick returns the endpoint for the next attempt of a call, skipping the
+// ones already tried. Ejected endpoints are only used when no other is left.
+func (m *MultiClient) pick(tried map[*endpoint]bool) *endpoint {
+	now := time.Now()
+	var candidates []*endpoint
+	for _, e := range m.endpoints {
+		if !tried[e] && e.available(now) {
+			candidates = append(candidates, e)
+		}
+	}
+	if len(candidates) == 0 {
+		for _, e := range m.endpoints {
+			if !tried[e] {
+				candidates = append(candidates, e)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	switch m.options.Strategy {
+	case LeastInFlight:
+		best := candidates[0]
+		for _, e := range candidates[1:] {
+			if atomic.LoadInt64(&e.inFlight) < atomic.LoadInt64(&best.inFlight) {
+				best = e
+			}
+		}
+		return best
+	case PriorityFailover:
+		return candidates[0]
+	default:
+		n := atomic.AddUint64(&m.next, 1) - 1
+		return candidates[n%uint64(len(candidates))]
+	}
+}
+
+// Call invokes the named function on one of the endpoints, waits for it to
+// complete, and returns its error status.
+func (m *MultiClient) Call(serviceMethod string, args interface{}, reply interface{}) error {
+	return m.CallContext(context.Background(), serviceMethod, args, reply)
+}
+
+// CallContext is like Call but propagates the request ID and trace context
+// of ctx, and gives up when ctx is done.
+//
+// A call is only sent again to another endpoint when the previous attempt
+// failed in transport, and the method is idempotent. Endpoints which can not
+// be dialed or whose circuit is open are skipped for any call, since nothing
+// was sent to them.
+//
+// With HedgeDelay set, an idempotent call whose reply has not arrived
+// after HedgeDelay is also sent to another endpoint, within the
+// HedgeBudget; the first reply is used and the other call cancelled.
+func (m *MultiClient) CallContext(ctx context.Context, serviceMethod string, args interface{}, reply interface{}) error {
+	idempotent := m.options.Idempotent != nil && m.options.Idempotent(serviceMethod)
+	if m.options.HedgeDelay > 0 {
+		m.hedges.deposit()
+		if idempotent && len(m.endpoints) > 1 {
+			if rv := reflect.ValueOf(reply); rv.Kind() == reflect.Ptr && !rv.IsNil() {
+				return m.hedgedCall(ctx, serviceMethod, args, rv)
+			}
+		}
+	}
+	return m.call(ctx, serviceMethod, args, reply, idempotent, newTriedEndpoints())
+}
+
+// call sends a call to the endpoints not tried yet, until one replies or
+// the retries are exhausted.
+func (m *MultiClient) call(ctx context.Context, serviceMethod string, args interface{}, reply interface{}, idempotent bool, tried *triedEndpoints) error {
+	err := ErrNoEndpoint
+	for retries := 0; retries <= m.options.Retries; {
+		e := m.take(tried)
+		if e == nil {
+			return err
+		}
+
+		var client *Client
+		if client, err = e.connect(m.options.Dial, m.options.Breaker); err != nil {
+			e.report(err, m.options.MaxFails, m.options.EjectDuration)
+			continue
+		}
+
+		atomic.AddInt64(&e.inFlight, 1)
+		err = client.CallContext(ctx, serviceMethod, args, reply)
+		atomic.AddInt64(&e.inFlight, -1)
+
+		if err == context.Canceled {
+			return err
+		}
+		if err == ErrBreakerOpen {
+			// nothing was sent, any call can go to another endpoint
+			continue
+		}
+		if !isTransportError(err) {
+			e.report(nil, m.options.MaxFails, m.options.EjectDuration)
+			return err
+		}
+		e.report(err, m.options.MaxFails, m.options.EjectDuration)
+		if !idempotent || ctx.Err() != nil {
+			return err
+		}
+		retries++
+	}
+	return err
+}
+
+// Close closes the connections to all endpoints.
+func (m *MultiClient) Close() error {
+	var err error
+	for _, e := range m.endpoints {
+		if cerr := e.close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
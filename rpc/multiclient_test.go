@@ -0,0 +1,247 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package rpc
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type NameService struct {
+	name  string
+	delay time.Duration
+}
+
+func (s *NameService) Name(args *Args, reply *string) error {
+	time.Sleep(s.delay)
+	*reply = s.name
+	return nil
+}
+
+// listenName serves NameService on a local TCP address.
+func listenName(t *testing.T, name string) net.Listener {
+	return listenNameService(t, &NameService{name: name})
+}
+
+func listenNameService(t *testing.T, s *NameService) net.Listener {
+	server := NewServer()
+	server.RegisterName("Node", s)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go server.ServeCodec(NewServerCodec(conn, server))
+		}
+	}()
+	return l
+}
+
+// listenBroken accepts connections and closes them, counting them in n.
+func listenBroken(t *testing.T, n *int64) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt64(n, 1)
+			conn.Close()
+		}
+	}()
+	return l
+}
+
+func callNames(t *testing.T, m *MultiClient, n int) map[string]int {
+	t.Helper()
+	seen := make(map[string]int)
+	for i := 0; i < n; i++ {
+		var name string
+		if err := m.Call("Node.Name", &Args{}, &name); err != nil {
+			seen["error"]++
+			continue
+		}
+		seen[name]++
+	}
+	return seen
+}
+
+func Test_MultiClient_RoundRobin(t *testing.T) {
+	a, b := listenName(t, "a"), listenName(t, "b")
+	defer a.Close()
+	defer b.Close()
+
+	m, _ := NewMultiClient([]string{a.Addr().String(), b.Addr().String()}, nil)
+	defer m.Close()
+	if seen := callNames(t, m, 6); seen["a"] != 3 || seen["b"] != 3 {
+		t.Fatalf("bad distribution %v", seen)
+	}
+}
+
+func Test_MultiClient_Failover(t *testing.T) {
+	a, b := listenName(t, "a"), listenName(t, "b")
+	defer b.Close()
+	addrA := a.Addr().String()
+	a.Close()
+
+	// a can not be dialed, so even a non idempotent call moves on to b.
+	m, _ := NewMultiClient([]string{addrA, b.Addr().String()}, &MultiClientOptions{Strategy: PriorityFailover, MaxFails: 1})
+	defer m.Close()
+	if seen := callNames(t, m, 3); seen["b"] != 3 {
+		t.Fatalf("expected failover to b, got %v", seen)
+	}
+}
+
+func Test_MultiClient_Eject(t *testing.T) {
+	var brokenConns int64
+	broken := listenBroken(t, &brokenConns)
+	defer broken.Close()
+	good := listenName(t, "good")
+	defer good.Close()
+
+	options := &MultiClientOptions{
+		Strategy:      PriorityFailover,
+		MaxFails:      2,
+		EjectDuration: 100 * time.Millisecond,
+		Retries:       1,
+		Idempotent:    func(method string) bool { return method == "Node.Name" },
+	}
+	m, _ := NewMultiClient([]string{broken.Addr().String(), good.Addr().String()}, options)
+	defer m.Close()
+
+	// Failed attempts on the broken endpoint are retried on the good one.
+	if seen := callNames(t, m, 4); seen["good"] != 4 {
+		t.Fatalf("expected retries on good endpoint, got %v", seen)
+	}
+	if n := atomic.LoadInt64(&brokenConns); n != 2 {
+		t.Fatalf("expected broken endpoint ejected after 2 failures, got %d connections", n)
+	}
+
+	// After the ejection the broken endpoint is probed once and ejected again.
+	time.Sleep(150 * time.Millisecond)
+	if seen := callNames(t, m, 3); seen["good"] != 3 {
+		t.Fatalf("bad calls after ejection %v", seen)
+	}
+	if n := atomic.LoadInt64(&brokenConns); n != 3 {
+		t.Fatalf("expected one probe of the broken endpoint, got %d connections", n-2)
+	}
+
+	// Calls which are not idempotent are not retried.
+	time.Sleep(150 * time.Millisecond)
+	var reply string
+	if err := m.Call("Node.Other", &Args{}, &reply); err == nil || !isTransportError(err) {
+		t.Fatalf("expected transport error, got %v", err)
+	}
+}
+
+func Test_MultiClient_HTTPFailover(t *testing.T) {
+	var downPosts int64
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&downPosts, 1)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	serve, _ := NewHTTPServer(nil, nil)
+	serve.GetServer().RegisterName("Node", &NameService{name: "up"})
+	up := httptest.NewServer(serve)
+	defer up.Close()
+
+	options := &MultiClientOptions{
+		Strategy:      PriorityFailover,
+		MaxFails:      2,
+		EjectDuration: time.Minute,
+		Retries:       1,
+		Idempotent:    func(method string) bool { return method == "Node.Name" },
+		Dial: func(url string) (*Client, error) {
+			return NewHTTPClient(url, nil), nil
+		},
+	}
+	m, _ := NewMultiClient([]string{down.URL, up.URL}, options)
+	defer m.Close()
+
+	// A failed POST is a transport error, retried on the other endpoint
+	// until the failing one is ejected.
+	if seen := callNames(t, m, 4); seen["up"] != 4 {
+		t.Fatalf("expected retries on up endpoint, got %v", seen)
+	}
+	if n := atomic.LoadInt64(&downPosts); n != 2 {
+		t.Fatalf("expected down endpoint ejected after 2 failures, got %d posts", n)
+	}
+}
+
+func Test_MultiClient_LeastInFlight(t *testing.T) {
+	m, _ := NewMultiClient([]string{"a", "b", "c"}, &MultiClientOptions{Strategy: LeastInFlight})
+	m.endpoints[0].inFlight = 2
+	m.endpoints[1].inFlight = 1
+	m.endpoints[2].inFlight = 3
+	if e := m.pick(nil); e.address != "b" {
+		t.Fatalf("expected b, got %s", e.address)
+	}
+	if e := m.pick(map[*endpoint]bool{m.endpoints[1]: true}); e.address != "a" {
+		t.Fatalf("expected a, got %s", e.address)
+	}
+}
+
+func Test_MultiClient_SlowDial(t *testing.T) {
+	good := listenName(t, "good")
+	defer good.Close()
+
+	var dials int64
+	dialing, release := make(chan struct{}, 2), make(chan struct{})
+	options := &MultiClientOptions{
+		Strategy: LeastInFlight,
+		Dial: func(address string) (*Client, error) {
+			if address == "slow" {
+				atomic.AddInt64(&dials, 1)
+				dialing <- struct{}{}
+				<-release
+				return nil, errors.New("unreachable")
+			}
+			return Dial("tcp", address)
+		},
+	}
+	m, _ := NewMultiClient([]string{"slow", good.Addr().String()}, options)
+	defer m.Close()
+
+	// Two calls wait for the same dial of the slow endpoint, while the
+	// other calls go on with the good one.
+	slow := m.endpoints[0]
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := slow.connect(m.options.Dial, nil)
+			done <- err
+		}()
+	}
+	<-dialing
+	atomic.StoreInt64(&slow.inFlight, 2)
+	if seen := callNames(t, m, 2); seen["good"] != 2 {
+		t.Fatalf("expected calls on good endpoint, got %v", seen)
+	}
+	close(release)
+	for i := 0; i < 2; i++ {
+		if err := <-done; err == nil {
+			t.Fatal("expected dial error")
+		}
+	}
+	if n := atomic.LoadInt64(&dials); n != 1 {
+		t.Fatalf("expected a single dial, got %d", n)
+	}
+}
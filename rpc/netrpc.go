@@ -0,0 +1,155 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/rpc"
+	"reflect"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/justoxh/go-toolkit/trace"
+)
+
+// The codecs of the package served net/rpc servers before Server had a
+// dispatcher of its own, and they still do: NewJSONCodec and NewMsgpackCodec
+// take a *rpc.Server, and the servers of HTTPServer and WsRPCServer serve the
+// services registered on the *rpc.Server of GetRPCServer and GetWsRPCServer
+// when they have none of the name.
+
+// errNetRPC is the error of readRequest for a request left to the net/rpc
+// server.
+var errNetRPC = errors.New("rpc: request of the net/rpc server")
+
+// newNetRPCServer returns the Server of the codecs of srv, which serves
+// every call with srv.
+func newNetRPCServer(srv *rpc.Server) *Server {
+	// register the batch methods with the signature net/rpc accepts
+	srv.RegisterName("JSONRPC2", netRPCBatch{})
+	srv.RegisterName("MsgpackRPC", netRPCMsgpackBatch{})
+	return &Server{netrpc: srv}
+}
+
+// netRPCBatch is JSONRPC2 for net/rpc servers.
+type netRPCBatch struct{}
+
+// Batch is an internal RPC method used to process batch requests.
+func (netRPCBatch) Batch(arg BatchArg, replies *[]*json.RawMessage) error {
+	return JSONRPC2{}.Batch(context.Background(), arg, replies)
+}
+
+// netRPCMsgpackBatch is MsgpackRPC for net/rpc servers.
+type netRPCMsgpackBatch struct{}
+
+// Batch is an internal RPC method used to process MessagePack batch requests.
+func (netRPCMsgpackBatch) Batch(arg MsgpackBatchArg, replies *[][]byte) error {
+	return MsgpackRPC{}.Batch(context.Background(), arg, replies)
+}
+
+// serveNetRPC serves req, which names a service the server does not have,
+// with its net/rpc server. Like the calls of the server, the call runs in its
+// own goroutine, counted by wg, once its body is read; it runs before
+// serveNetRPC returns if wg is nil. Its params are validated, its panic is
+// recovered, and it is recorded and logged as the calls of the server are,
+// but it is not limited.
+func (server *Server) serveNetRPC(ctx context.Context, sending *sync.Mutex, wg *sync.WaitGroup, req *rpc.Request, codec rpc.ServerCodec) {
+	c := &netRPCCodec{
+		ServerCodec: codec,
+		server:      server,
+		ctx:         ctx,
+		req:         req,
+		start:       time.Now(),
+		sending:     sending,
+		read:        make(chan struct{}),
+	}
+	if wg == nil {
+		server.serveNetRPCRequest(c)
+		return
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		server.serveNetRPCRequest(c)
+	}()
+	// the codec reads the next request once this one is read
+	<-c.read
+}
+
+// serveNetRPCRequest serves the request of c. A panic of its method is
+// reported as an internal error of this call only.
+func (server *Server) serveNetRPCRequest(c *netRPCCodec) {
+	defer func() {
+		if r := recover(); r != nil {
+			Metrics.Add(metricPanics, 1)
+			server.logError("rpc method panic", "method", c.req.ServiceMethod, "request_id", trace.RequestID(c.ctx), "panic", r, "stack", string(debug.Stack()))
+			c.WriteResponse(&rpc.Response{ServiceMethod: c.req.ServiceMethod, Seq: c.req.Seq, Error: errInternal.Error()}, invalidRequest)
+		}
+	}()
+	server.netrpc.ServeRequest(c)
+}
+
+// netRPCCodec hands a request whose header was already read to a net/rpc
+// server.
+type netRPCCodec struct {
+	rpc.ServerCodec
+	server  *Server
+	ctx     context.Context // of the call
+	req     *rpc.Request
+	start   time.Time
+	argv    reflect.Value // the params read, if any
+	sending *sync.Mutex   // of the responses written by the Server
+	read    chan struct{} // closed once the body is read
+}
+
+func (c *netRPCCodec) ReadRequestHeader(r *rpc.Request) error {
+	r.ServiceMethod, r.Seq = c.req.ServiceMethod, c.req.Seq
+	return nil
+}
+
+// ReadRequestBody reads the body, which net/rpc does once per request, even
+// to discard it. The params which fail their rules are rejected as those of
+// the server are.
+func (c *netRPCCodec) ReadRequestBody(x interface{}) error {
+	defer close(c.read)
+	if err := c.ServerCodec.ReadRequestBody(x); err != nil || x == nil {
+		return err
+	}
+	c.argv = reflect.ValueOf(x)
+	if rules, _ := typeRules(c.argv.Type()); rules != nil {
+		if errmsg := validateParams(c.argv); errmsg != "" {
+			return errors.New(errmsg)
+		}
+	}
+	return nil
+}
+
+// WriteResponse records and logs the call, then writes its response.
+func (c *netRPCCodec) WriteResponse(r *rpc.Response, body interface{}) error {
+	server := c.server
+	var replyv reflect.Value
+	if r.Error == "" {
+		replyv = reflect.ValueOf(body)
+	}
+	if server.recorder != nil && c.argv.IsValid() {
+		if err := server.recorder.record(c.ctx, r.ServiceMethod, c.start, c.argv, replyv, r.Error); err != nil {
+			server.logError("rpc capture", "method", r.ServiceMethod, "error", err.Error())
+		}
+	}
+	server.logAccess(c.ctx, r.ServiceMethod, c.start, c.argv, replyv, r.Error)
+
+	c.sending.Lock()
+	defer c.sending.Unlock()
+	return c.ServerCodec.WriteResponse(r, body)
+}
+
+// Close does not close the codec, which the Server keeps reading.
+func (c *netRPCCodec) Close() error {
+	return nil
+}
@@ -0,0 +1,165 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"sync"
+)
+
+// On a bidirectional connection both ends are a server and a client: each
+// end serves the requests it reads with its handlers, and reads the
+// responses to its own calls. Both run the JSON-RPC 2.0 codecs on streams
+// split from the connection by peerConn.
+
+// peerKey is the context key of the client calling the other end.
+type peerKey struct{}
+
+// Peer returns the client calling back the other end of the bidirectional
+// connection the call of ctx was received on, or nil if the connection is
+// not bidirectional. The client is closed with the connection.
+//
+// A server typically keeps the peer of a client which registers itself,
+// to ask it later to perform a task.
+func Peer(ctx context.Context) *Client {
+	c, _ := ctx.Value(peerKey{}).(*Client)
+	return c
+}
+
+// ServePeer runs the JSON-RPC server on a bidirectional connection, such as
+// an accepted TCP connection. The methods called on it can call back the
+// methods registered by the client through Peer(ctx), and create
+// subscriptions. ServePeer blocks until the client hangs up.
+func (server *Server) ServePeer(ctx context.Context, conn io.ReadWriteCloser) {
+	p := newPeerConn(conn)
+	client := NewClient(&peerStream{p.responses, p})
+	subs := newSubscriptions(func(method string, res *SubscriptionResult) error {
+		return client.Notify(method, res)
+	})
+	ctx = withSubscriptions(context.WithValue(ctx, peerKey{}, client), subs)
+	server.ServeCodecContext(ctx, NewServerCodec(&peerStream{p.requests, p}, server))
+	subs.close()
+	client.Close()
+}
+
+// NewPeerClient returns a new Client on a bidirectional connection. The
+// requests sent by the other end are served by handlers, whose methods can
+// call back the other end through Peer(ctx).
+func NewPeerClient(conn io.ReadWriteCloser, handlers *Server) *Client {
+	if handlers == nil {
+		handlers = NewServer()
+	}
+	p := newPeerConn(conn)
+	client := NewClient(&peerStream{p.responses, p})
+	go handlers.ServeCodecContext(context.WithValue(context.Background(), peerKey{}, client), NewServerCodec(&peerStream{p.requests, p}, handlers))
+	return client
+}
+
+// DialPeer connects to a server running ServePeer at the specified network
+// address, and serves its requests with handlers.
+func DialPeer(network, address string, handlers *Server) (*Client, error) {
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	client := NewPeerClient(conn, handlers)
+	client.endpoint = address
+	return client, nil
+}
+
+// peerConn splits the messages read from a connection into the requests
+// served by this end and the responses to the calls of this end. Writes of
+// both are whole messages, written to the connection one at a time.
+type peerConn struct {
+	conn io.ReadWriteCloser
+
+	requests, responses         *io.PipeReader
+	requestsDone, responsesDone *io.PipeWriter
+
+	wmutex    sync.Mutex // serializes writes to conn
+	closeOnce sync.Once
+}
+
+func newPeerConn(conn io.ReadWriteCloser) *peerConn {
+	p := &peerConn{conn: conn}
+	p.requests, p.requestsDone = io.Pipe()
+	p.responses, p.responsesDone = io.Pipe()
+	go p.read()
+	return p
+}
+
+func (p *peerConn) read() {
+	defer func() {
+		p.requestsDone.Close()
+		p.responsesDone.Close()
+	}()
+	dec := json.NewDecoder(p.conn)
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			if _, ok := err.(*json.SyntaxError); ok {
+				// let the server codec reply with a parse error
+				io.Copy(p.requestsDone, io.MultiReader(dec.Buffered(), p.conn))
+			}
+			return
+		}
+		w := p.requestsDone
+		if id, ok := isResponse(raw); ok {
+			if !id {
+				// can not be matched to a call
+				continue
+			}
+			w = p.responsesDone
+		}
+		if _, err := w.Write(append(raw, '\n')); err != nil {
+			return
+		}
+	}
+}
+
+// isResponse reports whether raw is a valid response object, and whether it
+// has an id. Anything else is served as a request, so that the server codec
+// replies to invalid messages.
+func isResponse(raw json.RawMessage) (id, ok bool) {
+	if len(raw) == 0 || raw[0] != '{' {
+		return false, false
+	}
+	var resp clientResponse
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return false, false
+	}
+	return resp.ID != nil, true
+}
+
+func (p *peerConn) write(b []byte) (int, error) {
+	p.wmutex.Lock()
+	defer p.wmutex.Unlock()
+	return p.conn.Write(b)
+}
+
+func (p *peerConn) close() error {
+	var err error
+	p.closeOnce.Do(func() { err = p.conn.Close() })
+	return err
+}
+
+// peerStream is the stream of requests or responses of a peerConn.
+type peerStream struct {
+	*io.PipeReader
+	p *peerConn
+}
+
+func (s *peerStream) Write(b []byte) (int, error) {
+	return s.p.write(b)
+}
+
+// Close closes the connection, and so both streams.
+func (s *peerStream) Close() error {
+	return s.p.close()
+}
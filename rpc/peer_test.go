@@ -0,0 +1,149 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type TaskArgs struct {
+	Name string
+}
+
+type WorkerService struct {
+	logs chan string
+}
+
+func (s *WorkerService) Run(ctx context.Context, args *TaskArgs, reply *string) error {
+	*reply = "done " + args.Name
+	return nil
+}
+
+func (s *WorkerService) Log(args *TaskArgs, reply *struct{}) error {
+	s.logs <- args.Name
+	return nil
+}
+
+type DispatchService struct {
+	workers chan *Client
+}
+
+func (s *DispatchService) Register(ctx context.Context, args *TaskArgs, reply *bool) error {
+	peer := Peer(ctx)
+	if peer == nil {
+		return errors.New("not bidirectional")
+	}
+	s.workers <- peer
+	*reply = true
+	return nil
+}
+
+// Submit calls back the client while serving its call.
+func (s *DispatchService) Submit(ctx context.Context, args *TaskArgs, reply *string) error {
+	return Peer(ctx).CallContext(ctx, "worker.Run", args, reply)
+}
+
+// testPeer registers a worker at dispatch through the client returned by dial.
+func testPeer(t *testing.T, dial func(handlers *Server) *Client) (*Client, *WorkerService) {
+	worker := &WorkerService{logs: make(chan string, 1)}
+	handlers := NewServer()
+	handlers.RegisterName("worker", worker)
+	client := dial(handlers)
+
+	var ok bool
+	if err := client.Call("dispatch.Register", &TaskArgs{}, &ok); err != nil || !ok {
+		t.Fatalf("register: %v", err)
+	}
+	var reply string
+	if err := client.Call("dispatch.Submit", &TaskArgs{Name: "a"}, &reply); err != nil || reply != "done a" {
+		t.Fatalf("bad reply %q: %v", reply, err)
+	}
+	return client, worker
+}
+
+// testDispatch calls the worker registered by testPeer.
+func testDispatch(t *testing.T, dispatch *DispatchService, worker *WorkerService) {
+	peer := <-dispatch.workers
+	var reply string
+	if err := peer.Call("worker.Run", &TaskArgs{Name: "b"}, &reply); err != nil || reply != "done b" {
+		t.Fatalf("bad reply %q: %v", reply, err)
+	}
+	if err := peer.Notify("worker.Log", &TaskArgs{Name: "c"}); err != nil {
+		t.Fatal(err)
+	}
+	if name := <-worker.logs; name != "c" {
+		t.Fatalf("bad notification %q", name)
+	}
+	err := peer.Call("worker.Missing", &TaskArgs{}, &reply)
+	if e, _ := serverError(err); e == nil || e.Code != errMethod.Code {
+		t.Fatalf("bad error %v", err)
+	}
+}
+
+func Test_Peer(t *testing.T) {
+	dispatch := &DispatchService{workers: make(chan *Client, 1)}
+	server := NewServer()
+	server.RegisterName("dispatch", dispatch)
+
+	cli, srv := net.Pipe()
+	go server.ServePeer(context.Background(), srv)
+
+	client, worker := testPeer(t, func(handlers *Server) *Client {
+		return NewPeerClient(cli, handlers)
+	})
+	defer client.Close()
+	testDispatch(t, dispatch, worker)
+}
+
+func Test_PeerWebsocket(t *testing.T) {
+	dispatch := &DispatchService{workers: make(chan *Client, 1)}
+	handler := NewWsRPCServer()
+	handler.GetServer().RegisterName("dispatch", dispatch)
+	ts := httptest.NewServer(http.HandlerFunc(handler.ServeWS))
+	defer ts.Close()
+
+	client, worker := testPeer(t, func(handlers *Server) *Client {
+		client, err := DialWebsocketPeer("ws"+strings.TrimPrefix(ts.URL, "http"), nil, handlers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return client
+	})
+	defer client.Close()
+	testDispatch(t, dispatch, worker)
+}
+
+func Test_PeerPlainClient(t *testing.T) {
+	server := NewServer()
+	server.Register(new(Arith))
+	cli, srv := net.Pipe()
+	go server.ServePeer(context.Background(), srv)
+	client := NewClient(cli)
+	defer client.Close()
+	var reply Reply
+	if err := client.Call("Arith.Add", &Args{1, 2}, &reply); err != nil || reply.C != 3 {
+		t.Fatalf("bad reply %d: %v", reply.C, err)
+	}
+
+	cli, srv = net.Pipe()
+	go server.ServePeer(context.Background(), srv)
+	defer cli.Close()
+	// a message which is neither a request nor a response is invalid
+	cli.Write([]byte(`{"jsonrpc":"2.0","id":1}` + "\n"))
+	var resp struct {
+		Error *Error
+	}
+	if err := json.NewDecoder(cli).Decode(&resp); err != nil || resp.Error == nil || resp.Error.Code != errRequest.Code {
+		t.Fatalf("bad response %v: %v", resp.Error, err)
+	}
+}
@@ -0,0 +1,235 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/justoxh/go-toolkit/trace"
+)
+
+// ReadOnly is optionally implemented by a registered service to list the
+// methods, by name, which do not change any state. The REST routes serve
+// them with GET too. Methods annotated by Cacheable are read-only as well.
+type ReadOnly interface {
+	ReadOnlyMethods() []string
+}
+
+// EnableREST serves each registered method "namespace.Method" at
+// POST /namespace/Method, with the JSON body as params, next to the
+// JSON-RPC endpoint. Read-only methods are served at GET too, with the
+// query string as params. The first letter of Method may be lower case.
+//
+// REST calls are dispatched as JSON-RPC requests by the same server, and
+// the error objects are mapped to HTTP status codes by RESTStatus.
+func (server *HTTPServer) EnableREST() {
+	server.rest = true
+}
+
+// RESTStatus returns the HTTP status code of a REST call which failed with
+// the JSON-RPC error code.
+func RESTStatus(code int) int {
+	switch code {
+	case errParse.Code, errRequest.Code, errParams.Code:
+		return http.StatusBadRequest
+	case errMethod.Code:
+		return http.StatusNotFound
+	case errBusy.Code:
+		return http.StatusServiceUnavailable
+	case errTimeout.Code:
+		return http.StatusGatewayTimeout
+	case errInProgress.Code:
+		return http.StatusConflict
+	}
+	if code >= reservedCodeMin && code <= reservedCodeMax {
+		return http.StatusInternalServerError
+	}
+	// application errors
+	return http.StatusUnprocessableEntity
+}
+
+// restMethod returns the service method routed at path for version, with
+// a nil methodType if path is not a REST route.
+func (server *HTTPServer) restMethod(path, version string) (string, *methodType) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", nil
+	}
+	serviceMethod, _, mtype, err := server.rpc.resolveMethod(parts[0]+"."+parts[1], version)
+	if err != nil {
+		r, n := utf8.DecodeRuneInString(parts[1])
+		if serviceMethod, _, mtype, err = server.rpc.resolveMethod(parts[0]+"."+string(unicode.ToUpper(r))+parts[1][n:], version); err != nil {
+			return "", nil
+		}
+	}
+	return serviceMethod, mtype
+}
+
+// serveREST serves a REST call of serviceMethod.
+func (server *HTTPServer) serveREST(w http.ResponseWriter, req *http.Request, serviceMethod string, mtype *methodType) {
+	ctx := WithTransport(req.Context(), TransportREST, req.RemoteAddr)
+	ctx = trace.FromHeader(ctx, req.Header)
+	if trace.RequestID(ctx) == "" {
+		ctx = trace.WithRequestID(ctx, trace.NewRequestID())
+	}
+	w.Header().Set(trace.RequestIDHeader, trace.RequestID(ctx))
+	ctx = withIdempotencyKey(ctx, req.Header.Get(IdempotencyKeyHeader))
+	w.Header().Set("Content-Type", "application/json")
+
+	var params json.RawMessage
+	switch req.Method {
+	case http.MethodPost:
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			writeRESTError(w, NewError(errRequest.Code, err.Error()))
+			return
+		}
+		params = bytes.TrimSpace(body)
+		if len(params) == 0 {
+			params = null
+		}
+	case http.MethodGet:
+		if !mtype.readOnly {
+			w.Header().Set("Allow", http.MethodPost)
+			writeRESTStatus(w, http.StatusMethodNotAllowed, NewError(errRequest.Code, "rpc: "+serviceMethod+" is not read-only, must POST"))
+			return
+		}
+		var err error
+		if params, err = queryParams(mtype.ArgType, req.URL.Query()); err != nil {
+			writeRESTError(w, NewError(errParams.Code, err.Error()))
+			return
+		}
+	default:
+		w.Header().Set("Allow", http.MethodPost)
+		writeRESTStatus(w, http.StatusMethodNotAllowed, NewError(errRequest.Code, "rpc: must GET or POST"))
+		return
+	}
+
+	result, e := server.dispatch(ctx, serviceMethod, params)
+	if e != nil {
+		writeRESTError(w, e)
+		return
+	}
+	w.Write(result)
+}
+
+// dispatch serves the call of serviceMethod with the JSON params as a
+// JSON-RPC request, and returns its result or its error object.
+func (server *HTTPServer) dispatch(ctx context.Context, serviceMethod string, params json.RawMessage) (json.RawMessage, *Error) {
+	request, err := json.Marshal(&clientRequest{
+		Version: jsonrpcVersion,
+		Method:  serviceMethod,
+		Params:  [1]interface{}{params},
+		ID:      new(uint64),
+	})
+	if err != nil {
+		return nil, NewError(errInternal.Code, err.Error())
+	}
+	var buf bytes.Buffer
+	conn := &httpReadWriteCloser{bytes.NewReader(request), &buf}
+	server.rpc.ServeRequestContext(ctx, NewServerCodec(conn, server.rpc))
+
+	var resp struct {
+		Result json.RawMessage `json:"result"`
+		Error  *Error          `json:"error"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &resp); err != nil {
+		return nil, NewError(errInternal.Code, err.Error())
+	}
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+	return resp.Result, nil
+}
+
+func writeRESTError(w http.ResponseWriter, e *Error) {
+	writeRESTStatus(w, RESTStatus(e.Code), e)
+}
+
+func writeRESTStatus(w http.ResponseWriter, status int, e *Error) {
+	w.WriteHeader(status)
+	w.Write([]byte(e.Error()))
+}
+
+// queryParams converts a query string into the JSON params of a method
+// taking argType. The values are typed by the fields of a struct or the
+// elements of a map: strings are quoted, other values are taken as JSON.
+func queryParams(argType reflect.Type, query url.Values) (json.RawMessage, error) {
+	for argType.Kind() == reflect.Ptr {
+		argType = argType.Elem()
+	}
+	switch argType.Kind() {
+	case reflect.Struct, reflect.Map:
+	default:
+		return nil, errors.New("rpc: params of type " + argType.String() + " must be POSTed")
+	}
+
+	params := make(map[string]json.RawMessage, len(query))
+	for name, values := range query {
+		var t reflect.Type
+		if argType.Kind() == reflect.Map {
+			t = argType.Elem()
+		} else if f, ok := queryField(argType, name); ok {
+			t = f.Type
+		} else {
+			continue
+		}
+		params[name] = queryValue(t, values)
+	}
+	return json.Marshal(params)
+}
+
+// queryField finds the field of a struct decoded from the member name, the
+// same way encoding/json does.
+func queryField(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		tag := strings.Split(f.Tag.Get("json"), ",")[0]
+		if tag == "-" {
+			continue
+		}
+		if tag == "" {
+			tag = f.Name
+		}
+		if strings.EqualFold(tag, name) {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func queryValue(t reflect.Type, values []string) json.RawMessage {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t.Elem().Kind() != reflect.Uint8 {
+		elems := make([]json.RawMessage, len(values))
+		for i, v := range values {
+			elems[i] = queryValue(t.Elem(), []string{v})
+		}
+		b, _ := json.Marshal(elems)
+		return b
+	}
+	v := values[0]
+	if t.Kind() != reflect.String && json.Valid([]byte(v)) {
+		return json.RawMessage(v)
+	}
+	b, _ := json.Marshal(v)
+	return b
+}
@@ -0,0 +1,118 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package rpc
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type Account struct {
+	ID      string   `json:"id"`
+	Balance int64    `json:"balance"`
+	Tags    []string `json:"tags,omitempty"`
+}
+
+type AccountArgs struct {
+	ID    string   `json:"id"`
+	Min   int64    `json:"min"`
+	Tags  []string `json:"tags"`
+	Limit *int     `json:"limit"`
+}
+
+type AccountService struct{}
+
+func (AccountService) Get(args *AccountArgs, reply *Account) error {
+	if args.ID == "" {
+		return errors.New("no id")
+	}
+	if args.ID == "missing" {
+		return errOrderNotFound
+	}
+	*reply = Account{ID: args.ID, Balance: args.Min, Tags: args.Tags}
+	return nil
+}
+
+func (AccountService) Close(args *AccountArgs, reply *bool) error {
+	*reply = true
+	return nil
+}
+
+func (AccountService) ReadOnlyMethods() []string { return []string{"Get"} }
+
+func Test_REST(t *testing.T) {
+	server, filter := NewHTTPServer(nil, nil)
+	if err := server.GetServer().RegisterName("account", AccountService{}); err != nil {
+		t.Fatal(err)
+	}
+	server.EnableREST()
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		filter.ServeHTTP(w, req)
+		return w
+	}
+	expect := func(w *httptest.ResponseRecorder, status int, body string) {
+		t.Helper()
+		if w.Code != status || strings.TrimSpace(w.Body.String()) != body {
+			t.Fatalf("expected %d %s, got %d %s", status, body, w.Code, w.Body.String())
+		}
+	}
+
+	expect(do(http.MethodPost, "/account/Get", `{"id":"a1","min":5}`), http.StatusOK, `{"id":"a1","balance":5}`)
+	expect(do(http.MethodGet, "/account/get?id=a1&min=7&tags=x&tags=y", ""), http.StatusOK, `{"id":"a1","balance":7,"tags":["x","y"]}`)
+	expect(do(http.MethodGet, "/account/get?id=123", ""), http.StatusOK, `{"id":"123","balance":0}`)
+	expect(do(http.MethodPost, "/account/close", ""), http.StatusOK, `true`)
+
+	expect(do(http.MethodGet, "/account/close", ""), http.StatusMethodNotAllowed,
+		`{"code":-32600,"message":"rpc: account.Close is not read-only, must POST"}`)
+	expect(do(http.MethodGet, "/account/get?min=abc", ""), http.StatusBadRequest,
+		`{"code":-32602,"message":"json: cannot unmarshal string into Go struct field AccountArgs.min of type int64"}`)
+	expect(do(http.MethodPost, "/account/Get", `{}`), http.StatusInternalServerError, `{"code":-32000,"message":"no id"}`)
+	expect(do(http.MethodPost, "/account/Get", `{"id":"missing"}`), http.StatusUnprocessableEntity, `{"code":1001,"message":"order not found"}`)
+	if w := do(http.MethodPut, "/account/Get", ""); w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != http.MethodPost {
+		t.Fatalf("bad response %d %v", w.Code, w.Header())
+	}
+	if w := do(http.MethodPost, "/account/Get", ""); w.Header().Get("X-Request-ID") == "" {
+		t.Fatalf("no request ID")
+	}
+
+	// other paths are left to JSON-RPC
+	expect(do(http.MethodPost, "/account/Missing", `{"jsonrpc":"2.0","method":"account.Close","params":[{}],"id":1}`),
+		http.StatusOK, `{"jsonrpc":"2.0","id":1,"result":true}`)
+}
+
+func Test_RESTStatus(t *testing.T) {
+	for code, status := range map[int]int{
+		-32700: http.StatusBadRequest,
+		-32601: http.StatusNotFound,
+		-32603: http.StatusInternalServerError,
+		-32001: http.StatusInternalServerError,
+		-32003: http.StatusServiceUnavailable,
+		-32004: http.StatusGatewayTimeout,
+		1001:   http.StatusUnprocessableEntity,
+	} {
+		if s := RESTStatus(code); s != status {
+			t.Fatalf("code %d: expected %d, got %d", code, status, s)
+		}
+	}
+}
+
+func Test_ReadOnlyUnknownMethod(t *testing.T) {
+	err := NewServer().RegisterName("bad", badReadOnlyService{})
+	if err == nil || !strings.Contains(err.Error(), "read-only annotation for unknown method bad.Missing") {
+		t.Fatalf("expected error for unknown read-only method, got %v", err)
+	}
+}
+
+type badReadOnlyService struct{ AccountService }
+
+func (badReadOnlyService) ReadOnlyMethods() []string { return []string{"Missing"} }
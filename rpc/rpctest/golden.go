@@ -0,0 +1,71 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package rpctest
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	requestSuffix  = ".request.json"
+	responseSuffix = ".response.json"
+)
+
+var update = flag.Bool("rpctest.update", false, "rewrite the golden responses of rpctest")
+
+// Golden runs a subtest for each file dir/<name>.request.json. It sends
+// the request and compares the reply to dir/<name>.response.json, an empty
+// file expecting no reply. Run the tests with -rpctest.update to write the
+// replies to the response files instead.
+func (s *Server) Golden(t *testing.T, dir string) {
+	t.Helper()
+	requests, err := filepath.Glob(filepath.Join(dir, "*"+requestSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) == 0 {
+		t.Fatalf("rpctest: no %s files in %s", requestSuffix, dir)
+	}
+	for _, file := range requests {
+		name := strings.TrimSuffix(filepath.Base(file), requestSuffix)
+		t.Run(name, func(t *testing.T) {
+			request, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reply, err := s.Exchange(request)
+			if err != nil {
+				t.Fatalf("rpctest: exchange: %v", err)
+			}
+
+			golden := filepath.Join(dir, name+responseSuffix)
+			if *update {
+				doc, err := canonical(reply)
+				if err != nil {
+					t.Fatalf("rpctest: bad reply %s: %v", reply, err)
+				}
+				if doc != nil {
+					doc = append(doc, '\n')
+				}
+				if err := ioutil.WriteFile(golden, doc, 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			response, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := Diff(response, reply); diff != "" {
+				t.Errorf("%s\n%s", golden, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,248 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+// Package rpctest provides in-process JSON-RPC servers and helpers to
+// test RPC services without real listeners.
+//
+//	s := rpctest.NewPipeServer(t, rpc.API{Namespace: "order", Service: new(OrderService)})
+//	var reply Order
+//	err := s.Client().Call("order.Get", &GetArgs{ID: 1}, &reply)
+//	s.AssertExchange(`{"jsonrpc":"2.0","method":"order.Get","params":[{"ID":1}],"id":1}`,
+//		`{"jsonrpc":"2.0","result":{"ID":1},"id":1}`)
+package rpctest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/justoxh/go-toolkit/rpc"
+)
+
+// Transport is the transport a Server is reached through.
+type Transport int
+
+const (
+	// Pipe connects each client through its own net.Pipe.
+	Pipe Transport = iota
+	// HTTP serves an rpc.HTTPServer with httptest.
+	HTTP
+	// WS serves an rpc.WsRPCServer with httptest.
+	WS
+)
+
+// DefaultTimeout is the time a raw exchange waits for the reply.
+const DefaultTimeout = time.Second
+
+// Server is a RPC server running in the test process. It is closed with
+// the clients it returned when the test ends.
+type Server struct {
+	// RPC is the server the APIs are registered on.
+	RPC *rpc.Server
+	// URL is the address of the HTTP or WS server, empty for Pipe.
+	URL string
+	// Timeout is the time a raw exchange waits for the reply,
+	// DefaultTimeout by default.
+	Timeout time.Duration
+
+	t         testing.TB
+	transport Transport
+	http      *httptest.Server
+
+	mutex   sync.Mutex // protects closers
+	closers []func() error
+}
+
+// NewPipeServer returns a server of apis reached through net.Pipe.
+func NewPipeServer(t testing.TB, apis ...rpc.API) *Server {
+	t.Helper()
+	return newServer(t, Pipe, rpc.NewServer(), apis)
+}
+
+// NewHTTPServer returns a server of apis reached through an httptest
+// server running rpc.HTTPServer.
+func NewHTTPServer(t testing.TB, apis ...rpc.API) *Server {
+	t.Helper()
+	handler, _ := rpc.NewHTTPServer(nil, nil)
+	s := newServer(t, HTTP, handler.GetServer(), apis)
+	s.http = httptest.NewServer(handler)
+	s.URL = s.http.URL
+	return s
+}
+
+// NewWSServer returns a server of apis reached through an httptest server
+// running rpc.WsRPCServer.
+func NewWSServer(t testing.TB, apis ...rpc.API) *Server {
+	t.Helper()
+	handler := rpc.NewWsRPCServer()
+	s := newServer(t, WS, handler.GetServer(), apis)
+	s.http = httptest.NewServer(http.HandlerFunc(handler.ServeWS))
+	s.URL = "ws" + strings.TrimPrefix(s.http.URL, "http")
+	return s
+}
+
+func newServer(t testing.TB, transport Transport, server *rpc.Server, apis []rpc.API) *Server {
+	t.Helper()
+	for _, api := range apis {
+		if err := server.RegisterName(api.Namespace, api.Service); err != nil {
+			t.Fatalf("rpctest: register %s: %v", api.Namespace, err)
+		}
+	}
+	s := &Server{RPC: server, Timeout: DefaultTimeout, t: t, transport: transport}
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Close closes the clients and connections opened by the server, then
+// the server itself.
+func (s *Server) Close() {
+	s.mutex.Lock()
+	closers := s.closers
+	s.closers = nil
+	s.mutex.Unlock()
+	for _, close := range closers {
+		close()
+	}
+	if s.http != nil {
+		s.http.Close()
+	}
+}
+
+func (s *Server) onClose(close func() error) {
+	s.mutex.Lock()
+	s.closers = append(s.closers, close)
+	s.mutex.Unlock()
+}
+
+// Client returns a new client connected to the server.
+func (s *Server) Client() *rpc.Client {
+	s.t.Helper()
+	var client *rpc.Client
+	switch s.transport {
+	case HTTP:
+		client = rpc.NewHTTPClient(s.URL, nil)
+	case WS:
+		var err error
+		if client, err = rpc.DialWebsocket(s.URL, nil); err != nil {
+			s.t.Fatalf("rpctest: dial %s: %v", s.URL, err)
+		}
+	default:
+		client = rpc.NewClient(s.pipe())
+	}
+	s.onClose(client.Close)
+	return client
+}
+
+// pipe returns the client end of a net.Pipe served by the server.
+func (s *Server) pipe() net.Conn {
+	cli, srv := net.Pipe()
+	go s.RPC.ServeCodec(rpc.NewServerCodec(srv, s.RPC))
+	s.onClose(cli.Close)
+	return cli
+}
+
+// Exchange sends the raw JSON request on a new connection and returns the
+// raw reply. The reply is empty when the server does not answer within
+// Timeout, as for notifications.
+func (s *Server) Exchange(request []byte) ([]byte, error) {
+	if s.transport == HTTP {
+		resp, err := http.Post(s.URL, "application/json", bytes.NewReader(request))
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		return ioutil.ReadAll(resp.Body)
+	}
+
+	var conn net.Conn
+	if s.transport == WS {
+		ws, _, err := websocket.DefaultDialer.Dial(s.URL, nil)
+		if err != nil {
+			return nil, err
+		}
+		conn = ws.UnderlyingConn()
+	} else {
+		conn = s.pipe()
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(s.Timeout))
+	if _, err := conn.Write(append(bytes.TrimSpace(request), '\n')); err != nil {
+		return nil, err
+	}
+	var reply json.RawMessage
+	if err := json.NewDecoder(conn).Decode(&reply); err != nil {
+		if e, ok := err.(net.Error); ok && e.Timeout() {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return reply, nil
+}
+
+// AssertExchange sends the raw JSON request and fails the test unless the
+// reply is the JSON document response. Member order and spacing are not
+// compared, an empty response expects no reply.
+func (s *Server) AssertExchange(request, response string) {
+	s.t.Helper()
+	reply, err := s.Exchange([]byte(request))
+	if err != nil {
+		s.t.Fatalf("rpctest: exchange %s: %v", request, err)
+	}
+	if diff := Diff([]byte(response), reply); diff != "" {
+		s.t.Errorf("rpctest: exchange %s\n%s", request, diff)
+	}
+}
+
+// Diff compares two JSON documents regardless of member order and spacing.
+// It returns "" if they are equal, and both documents indented otherwise.
+func Diff(want, got []byte) string {
+	w, werr := canonical(want)
+	g, gerr := canonical(got)
+	if werr == nil && gerr == nil && bytes.Equal(w, g) {
+		return ""
+	}
+	if werr != nil {
+		w = want
+	}
+	if gerr != nil {
+		g = got
+	}
+	return "want:\n" + string(w) + "\ngot:\n" + string(g)
+}
+
+// canonical returns the document indented with its members sorted. The
+// replies of a batch, which the server sends in any order, are sorted by id.
+func canonical(doc []byte) ([]byte, error) {
+	if len(bytes.TrimSpace(doc)) == 0 {
+		return nil, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if batch, ok := v.([]interface{}); ok {
+		sort.SliceStable(batch, func(i, j int) bool { return replyID(batch[i]) < replyID(batch[j]) })
+	}
+	return json.MarshalIndent(v, "", "  ")
+}
+
+func replyID(reply interface{}) string {
+	if m, ok := reply.(map[string]interface{}); ok {
+		id, _ := json.Marshal(m["id"])
+		return string(id)
+	}
+	return ""
+}
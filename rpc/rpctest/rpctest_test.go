@@ -0,0 +1,80 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package rpctest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/justoxh/go-toolkit/rpc"
+)
+
+type Args struct {
+	A, B int
+}
+
+type Arith struct{}
+
+func (Arith) Add(args *Args, reply *int) error {
+	*reply = args.A + args.B
+	return nil
+}
+
+func (Arith) Div(args *Args, reply *int) error {
+	if args.B == 0 {
+		return errors.New("divide by zero")
+	}
+	*reply = args.A / args.B
+	return nil
+}
+
+var arith = rpc.API{Namespace: "arith", Service: Arith{}}
+
+func Test_Servers(t *testing.T) {
+	for name, newServer := range map[string]func(testing.TB, ...rpc.API) *Server{
+		"pipe": NewPipeServer,
+		"http": NewHTTPServer,
+		"ws":   NewWSServer,
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := newServer(t, arith)
+			s.Timeout = 100 * time.Millisecond
+			client := s.Client()
+			var reply int
+			if err := client.Call("arith.Add", &Args{1, 2}, &reply); err != nil || reply != 3 {
+				t.Fatalf("bad reply %d: %v", reply, err)
+			}
+			err := rpc.TypedError(client.Call("arith.Div", &Args{1, 0}, &reply))
+			if e, ok := err.(*rpc.Error); !ok || e.Message != "divide by zero" {
+				t.Fatalf("bad error %v", err)
+			}
+
+			s.AssertExchange(`{"jsonrpc":"2.0","method":"arith.Add","params":[{"A":2,"B":3}],"id":7}`,
+				`{"id":7, "result":5, "jsonrpc":"2.0"}`)
+			s.AssertExchange(`{"jsonrpc":"2.0","method":"arith.Add","params":[{"A":2,"B":3}]}`, ``)
+		})
+	}
+}
+
+func Test_Diff(t *testing.T) {
+	if d := Diff([]byte(`{"a":1,"b":[1,2]}`), []byte(`{ "b":[1,2], "a":1 }`)); d != "" {
+		t.Fatalf("unexpected diff %s", d)
+	}
+	if d := Diff([]byte(`{"a":1}`), []byte(`{"a":1.0}`)); d == "" {
+		t.Fatalf("expected diff of numbers")
+	}
+	if d := Diff([]byte(`[{"id":1},{"id":2}]`), []byte(`[{"id":2},{"id":1}]`)); d != "" {
+		t.Fatalf("unexpected diff of batch order %s", d)
+	}
+	if d := Diff(nil, []byte(`{}`)); d == "" {
+		t.Fatalf("expected diff of a missing reply")
+	}
+}
+
+func Test_Golden(t *testing.T) {
+	NewPipeServer(t, arith).Golden(t, "testdata")
+}
@@ -6,15 +6,38 @@
 package rpc
 
 import (
+	"context"
+	stdlog "log"
 	"net/rpc"
+	"sort"
+	"sync"
+
+	"github.com/justoxh/go-toolkit/log"
 )
 
 // MetadataAPI is a default service for RegisterName.
 const MetadataAPI = "rpc"
 
-// Server represents a RPC server
+// Server represents a RPC server. It no longer embeds net/rpc.Server, whose
+// dispatcher it forks, but it keeps its methods: Register, RegisterName,
+// Accept, ServeConn, ServeCodec, ServeRequest, ServeHTTP and HandleHTTP. The
+// services which were registered on the embedded Server field are
+// registered on the Server itself.
 type Server struct {
-	rpc.Server
+	serviceMap sync.Map // map[string]*service
+	log        log.Logger
+	cache      CacheStore // nil if responses are not cached
+	recorder   *Recorder  // nil if traffic is not captured
+	jsonrpc1   bool       // JSON-RPC 1.0 requests are accepted
+
+	netrpc *rpc.Server // serves the services the server lacks, nil if none
+
+	idempotency *idempotencyStore // nil until SetIdempotencyStore
+	versions    versions          // of the namespaces registered by RegisterAPI
+	accessLog   *accessLog        // nil if calls are not logged
+
+	limitsMutex sync.RWMutex        // protects limits
+	limits      map[string]*limiter // by namespace or method
 }
 
 // API is a collection of methods for the RPC interface.
@@ -30,20 +53,99 @@ type API struct {
 }
 
 // RPCService offers meta information of the server.
-//type RPCService struct {
-//	server *Server
-//}
+type RPCService struct {
+	server *Server
+}
+
+// MethodInfo describes a registered method.
+type MethodInfo struct {
+	Name       string `json:"name"`
+	Params     string `json:"params"`
+	Reply      string `json:"reply"`
+	ReadOnly   bool   `json:"readOnly,omitempty"`
+	Version    string `json:"version,omitempty"`
+	Deprecated bool   `json:"deprecated,omitempty"`
+}
+
+// Methods returns the methods registered on the server, sorted by name.
+// The methods of a versioned namespace are named with their version
+// suffix. The internal batch methods are left out.
+func (s *RPCService) Methods(args *struct{}, reply *[]MethodInfo) error {
+	methods := []MethodInfo{}
+	s.server.serviceMap.Range(func(name, svci interface{}) bool {
+		svc := svci.(*service)
+		if svc.version != "" && name.(string) == svc.name {
+			// the default version, listed under its own name
+			return true
+		}
+		for mname, mtype := range svc.method {
+			serviceMethod := svc.name + "." + mname
+			if isBatchMethod(serviceMethod) {
+				continue
+			}
+			if svc.version != "" {
+				serviceMethod += versionSep + svc.version
+			}
+			methods = append(methods, MethodInfo{
+				Name:       serviceMethod,
+				Params:     mtype.ArgType.String(),
+				Reply:      mtype.ReplyType.Elem().String(),
+				ReadOnly:   mtype.readOnly,
+				Version:    svc.version,
+				Deprecated: mtype.deprecated,
+			})
+		}
+		return true
+	})
+	sort.Slice(methods, func(i, j int) bool { return methods[i].Name < methods[j].Name })
+	*reply = methods
+	return nil
+}
+
+// Unsubscribe ends the subscription id created on the connection.
+func (s *RPCService) Unsubscribe(ctx context.Context, id *string, reply *bool) error {
+	n, ok := NotifierFromContext(ctx)
+	if !ok {
+		return ErrNotificationsUnsupported
+	}
+	if !n.subs.unsubscribe(*id) {
+		return ErrSubscriptionNotFound
+	}
+	*reply = true
+	return nil
+}
 
 // NewServer returns a new Server.
 func NewServer() *Server {
-	server := &Server{
-		rpc.Server{},
-	}
+	server := &Server{}
 
-	// Not implemented service
 	// register a default service which will provide meta information about the RPC service.
-	//rpcService := &RPCService{server}
-	//server.RegisterName(MetadataAPI, rpcService)
+	rpcService := &RPCService{server}
+	server.RegisterName(MetadataAPI, rpcService)
 
 	return server
 }
+
+// SetLogger sets the logger used to report recovered panics and other
+// failures which can not be returned to the caller.
+func (server *Server) SetLogger(l log.Logger) {
+	server.log = l
+}
+
+// logError logs through the server logger, or the standard logger if none is set.
+func (server *Server) logError(f interface{}, args ...interface{}) {
+	if server.log != nil {
+		server.log.Error(f, args...)
+		return
+	}
+	stdlog.Println(append([]interface{}{f}, args...)...)
+}
+
+// logWarn logs through the server logger, or the standard logger if none is set.
+func (server *Server) logWarn(f interface{}, args ...interface{}) {
+	if server.log != nil {
+		server.log.Warn(f, args...)
+		return
+	}
+	stdlog.Println(append([]interface{}{f}, args...)...)
+}
@@ -6,6 +6,14 @@
 package rpc
 
 import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/rpc"
+	"strings"
 	"testing"
 )
 
@@ -36,3 +44,139 @@ func Test_Server_RegisterName(t *testing.T) {
 		t.Fatalf("%v", err)
 	}
 }
+
+func Test_Server_RecoverPanic(t *testing.T) {
+	server := NewServer()
+	server.Register(new(Arith))
+	cli, srv := net.Pipe()
+	defer cli.Close()
+	go server.ServeCodec(NewServerCodec(srv, server))
+	dec := json.NewDecoder(cli)
+	panics := PanicCount()
+
+	fmt.Fprintf(cli, `{"jsonrpc":"2.0","method":"Arith.Error","id":1,"params":[{"A":1,"B":2}]}`)
+	var resp struct {
+		ID    int    `json:"id"`
+		Error *Error `json:"error"`
+	}
+	if err := dec.Decode(&resp); err != nil {
+		t.Fatalf("Decode: %s", err)
+	}
+	if resp.Error == nil || resp.Error.Code != errInternal.Code {
+		t.Fatalf("expected internal error, got %v", resp.Error)
+	}
+	if PanicCount() != panics+1 {
+		t.Fatalf("panic count not increased")
+	}
+
+	// The connection keeps serving, including batches with a panicking call.
+	fmt.Fprintf(cli, `[{"jsonrpc":"2.0","method":"Arith.Error","id":2,"params":[{"A":1,"B":2}]},`+
+		`{"jsonrpc":"2.0","method":"Arith.Add","id":3,"params":[{"A":1,"B":2}]}]`)
+	var replies []ArithAddResp
+	if err := dec.Decode(&replies); err != nil {
+		t.Fatalf("Decode batch: %s", err)
+	}
+	if len(replies) != 2 {
+		t.Fatalf("expected 2 replies, got %v", replies)
+	}
+	for _, reply := range replies {
+		if reply.ID.(float64) == 3 && reply.Result.C != 3 {
+			t.Fatalf("bad result %v", reply)
+		}
+		if reply.ID.(float64) == 2 && reply.Error == nil {
+			t.Fatalf("expected error %v", reply)
+		}
+	}
+}
+
+func Test_Server_NullID(t *testing.T) {
+	cli, srv := net.Pipe()
+	defer cli.Close()
+	go ServeConn(srv)
+	dec := json.NewDecoder(cli)
+
+	// unlike a notification, a request with a null id gets a response
+	fmt.Fprintf(cli, `{"jsonrpc":"2.0","method":"Arith.Add","id":null,"params":[{"A":1,"B":2}]}`)
+	var resp map[string]json.RawMessage
+	if err := dec.Decode(&resp); err != nil {
+		t.Fatalf("Decode: %s", err)
+	}
+	if id, ok := resp["id"]; !ok || string(id) != "null" || string(resp["result"]) != `{"C":3}` {
+		t.Fatalf("bad response %s %s", resp["id"], resp["result"])
+	}
+}
+
+func Test_Server_NotificationNoReply(t *testing.T) {
+	cli, srv := net.Pipe()
+	go ServeConn(srv)
+	client := NewClient(cli)
+	defer client.Close()
+
+	if err := client.Notify("Arith.Add", &Args{1, 2}); err != nil {
+		t.Fatalf("Notify: %s", err)
+	}
+	// A reply to the notification would shut the client down.
+	var reply Reply
+	if err := client.Call("Arith.Add", &Args{1, 2}, &reply); err != nil || reply.C != 3 {
+		t.Fatalf("Call after Notify: %v %v", reply, err)
+	}
+}
+
+func Test_Server_Methods(t *testing.T) {
+	server := NewServer()
+	server.RegisterName("test", new(Service))
+	server.RegisterName("account", AccountService{})
+	cli, srv := net.Pipe()
+	go server.ServeCodec(NewServerCodec(srv, server))
+	client := NewClient(cli)
+	defer client.Close()
+
+	var methods []MethodInfo
+	if err := client.Call(MetadataAPI+".Methods", nil, &methods); err != nil {
+		t.Fatal(err)
+	}
+	expected := []MethodInfo{
+		{Name: "account.Close", Params: "*rpc.AccountArgs", Reply: "bool"},
+		{Name: "account.Get", Params: "*rpc.AccountArgs", Reply: "rpc.Account", ReadOnly: true},
+		{Name: "rpc.Methods", Params: "*struct {}", Reply: "[]rpc.MethodInfo"},
+		{Name: "rpc.Unsubscribe", Params: "*string", Reply: "bool"},
+		{Name: "test.Func1", Params: "*rpc.ArgsServer", Reply: "rpc.Result"},
+	}
+	if fmt.Sprint(methods) != fmt.Sprint(expected) {
+		t.Fatalf("expected %v, got %v", expected, methods)
+	}
+}
+
+func Test_Server_Accept(t *testing.T) {
+	server := NewServer()
+	server.Register(new(Arith))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go server.Accept(l)
+
+	// net/rpc clients call the server with gob
+	client, err := rpc.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	var reply Reply
+	if err := client.Call("Arith.Add", &Args{1, 2}, &reply); err != nil || reply.C != 3 {
+		t.Fatalf("bad reply %d: %v", reply.C, err)
+	}
+
+	ts := httptest.NewServer(debugHTTP{server})
+	defer ts.Close()
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	page, _ := ioutil.ReadAll(resp.Body)
+	if !strings.Contains(string(page), "Service Arith") || !strings.Contains(string(page), "<td align=center>1</td>") {
+		t.Fatalf("bad debug page %s", page)
+	}
+}
@@ -0,0 +1,593 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/gob"
+	"errors"
+	"go/token"
+	"io"
+	"net"
+	"net/http"
+	"net/rpc"
+	"reflect"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/justoxh/go-toolkit/trace"
+)
+
+// The dispatcher below is derived from package net/rpc. Unlike net/rpc it
+// keeps the error value returned by a method, so typed application errors
+// can be turned into JSON-RPC error objects before they reach the codec,
+// and it passes a context.Context to the methods which accept one.
+
+// Precompute the reflect types for error and context.Context.
+var (
+	typeOfError   = reflect.TypeOf((*error)(nil)).Elem()
+	typeOfContext = reflect.TypeOf((*context.Context)(nil)).Elem()
+)
+
+type methodType struct {
+	sync.Mutex  // protects counters
+	method      reflect.Method
+	ArgType     reflect.Type
+	ReplyType   reflect.Type
+	withContext bool          // the first argument is a context.Context
+	cacheTTL    time.Duration // results are cached if > 0
+	readOnly    bool          // the method does not change any state
+	validated   bool          // the params have validate tags
+	idempotent  bool          // calls require an idempotency key
+	deprecated  bool          // calls are warned and counted
+	deprecation string        // note of the warning
+	numCalls    uint
+}
+
+// NumCalls returns the number of calls of the method.
+func (m *methodType) NumCalls() (n uint) {
+	m.Lock()
+	n = m.numCalls
+	m.Unlock()
+	return n
+}
+
+type service struct {
+	name    string                 // name of service
+	version string                 // API version, empty if unversioned
+	rcvr    reflect.Value          // receiver of methods for the service
+	typ     reflect.Type           // type of the receiver
+	method  map[string]*methodType // registered methods
+}
+
+// isExportedOrBuiltinType reports whether t is an exported or builtin type
+func isExportedOrBuiltinType(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	// PkgPath will be non-empty even for an exported type,
+	// so we need to check the type name as well.
+	return token.IsExported(t.Name()) || t.PkgPath() == ""
+}
+
+// Register publishes in the server the set of methods of the
+// receiver value that satisfy the following conditions:
+//   - exported method of exported type
+//   - two arguments, both of exported type
+//   - the second argument is a pointer
+//   - one return value, of type error
+//
+// The two arguments may be preceded by a context.Context, which carries
+// the request ID and the trace context of the call. A receiver which
+// implements Cacheable gets the results of its annotated methods cached,
+// one which implements ReadOnly gets its annotated methods served by GET
+// on the REST routes, and one which implements Deprecated gets the calls of
+// its annotated methods warned and counted.
+//
+// It returns an error if the receiver is not an exported type or has
+// no suitable methods.
+// The client accesses each method using a string of the form "Type.Method",
+// where Type is the receiver's concrete type.
+func (server *Server) Register(rcvr interface{}) error {
+	return server.register(rcvr, "", "", false)
+}
+
+// RegisterName is like Register but uses the provided name for the type
+// instead of the receiver's concrete type.
+func (server *Server) RegisterName(name string, rcvr interface{}) error {
+	return server.register(rcvr, name, "", true)
+}
+
+func (server *Server) register(rcvr interface{}, name, version string, useName bool) error {
+	s := new(service)
+	s.typ = reflect.TypeOf(rcvr)
+	s.rcvr = reflect.ValueOf(rcvr)
+	sname := reflect.Indirect(s.rcvr).Type().Name()
+	if useName {
+		sname = name
+	}
+	if sname == "" {
+		return errors.New("rpc.Register: no service name for type " + s.typ.String())
+	}
+	if !token.IsExported(sname) && !useName {
+		return errors.New("rpc.Register: type " + sname + " is not exported")
+	}
+	s.name = sname
+	s.version = version
+
+	// Install the methods
+	s.method = suitableMethods(s.typ)
+
+	if len(s.method) == 0 {
+		// To help the user, see if a pointer receiver would work.
+		method := suitableMethods(reflect.PtrTo(s.typ))
+		if len(method) != 0 {
+			return errors.New("rpc.Register: type " + sname + " has no exported methods of suitable type (hint: pass a pointer to value of that type)")
+		}
+		return errors.New("rpc.Register: type " + sname + " has no exported methods of suitable type")
+	}
+
+	if c, ok := rcvr.(Cacheable); ok {
+		for name, ttl := range c.CacheTTL() {
+			mtype := s.method[name]
+			if mtype == nil {
+				return errors.New("rpc.Register: cache annotation for unknown method " + sname + "." + name)
+			}
+			mtype.cacheTTL = ttl
+			mtype.readOnly = true
+		}
+	}
+	if r, ok := rcvr.(ReadOnly); ok {
+		for _, name := range r.ReadOnlyMethods() {
+			mtype := s.method[name]
+			if mtype == nil {
+				return errors.New("rpc.Register: read-only annotation for unknown method " + sname + "." + name)
+			}
+			mtype.readOnly = true
+		}
+	}
+	if i, ok := rcvr.(Idempotent); ok {
+		for _, name := range i.IdempotentMethods() {
+			mtype := s.method[name]
+			if mtype == nil {
+				return errors.New("rpc.Register: idempotent annotation for unknown method " + sname + "." + name)
+			}
+			mtype.idempotent = true
+		}
+	}
+	if d, ok := rcvr.(Deprecated); ok {
+		for name, note := range d.DeprecatedMethods() {
+			mtype := s.method[name]
+			if mtype == nil {
+				return errors.New("rpc.Register: deprecated annotation for unknown method " + sname + "." + name)
+			}
+			mtype.deprecated = true
+			mtype.deprecation = note
+		}
+	}
+	for name, mtype := range s.method {
+		rules, err := typeRules(mtype.ArgType)
+		if err != nil {
+			return errors.New("rpc.Register: params of " + sname + "." + name + ": " + err.Error())
+		}
+		for _, warning := range unknownRules(mtype.ArgType, make(map[reflect.Type]bool)) {
+			server.logWarn("rpc.Register: params of "+sname+"."+name, "warning", warning)
+		}
+		mtype.validated = rules != nil
+	}
+
+	key := sname
+	if version != "" {
+		key += versionSep + version
+	}
+	if _, dup := server.serviceMap.LoadOrStore(key, s); dup {
+		return errors.New("rpc: service already defined: " + key)
+	}
+	if version != "" {
+		return server.registerVersion(s)
+	}
+	return nil
+}
+
+// suitableMethods returns suitable Rpc methods of typ.
+func suitableMethods(typ reflect.Type) map[string]*methodType {
+	methods := make(map[string]*methodType)
+	for m := 0; m < typ.NumMethod(); m++ {
+		method := typ.Method(m)
+		mtype := method.Type
+		// Method must be exported.
+		if method.PkgPath != "" {
+			continue
+		}
+		// Method needs three ins: receiver, *args, *reply,
+		// or four when the first one is a context.Context.
+		in := 1
+		if mtype.NumIn() == 4 && mtype.In(1) == typeOfContext {
+			in = 2
+		} else if mtype.NumIn() != 3 {
+			continue
+		}
+		// First arg need not be a pointer.
+		argType := mtype.In(in)
+		if !isExportedOrBuiltinType(argType) {
+			continue
+		}
+		// Second arg must be a pointer.
+		replyType := mtype.In(in + 1)
+		if replyType.Kind() != reflect.Ptr {
+			continue
+		}
+		// Reply type must be exported.
+		if !isExportedOrBuiltinType(replyType) {
+			continue
+		}
+		// Method needs one out.
+		if mtype.NumOut() != 1 {
+			continue
+		}
+		// The return type of the method must be error.
+		if returnType := mtype.Out(0); returnType != typeOfError {
+			continue
+		}
+		methods[method.Name] = &methodType{method: method, ArgType: argType, ReplyType: replyType, withContext: in == 2}
+	}
+	return methods
+}
+
+// A value sent as a placeholder for the server's response value when the server
+// receives an invalid request. It is never decoded by the client since the Response
+// contains an error when it is used.
+var invalidRequest = struct{}{}
+
+func (server *Server) sendResponse(sending *sync.Mutex, req *rpc.Request, reply interface{}, codec rpc.ServerCodec, errmsg string) {
+	resp := new(rpc.Response)
+	// Encode the response header
+	resp.ServiceMethod = req.ServiceMethod
+	if errmsg != "" {
+		resp.Error = errmsg
+		reply = invalidRequest
+	}
+	resp.Seq = req.Seq
+	sending.Lock()
+	codec.WriteResponse(resp, reply)
+	sending.Unlock()
+}
+
+func (s *service) call(ctx context.Context, server *Server, sending *sync.Mutex, wg *sync.WaitGroup, mtype *methodType, req *rpc.Request, argv, replyv reflect.Value, codec rpc.ServerCodec) {
+	if wg != nil {
+		defer wg.Done()
+	}
+	mtype.Lock()
+	mtype.numCalls++
+	mtype.Unlock()
+	ctx = withNotifier(ctx, s.name)
+	start := time.Now()
+	if mtype.deprecated {
+		server.warnDeprecated(ctx, codec, req.Seq, req.ServiceMethod, mtype.deprecation)
+	}
+	var errmsg string
+	running := false // the method timed out but still runs
+	if mtype.validated {
+		errmsg = validateParams(argv)
+	}
+	if errmsg == "" {
+		errmsg = server.cachedCall(mtype, req.ServiceMethod, argv, replyv, func() (errmsg string) {
+			errmsg, running = server.limitedCall(ctx, req.ServiceMethod, func(ctx context.Context) string {
+				return server.idempotentCall(ctx, mtype, req.ServiceMethod, argv, replyv, func() string {
+					return server.invoke(ctx, mtype, req, s.rcvr, argv, replyv)
+				})
+			})
+			return errmsg
+		})
+	}
+	if running {
+		// argv and replyv are the method's, they are neither recorded nor logged
+		server.logAccess(ctx, req.ServiceMethod, start, reflect.Value{}, reflect.Value{}, errmsg)
+	} else {
+		if server.recorder != nil {
+			if err := server.recorder.record(ctx, req.ServiceMethod, start, argv, replyv, errmsg); err != nil {
+				server.logError("rpc capture", "method", req.ServiceMethod, "error", err.Error())
+			}
+		}
+		server.logAccess(ctx, req.ServiceMethod, start, argv, replyv, errmsg)
+	}
+	server.sendResponse(sending, req, replyv.Interface(), codec, errmsg)
+	if notifier, ok := NotifierFromContext(ctx); ok {
+		notifier.release()
+	}
+}
+
+// invoke calls the method and returns the text of its error, if any.
+// A panic in the method is recovered and reported as an internal error
+// of this call only.
+func (server *Server) invoke(ctx context.Context, mtype *methodType, req *rpc.Request, rcvr, argv, replyv reflect.Value) (errmsg string) {
+	defer func() {
+		if r := recover(); r != nil {
+			Metrics.Add(metricPanics, 1)
+			server.logError("rpc method panic", "method", req.ServiceMethod, "request_id", trace.RequestID(ctx), "panic", r, "stack", string(debug.Stack()))
+			errmsg = errInternal.Error()
+		}
+	}()
+
+	function := mtype.method.Func
+	// Invoke the method, providing a new value for the reply.
+	in := []reflect.Value{rcvr, argv, replyv}
+	if mtype.withContext {
+		in = []reflect.Value{rcvr, reflect.ValueOf(ctx), argv, replyv}
+	}
+	returnValues := function.Call(in)
+	// The return value for the method is an error.
+	if errInter := returnValues[0].Interface(); errInter != nil {
+		return errorMessage(errInter.(error))
+	}
+	return ""
+}
+
+// ServeCodec uses the specified codec to decode requests and encode responses.
+// ServeCodec blocks, serving the connection until the client hangs up.
+func (server *Server) ServeCodec(codec rpc.ServerCodec) {
+	server.ServeCodecContext(context.Background(), codec)
+}
+
+// ServeCodecContext is like ServeCodec but derives the context of every call
+// from ctx, typically carrying values taken from the transport.
+func (server *Server) ServeCodecContext(ctx context.Context, codec rpc.ServerCodec) {
+	sending := new(sync.Mutex)
+	wg := new(sync.WaitGroup)
+	for {
+		callCtx, service, mtype, req, argv, replyv, keepReading, err := server.readRequest(ctx, codec)
+		if err != nil {
+			if !keepReading {
+				break
+			}
+			if err == errNetRPC {
+				server.serveNetRPC(callCtx, sending, wg, req, codec)
+				continue
+			}
+			// send a response if we actually managed to read a header.
+			if req != nil {
+				server.logAccess(callCtx, req.ServiceMethod, time.Now(), reflect.Value{}, reflect.Value{}, err.Error())
+				server.sendResponse(sending, req, invalidRequest, codec, err.Error())
+			}
+			continue
+		}
+		wg.Add(1)
+		go service.call(callCtx, server, sending, wg, mtype, req, argv, replyv, codec)
+	}
+	// We've seen that there are no more requests.
+	// Wait for responses to be sent before closing codec.
+	wg.Wait()
+	codec.Close()
+}
+
+// ServeRequest is like ServeCodec but synchronously serves a single request.
+// It does not close the codec upon completion.
+func (server *Server) ServeRequest(codec rpc.ServerCodec) error {
+	return server.ServeRequestContext(context.Background(), codec)
+}
+
+// ServeRequestContext is like ServeRequest but derives the context of the
+// call from ctx.
+func (server *Server) ServeRequestContext(ctx context.Context, codec rpc.ServerCodec) error {
+	sending := new(sync.Mutex)
+	callCtx, service, mtype, req, argv, replyv, keepReading, err := server.readRequest(ctx, codec)
+	if err != nil {
+		if !keepReading {
+			return err
+		}
+		if err == errNetRPC {
+			server.serveNetRPC(callCtx, sending, nil, req, codec)
+			return nil
+		}
+		// send a response if we actually managed to read a header.
+		if req != nil {
+			server.logAccess(callCtx, req.ServiceMethod, time.Now(), reflect.Value{}, reflect.Value{}, err.Error())
+			server.sendResponse(sending, req, invalidRequest, codec, err.Error())
+		}
+		return err
+	}
+	service.call(callCtx, server, sending, nil, mtype, req, argv, replyv, codec)
+	return nil
+}
+
+func (server *Server) readRequest(ctx context.Context, codec rpc.ServerCodec) (callCtx context.Context, service *service, mtype *methodType, req *rpc.Request, argv, replyv reflect.Value, keepReading bool, err error) {
+	callCtx, service, mtype, req, keepReading, err = server.readRequestHeader(ctx, codec)
+	if err != nil {
+		if !keepReading {
+			return
+		}
+		if service == nil && server.netrpc != nil && strings.HasPrefix(err.Error(), "rpc: can't find service") {
+			// the body is read by the net/rpc server
+			err = errNetRPC
+			return
+		}
+		// discard body
+		codec.ReadRequestBody(nil)
+		return
+	}
+
+	// Decode the argument value.
+	argIsValue := false // if true, need to indirect before calling.
+	if mtype.ArgType.Kind() == reflect.Ptr {
+		argv = reflect.New(mtype.ArgType.Elem())
+	} else {
+		argv = reflect.New(mtype.ArgType)
+		argIsValue = true
+	}
+	// argv guaranteed to be a pointer now.
+	if err = codec.ReadRequestBody(argv.Interface()); err != nil {
+		return
+	}
+	if argIsValue {
+		argv = argv.Elem()
+	}
+
+	replyv = reflect.New(mtype.ReplyType.Elem())
+
+	switch mtype.ReplyType.Elem().Kind() {
+	case reflect.Map:
+		replyv.Elem().Set(reflect.MakeMap(mtype.ReplyType.Elem()))
+	case reflect.Slice:
+		replyv.Elem().Set(reflect.MakeSlice(mtype.ReplyType.Elem(), 0, 0))
+	}
+	return
+}
+
+func (server *Server) readRequestHeader(ctx context.Context, codec rpc.ServerCodec) (callCtx context.Context, svc *service, mtype *methodType, req *rpc.Request, keepReading bool, err error) {
+	// Grab the request header.
+	req = new(rpc.Request)
+	err = codec.ReadRequestHeader(req)
+	if err != nil {
+		req = nil
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return
+		}
+		err = errors.New("rpc: server cannot decode request: " + err.Error())
+		return
+	}
+	callCtx = requestContext(ctx, codec)
+
+	// We read the header successfully. If we see an error now,
+	// we can still recover and move on to the next request.
+	keepReading = true
+
+	// Look up the request, under the name of its version.
+	var serviceMethod string
+	serviceMethod, svc, mtype, err = server.resolveMethod(req.ServiceMethod, versionFromContext(callCtx))
+	if err == nil {
+		req.ServiceMethod = serviceMethod
+	}
+	return
+}
+
+// requestContext returns the context of the request just read by codec.
+// Metadata sent in the request envelope overrides the values of ctx, and a
+// request ID is generated when neither of them carries one.
+func requestContext(ctx context.Context, codec rpc.ServerCodec) context.Context {
+	if mc, ok := codec.(metaCodec); ok {
+		if meta := mc.requestMeta(); meta != nil {
+			if meta.RequestID != "" {
+				ctx = trace.WithRequestID(ctx, meta.RequestID)
+			}
+			if trace.ValidTraceParent(meta.TraceParent) {
+				ctx = trace.WithTraceParent(ctx, meta.TraceParent)
+			}
+		}
+	}
+	if trace.RequestID(ctx) == "" {
+		ctx = trace.WithRequestID(ctx, trace.NewRequestID())
+	}
+	return ctx
+}
+
+// Accept accepts connections on the listener and serves requests
+// for each incoming connection. Accept blocks until the listener
+// returns a non-nil error. The caller typically invokes Accept in a
+// go statement.
+func (server *Server) Accept(lis net.Listener) {
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			server.logError("rpc.Serve: accept", "error", err.Error())
+			return
+		}
+		go server.ServeConn(conn)
+	}
+}
+
+// ServeConn runs the server on a single connection, with the gob wire
+// format of net/rpc clients. ServeConn blocks, serving the connection until
+// the client hangs up. The caller typically invokes ServeConn in a go
+// statement.
+func (server *Server) ServeConn(conn io.ReadWriteCloser) {
+	server.ServeCodec(newGobServerCodec(conn))
+}
+
+type gobServerCodec struct {
+	rwc    io.ReadWriteCloser
+	dec    *gob.Decoder
+	enc    *gob.Encoder
+	encBuf *bufio.Writer
+	closed bool
+}
+
+func newGobServerCodec(conn io.ReadWriteCloser) *gobServerCodec {
+	buf := bufio.NewWriter(conn)
+	return &gobServerCodec{
+		rwc:    conn,
+		dec:    gob.NewDecoder(conn),
+		enc:    gob.NewEncoder(buf),
+		encBuf: buf,
+	}
+}
+
+func (c *gobServerCodec) ReadRequestHeader(r *rpc.Request) error {
+	return c.dec.Decode(r)
+}
+
+func (c *gobServerCodec) ReadRequestBody(body interface{}) error {
+	return c.dec.Decode(body)
+}
+
+func (c *gobServerCodec) WriteResponse(r *rpc.Response, body interface{}) (err error) {
+	if err = c.enc.Encode(r); err != nil {
+		if c.encBuf.Flush() == nil {
+			// Gob couldn't encode the header. Should not happen, so if it does,
+			// shut down the connection to signal that the connection is broken.
+			c.Close()
+		}
+		return
+	}
+	if err = c.enc.Encode(body); err != nil {
+		if c.encBuf.Flush() == nil {
+			// Was a gob problem encoding the body but the header has been written.
+			// Shut down the connection to signal that the connection is broken.
+			c.Close()
+		}
+		return
+	}
+	return c.encBuf.Flush()
+}
+
+func (c *gobServerCodec) Close() error {
+	if c.closed {
+		// Only call c.rwc.Close once; otherwise the semantics are undefined.
+		return nil
+	}
+	c.closed = true
+	return c.rwc.Close()
+}
+
+// Can connect to RPC service using HTTP CONNECT to rpcPath.
+var connected = "200 Connected to Go RPC"
+
+// ServeHTTP implements an http.Handler that answers RPC requests from
+// net/rpc clients, which use CONNECT and the gob wire format.
+func (server *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodConnect {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		io.WriteString(w, "405 must CONNECT\n")
+		return
+	}
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		server.logError("rpc hijacking", "remote", req.RemoteAddr, "error", err.Error())
+		return
+	}
+	io.WriteString(conn, "HTTP/1.0 "+connected+"\n\n")
+	server.ServeCodecContext(WithTransport(context.Background(), TransportConnect, req.RemoteAddr), newGobServerCodec(conn))
+}
+
+// HandleHTTP registers an HTTP handler for RPC messages on rpcPath,
+// and a debugging handler on debugPath.
+// It is still necessary to invoke http.Serve(), typically in a go statement.
+func (server *Server) HandleHTTP(rpcPath, debugPath string) {
+	http.Handle(rpcPath, server)
+	http.Handle(debugPath, debugHTTP{server})
+}
@@ -0,0 +1,327 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/justoxh/go-toolkit/trace"
+)
+
+// SSEOptions configures the Server-Sent Events endpoint of an HTTPServer.
+type SSEOptions struct {
+	Path          string        // path of the endpoint
+	Heartbeat     time.Duration // interval of the comments keeping a stream open
+	Buffer        int           // events kept by each subscription to resume its stream
+	ResumeTimeout time.Duration // time a subscription outlives its stream, waiting to be resumed
+}
+
+func defaultSSEOptions() *SSEOptions {
+	return &SSEOptions{
+		Path:          "/events",
+		Heartbeat:     15 * time.Second,
+		Buffer:        128,
+		ResumeTimeout: 30 * time.Second,
+	}
+}
+
+// EnableSSE serves the subscription methods as Server-Sent Events, for the
+// clients which can not use WebSocket. A subscription is opened at
+// options.Path with the method in the query, and its params as for the
+// REST routes: the query string of a GET, or the JSON body of a POST.
+//
+//	GET /events?method=price.Watch&symbol=BTC
+//
+// The reply is a text/event-stream of the notifications, each with the
+// SubscriptionResult as data, and the subscription ID and a sequence number
+// as event ID. A call which fails, or does not create a subscription, is
+// answered as a REST call instead.
+//
+// When the stream breaks, the subscription lives on for ResumeTimeout and
+// keeps its last Buffer events, so that a client reconnecting with the
+// Last-Event-ID header, as EventSource does, gets the events it missed. It
+// is ended otherwise.
+func (server *HTTPServer) EnableSSE(options *SSEOptions) {
+	def := defaultSSEOptions()
+	if options == nil {
+		options = def
+	}
+	hub := &sseHub{options: *options, streams: make(map[string]*sseStream)}
+	o := &hub.options
+	if o.Path == "" {
+		o.Path = def.Path
+	}
+	if o.Heartbeat <= 0 {
+		o.Heartbeat = def.Heartbeat
+	}
+	if o.Buffer <= 0 {
+		o.Buffer = def.Buffer
+	}
+	if o.ResumeTimeout <= 0 {
+		o.ResumeTimeout = def.ResumeTimeout
+	}
+	server.sse = hub
+}
+
+// sseHub holds the subscriptions opened on the SSE endpoint.
+type sseHub struct {
+	options SSEOptions
+
+	mutex   sync.Mutex // protects streams
+	streams map[string]*sseStream
+}
+
+type sseEvent struct {
+	seq  uint64
+	data []byte
+}
+
+// sseStream is the stream of the notifications of a subscription. It
+// outlives the responses it is written to, so that it can be resumed.
+type sseStream struct {
+	id   string
+	hub  *sseHub
+	subs *subscriptions
+
+	mutex   sync.Mutex    // protects the fields below
+	events  []sseEvent    // the last events, at most Buffer
+	seq     uint64        // of the last event
+	changed chan struct{} // closed by a new event or the end of the stream
+	reader  chan struct{} // closed when another response resumes the stream
+	timer   *time.Timer   // ends the stream, while no response reads it
+	ended   bool
+}
+
+func (hub *sseHub) newStream() *sseStream {
+	s := &sseStream{hub: hub, changed: make(chan struct{})}
+	s.subs = newSubscriptions(s.push)
+	return s
+}
+
+// lookup returns the stream of the Last-Event-ID lastEventID, and the
+// sequence number of that event.
+func (hub *sseHub) lookup(lastEventID string) (*sseStream, uint64) {
+	colon := strings.LastIndex(lastEventID, ":")
+	if colon < 0 {
+		return nil, 0
+	}
+	seq, err := strconv.ParseUint(lastEventID[colon+1:], 10, 64)
+	if err != nil {
+		return nil, 0
+	}
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	return hub.streams[lastEventID[:colon]], seq
+}
+
+func (s *sseStream) push(method string, res *SubscriptionResult) error {
+	data, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.ended {
+		return ErrSubscriptionNotFound
+	}
+	if len(s.events) == s.hub.options.Buffer {
+		copy(s.events, s.events[1:])
+		s.events = s.events[:len(s.events)-1]
+	}
+	s.seq++
+	s.events = append(s.events, sseEvent{seq: s.seq, data: data})
+	close(s.changed)
+	s.changed = make(chan struct{})
+	return nil
+}
+
+// since returns the events after seq, and the channel closed by the next
+// change of the stream.
+func (s *sseStream) since(seq uint64) ([]sseEvent, <-chan struct{}, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var events []sseEvent
+	for _, ev := range s.events {
+		if ev.seq > seq {
+			events = append(events, ev)
+		}
+	}
+	return events, s.changed, s.ended
+}
+
+// attach makes a new response the reader of the stream, the previous one
+// stops. It returns the channel closed when the reader is replaced in turn.
+func (s *sseStream) attach() (chan struct{}, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.ended {
+		return nil, false
+	}
+	if s.reader != nil {
+		close(s.reader)
+	}
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	s.reader = make(chan struct{})
+	return s.reader, true
+}
+
+// detach leaves the stream without reader, and ends it unless it is
+// resumed within ResumeTimeout.
+func (s *sseStream) detach(reader chan struct{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.reader != reader {
+		return
+	}
+	s.reader = nil
+	s.timer = time.AfterFunc(s.hub.options.ResumeTimeout, s.end)
+}
+
+func (s *sseStream) end() {
+	s.mutex.Lock()
+	if s.ended || s.reader != nil {
+		s.mutex.Unlock()
+		return
+	}
+	s.ended = true
+	close(s.changed)
+	s.mutex.Unlock()
+
+	s.subs.close()
+	s.hub.mutex.Lock()
+	delete(s.hub.streams, s.id)
+	s.hub.mutex.Unlock()
+}
+
+// serveSSE opens or resumes a subscription on the SSE endpoint.
+func (server *HTTPServer) serveSSE(w http.ResponseWriter, req *http.Request) {
+	hub := server.sse
+	w.Header().Set("Content-Type", "application/json")
+	if _, ok := w.(http.Flusher); !ok {
+		writeRESTError(w, NewError(errInternal.Code, "rpc: streaming not supported"))
+		return
+	}
+	if stream, seq := hub.lookup(req.Header.Get("Last-Event-ID")); stream != nil {
+		if reader, ok := stream.attach(); ok {
+			server.writeSSE(w, req, stream, seq, reader)
+			return
+		}
+	}
+
+	query := req.URL.Query()
+	serviceMethod := query.Get("method")
+	query.Del("method")
+	version := versionFromContext(req.Context())
+	serviceMethod, _, mtype, err := server.rpc.resolveMethod(serviceMethod, version)
+	if err != nil {
+		writeRESTError(w, NewError(errMethod.Code, err.Error()))
+		return
+	}
+	var params json.RawMessage
+	switch req.Method {
+	case http.MethodGet:
+		if params, err = queryParams(mtype.ArgType, query); err != nil {
+			writeRESTError(w, NewError(errParams.Code, err.Error()))
+			return
+		}
+	case http.MethodPost:
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			writeRESTError(w, NewError(errRequest.Code, err.Error()))
+			return
+		}
+		if params = bytes.TrimSpace(body); len(params) == 0 {
+			params = null
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeRESTStatus(w, http.StatusMethodNotAllowed, NewError(errRequest.Code, "rpc: must GET or POST"))
+		return
+	}
+
+	// the subscription outlives the request
+	ctx := WithTransport(context.Background(), TransportSSE, req.RemoteAddr)
+	ctx = withResponseHeader(withVersion(ctx, version), w.Header())
+	ctx = withSubjectOf(ctx, req.Context())
+	ctx = trace.FromHeader(ctx, req.Header)
+	if trace.RequestID(ctx) == "" {
+		ctx = trace.WithRequestID(ctx, trace.NewRequestID())
+	}
+	w.Header().Set(trace.RequestIDHeader, trace.RequestID(ctx))
+
+	stream := hub.newStream()
+	result, e := server.dispatch(withSubscriptions(ctx, stream.subs), serviceMethod, params)
+	if e == nil && (json.Unmarshal(result, &stream.id) != nil || !stream.subs.has(stream.id)) {
+		e = NewError(errRequest.Code, "rpc: "+serviceMethod+" is not a subscription")
+	}
+	if e != nil {
+		stream.subs.close()
+		writeRESTError(w, e)
+		return
+	}
+	hub.mutex.Lock()
+	hub.streams[stream.id] = stream
+	hub.mutex.Unlock()
+	reader, _ := stream.attach()
+	server.writeSSE(w, req, stream, 0, reader)
+}
+
+// writeSSE writes the events of the stream after seq, until the client goes
+// away or another response resumes the stream.
+func (server *HTTPServer) writeSSE(w http.ResponseWriter, req *http.Request, stream *sseStream, seq uint64, reader chan struct{}) {
+	flusher := w.(http.Flusher)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(server.sse.options.Heartbeat)
+	defer heartbeat.Stop()
+	for {
+		events, changed, ended := stream.since(seq)
+		for _, ev := range events {
+			if _, err := fmt.Fprintf(w, "id: %s:%d\ndata: %s\n\n", stream.id, ev.seq, ev.data); err != nil {
+				stream.detach(reader)
+				return
+			}
+			seq = ev.seq
+		}
+		if len(events) > 0 {
+			flusher.Flush()
+		}
+		if ended {
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-heartbeat.C:
+			if _, err := w.Write([]byte(": heartbeat\n\n")); err != nil {
+				stream.detach(reader)
+				return
+			}
+			flusher.Flush()
+		case <-reader:
+			return
+		case <-req.Context().Done():
+			stream.detach(reader)
+			return
+		}
+	}
+}
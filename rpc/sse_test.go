@@ -0,0 +1,160 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package rpc
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sseReader reads the events of an SSE response.
+type sseReader struct {
+	resp *http.Response
+	r    *bufio.Reader
+}
+
+func openSSE(t *testing.T, method, url, lastEventID string) *sseReader {
+	t.Helper()
+	req, _ := http.NewRequest(method, url, nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := resp.Header.Get("Content-Type"); resp.StatusCode != http.StatusOK || ct != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %s %s", resp.Status, ct)
+	}
+	return &sseReader{resp: resp, r: bufio.NewReader(resp.Body)}
+}
+
+// next returns the lines of the next event or comment.
+func (s *sseReader) next(t *testing.T) []string {
+	t.Helper()
+	var lines []string
+	for {
+		line, err := s.r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return lines
+		}
+		lines = append(lines, line)
+	}
+}
+
+// event returns the ID and the result of the next event.
+func (s *sseReader) event(t *testing.T) (string, float64) {
+	t.Helper()
+	lines := s.next(t)
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "id: ") || !strings.HasPrefix(lines[1], "data: ") {
+		t.Fatalf("bad event %q", lines)
+	}
+	var res SubscriptionResult
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(lines[1], "data: ")), &res); err != nil {
+		t.Fatal(err)
+	}
+	id := strings.TrimPrefix(lines[0], "id: ")
+	if !strings.HasPrefix(id, res.Subscription+":") {
+		t.Fatalf("event %s of another subscription than %s", id, res.Subscription)
+	}
+	return id, res.Result.(float64)
+}
+
+func Test_SSE(t *testing.T) {
+	server, _ := NewHTTPServer(nil, nil)
+	ticker := newTickerService()
+	server.GetServer().RegisterName("ticker", ticker)
+	server.EnableSSE(&SSEOptions{Heartbeat: 50 * time.Millisecond, Buffer: 2, ResumeTimeout: 200 * time.Millisecond})
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	stream := openSSE(t, http.MethodGet, ts.URL+"/events?method=ticker.Ticks&start=10", "")
+	ticker.ticks <- 1
+	ticker.ticks <- 2
+	first, result := stream.event(t)
+	if result != 11 || !strings.HasSuffix(first, ":1") {
+		t.Fatalf("expected event 1 of 11, got %s %v", first, result)
+	}
+	last, result := stream.event(t)
+	if result != 12 || !strings.HasSuffix(last, ":2") {
+		t.Fatalf("expected event 2 of 12, got %s %v", last, result)
+	}
+	if lines := stream.next(t); len(lines) != 1 || lines[0] != ": heartbeat" {
+		t.Fatalf("expected a heartbeat, got %q", lines)
+	}
+
+	// the events sent while the stream is broken are resumed, within the buffer
+	stream.resp.Body.Close()
+	time.Sleep(20 * time.Millisecond)
+	ticker.ticks <- 3
+	ticker.ticks <- 4
+	ticker.ticks <- 5
+	time.Sleep(20 * time.Millisecond)
+	stream = openSSE(t, http.MethodGet, ts.URL+"/events?method=ticker.Ticks&start=10", last)
+	for _, expected := range []float64{14, 15} {
+		if _, result := stream.event(t); result != expected {
+			t.Fatalf("expected %v, got %v", expected, result)
+		}
+	}
+
+	// the subscription ends when the stream is not resumed in time
+	stream.resp.Body.Close()
+	select {
+	case ended := <-ticker.ended:
+		if !strings.HasPrefix(last, ended+":") {
+			t.Fatalf("expected the subscription of %s to end, got %s", last, ended)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("subscription not ended")
+	}
+
+	// an unknown event ID opens a new subscription
+	stream = openSSE(t, http.MethodPost, ts.URL+"/events?method=ticker.Ticks", last)
+	defer stream.resp.Body.Close()
+	ticker.ticks <- 1
+	if id, result := stream.event(t); result != 1 || strings.HasPrefix(last, strings.Split(id, ":")[0]) {
+		t.Fatalf("expected a new subscription, got %s %v", id, result)
+	}
+}
+
+func Test_SSEErrors(t *testing.T) {
+	server, _ := NewHTTPServer(nil, nil)
+	server.GetServer().RegisterName("ticker", newTickerService())
+	server.EnableSSE(nil)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	for _, test := range []struct {
+		method, target string
+		status         int
+		body           string
+	}{
+		{http.MethodGet, "/events?method=ticker.Missing", http.StatusNotFound, `{"code":-32601,"message":"rpc: can't find method ticker.Missing"}`},
+		{http.MethodGet, "/events?method=ticker.Now&start=1", http.StatusBadRequest, `{"code":-32600,"message":"rpc: ticker.Now is not a subscription"}`},
+		{http.MethodPut, "/events?method=ticker.Ticks", http.StatusMethodNotAllowed, `{"code":-32600,"message":"rpc: must GET or POST"}`},
+	} {
+		req, _ := http.NewRequest(test.method, ts.URL+test.target, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body json.RawMessage
+		json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if resp.StatusCode != test.status || string(body) != test.body {
+			t.Fatalf("%s %s: expected %d %s, got %d %s", test.method, test.target, test.status, test.body, resp.StatusCode, body)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package rpc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+)
+
+// A subscription method creates a subscription on the connection of the
+// call, replies with its ID, then keeps notifying the client until the
+// subscription ends:
+//
+//	func (s *PriceService) Watch(ctx context.Context, args *WatchArgs, reply *string) error {
+//		notifier, ok := rpc.NotifierFromContext(ctx)
+//		if !ok {
+//			return rpc.ErrNotificationsUnsupported
+//		}
+//		sub := notifier.CreateSubscription()
+//		go func() {
+//			for {
+//				select {
+//				case price := <-s.prices(args.Symbol):
+//					notifier.Notify(sub.ID, price)
+//				case <-sub.Err():
+//					return
+//				}
+//			}
+//		}()
+//		*reply = sub.ID
+//		return nil
+//	}
+//
+// Subscriptions are served on bidirectional connections, such as WebSocket
+// ones, and on the Server-Sent Events endpoint of HTTPServer. On a
+// connection the notifications are calls without id of "namespace.Subscription",
+// whose params are a SubscriptionResult, and the client ends a subscription
+// by calling "rpc.Unsubscribe" with its ID. The notifications sent before
+// the reply of the subscription method is written are held until then, so
+// that the client knows the subscription ID before its first notification.
+
+var (
+	// ErrNotificationsUnsupported is returned by subscription methods called
+	// on a transport which can not notify the client.
+	ErrNotificationsUnsupported = errors.New("rpc: notifications not supported")
+	// ErrSubscriptionNotFound is returned when notifying or unsubscribing an
+	// unknown or ended subscription.
+	ErrSubscriptionNotFound = errors.New("rpc: subscription not found")
+)
+
+// SubscriptionResult is the params of a notification.
+type SubscriptionResult struct {
+	Subscription string      `json:"subscription"`
+	Result       interface{} `json:"result"`
+}
+
+// Subscription is a subscription of a client.
+type Subscription struct {
+	ID        string
+	namespace string
+	err       chan error
+
+	mutex    sync.Mutex // protects held, released, and keeps notifications in order
+	held     []*SubscriptionResult
+	released bool // the reply of the call creating the subscription is written
+}
+
+// Err returns a channel which is closed when the subscription ends, because
+// the client unsubscribed or went away.
+func (s *Subscription) Err() <-chan error {
+	return s.err
+}
+
+// subscriptionsKey is the context key of the subscriptions of a connection.
+type subscriptionsKey struct{}
+
+// notifierKey is the context key of the Notifier of a call.
+type notifierKey struct{}
+
+// subscriptions are the subscriptions of a connection.
+type subscriptions struct {
+	send func(method string, res *SubscriptionResult) error
+
+	mutex  sync.Mutex // protects subs, closed
+	subs   map[string]*Subscription
+	closed bool
+}
+
+func newSubscriptions(send func(method string, res *SubscriptionResult) error) *subscriptions {
+	return &subscriptions{send: send, subs: make(map[string]*Subscription)}
+}
+
+// withSubscriptions returns a copy of ctx in which the calls of a connection
+// can create subscriptions on subs.
+func withSubscriptions(ctx context.Context, subs *subscriptions) context.Context {
+	return context.WithValue(ctx, subscriptionsKey{}, subs)
+}
+
+// withNotifier returns a copy of ctx carrying the Notifier of a call of the
+// namespace, if the connection supports subscriptions.
+func withNotifier(ctx context.Context, namespace string) context.Context {
+	subs, ok := ctx.Value(subscriptionsKey{}).(*subscriptions)
+	if !ok {
+		return ctx
+	}
+	// the calls of a batch are replied with the batch
+	batch, _ := ctx.Value(notifierKey{}).(*Notifier)
+	return context.WithValue(ctx, notifierKey{}, &Notifier{subs: subs, namespace: namespace, batch: batch})
+}
+
+func (subs *subscriptions) unsubscribe(id string) bool {
+	subs.mutex.Lock()
+	defer subs.mutex.Unlock()
+	sub, ok := subs.subs[id]
+	if ok {
+		delete(subs.subs, id)
+		close(sub.err)
+	}
+	return ok
+}
+
+// close ends all the subscriptions, once the connection is closed.
+func (subs *subscriptions) close() {
+	subs.mutex.Lock()
+	defer subs.mutex.Unlock()
+	for id, sub := range subs.subs {
+		delete(subs.subs, id)
+		close(sub.err)
+	}
+	subs.closed = true
+}
+
+func (subs *subscriptions) has(id string) bool {
+	subs.mutex.Lock()
+	defer subs.mutex.Unlock()
+	_, ok := subs.subs[id]
+	return ok
+}
+
+// Notifier creates subscriptions on the connection of a call and notifies
+// them.
+type Notifier struct {
+	subs      *subscriptions
+	namespace string
+	batch     *Notifier // of the batch of the call, nil if none
+
+	mutex   sync.Mutex // protects created, replied
+	created []*Subscription
+	replied bool // the reply of the call is written
+}
+
+// NotifierFromContext returns the Notifier of the connection of the call of
+// ctx, false if its transport does not support subscriptions.
+func NotifierFromContext(ctx context.Context) (*Notifier, bool) {
+	n, ok := ctx.Value(notifierKey{}).(*Notifier)
+	return n, ok
+}
+
+// CreateSubscription returns a new subscription, whose ID the subscription
+// method replies with. The subscription is ended at once if the connection
+// is already closed.
+func (n *Notifier) CreateSubscription() *Subscription {
+	sub := &Subscription{ID: newSubscriptionID(), namespace: n.namespace, err: make(chan error)}
+	n.subs.mutex.Lock()
+	if n.subs.closed {
+		close(sub.err)
+	} else {
+		n.subs.subs[sub.ID] = sub
+	}
+	n.subs.mutex.Unlock()
+	n.hold(sub)
+	return sub
+}
+
+// Notify sends data to the client as a notification of the subscription id.
+// It is held while the reply of the call creating the subscription is not
+// written.
+func (n *Notifier) Notify(id string, data interface{}) error {
+	n.subs.mutex.Lock()
+	sub, ok := n.subs.subs[id]
+	n.subs.mutex.Unlock()
+	if !ok {
+		return ErrSubscriptionNotFound
+	}
+	res := &SubscriptionResult{Subscription: id, Result: data}
+	sub.mutex.Lock()
+	defer sub.mutex.Unlock()
+	if !sub.released {
+		sub.held = append(sub.held, res)
+		return nil
+	}
+	return n.subs.send(sub.namespace+".Subscription", res)
+}
+
+// hold holds the notifications of subs until the reply of the call, or of
+// its batch, is written.
+func (n *Notifier) hold(subs ...*Subscription) {
+	n.mutex.Lock()
+	if !n.replied {
+		n.created = append(n.created, subs...)
+		n.mutex.Unlock()
+		return
+	}
+	n.mutex.Unlock()
+	if n.batch != nil {
+		n.batch.hold(subs...)
+		return
+	}
+	for _, sub := range subs {
+		sub.release(n.subs.send)
+	}
+}
+
+// release sends the notifications held by the subscriptions created by the
+// call, once its reply is written.
+func (n *Notifier) release() {
+	n.mutex.Lock()
+	subs := n.created
+	n.created, n.replied = nil, true
+	n.mutex.Unlock()
+	n.hold(subs...)
+}
+
+func (s *Subscription) release(send func(method string, res *SubscriptionResult) error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, res := range s.held {
+		send(s.namespace+".Subscription", res)
+	}
+	s.held, s.released = nil, true
+}
+
+func newSubscriptionID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return "0x" + hex.EncodeToString(b[:])
+}
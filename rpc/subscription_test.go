@@ -0,0 +1,203 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type TickArgs struct {
+	Start int `json:"start"`
+}
+
+// TickerService notifies the values sent to ticks, counted from Start.
+type TickerService struct {
+	ticks chan int
+	ended chan string
+}
+
+func newTickerService() *TickerService {
+	return &TickerService{ticks: make(chan int, 16), ended: make(chan string, 16)}
+}
+
+func (s *TickerService) Ticks(ctx context.Context, args *TickArgs, reply *string) error {
+	notifier, ok := NotifierFromContext(ctx)
+	if !ok {
+		return ErrNotificationsUnsupported
+	}
+	sub := notifier.CreateSubscription()
+	go func() {
+		for {
+			select {
+			case tick := <-s.ticks:
+				notifier.Notify(sub.ID, args.Start+tick)
+			case <-sub.Err():
+				s.ended <- sub.ID
+				return
+			}
+		}
+	}()
+	*reply = sub.ID
+	return nil
+}
+
+// Countdown notifies Start down to 1 before replying.
+func (s *TickerService) Countdown(ctx context.Context, args *TickArgs, reply *string) error {
+	notifier, ok := NotifierFromContext(ctx)
+	if !ok {
+		return ErrNotificationsUnsupported
+	}
+	sub := notifier.CreateSubscription()
+	for i := args.Start; i > 0; i-- {
+		notifier.Notify(sub.ID, i)
+	}
+	*reply = sub.ID
+	return nil
+}
+
+func (s *TickerService) Now(args *TickArgs, reply *int) error {
+	*reply = args.Start
+	return nil
+}
+
+// TickerEvents receives the notifications of TickerService.
+type TickerEvents struct {
+	results chan *SubscriptionResult
+}
+
+func (e *TickerEvents) Subscription(res *SubscriptionResult, reply *struct{}) error {
+	e.results <- res
+	return nil
+}
+
+func Test_Subscription(t *testing.T) {
+	ws := NewWsRPCServer()
+	ticker := newTickerService()
+	ws.GetServer().RegisterName("ticker", ticker)
+	ts := httptest.NewServer(http.HandlerFunc(ws.ServeWS))
+	defer ts.Close()
+
+	handlers := NewServer()
+	events := &TickerEvents{results: make(chan *SubscriptionResult, 16)}
+	handlers.RegisterName("ticker", events)
+	client, err := DialWebsocketPeer("ws"+strings.TrimPrefix(ts.URL, "http"), nil, handlers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var id string
+	if err := client.Call("ticker.Ticks", &TickArgs{Start: 10}, &id); err != nil {
+		t.Fatal(err)
+	}
+	ticker.ticks <- 1
+	ticker.ticks <- 2
+	// the handlers serve notifications concurrently, as any call
+	received := make(map[interface{}]bool)
+	for i := 0; i < 2; i++ {
+		select {
+		case res := <-events.results:
+			if res.Subscription != id {
+				t.Fatalf("expected a notification of %s, got %+v", id, res)
+			}
+			received[res.Result] = true
+		case <-time.After(time.Second):
+			t.Fatal("notification not received")
+		}
+	}
+	if !received[11.0] || !received[12.0] {
+		t.Fatalf("expected 11 and 12, got %v", received)
+	}
+
+	var ok bool
+	if err := client.Call("rpc.Unsubscribe", &id, &ok); err != nil || !ok {
+		t.Fatalf("unsubscribe: %v %v", ok, err)
+	}
+	if ended := <-ticker.ended; ended != id {
+		t.Fatalf("expected %s to end, got %s", id, ended)
+	}
+	if err := client.Call("rpc.Unsubscribe", &id, &ok); err == nil || ServerError(err).Message != ErrSubscriptionNotFound.Error() {
+		t.Fatalf("expected subscription not found, got %v", err)
+	}
+
+	// the subscriptions end with the connection
+	if err := client.Call("ticker.Ticks", &TickArgs{}, &id); err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+	select {
+	case ended := <-ticker.ended:
+		if ended != id {
+			t.Fatalf("expected %s to end, got %s", id, ended)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("subscription not ended with the connection")
+	}
+}
+
+func Test_SubscriptionReplyFirst(t *testing.T) {
+	server := NewServer()
+	server.RegisterName("ticker", newTickerService())
+	cli, srv := net.Pipe()
+	defer cli.Close()
+	go server.ServePeer(context.Background(), srv)
+	dec := json.NewDecoder(cli)
+
+	type message struct {
+		ID     *int                 `json:"id"`
+		Result string               `json:"result"`
+		Params []SubscriptionResult `json:"params"`
+	}
+	notified := func(id string) {
+		t.Helper()
+		for want := 2.0; want > 0; want-- {
+			var msg message
+			if err := dec.Decode(&msg); err != nil {
+				t.Fatal(err)
+			}
+			if msg.ID != nil || len(msg.Params) != 1 || msg.Params[0].Subscription != id || msg.Params[0].Result != want {
+				t.Fatalf("expected notification %v of %s, got %+v", want, id, msg)
+			}
+		}
+	}
+
+	go fmt.Fprint(cli, `{"jsonrpc":"2.0","id":1,"method":"ticker.Countdown","params":[{"start":2}]}`)
+	var reply message
+	if err := dec.Decode(&reply); err != nil || reply.ID == nil {
+		t.Fatalf("expected the reply before the notifications, got %+v %v", reply, err)
+	}
+	notified(reply.Result)
+
+	// the calls of a batch are replied with the batch
+	go fmt.Fprint(cli, `[{"jsonrpc":"2.0","id":2,"method":"ticker.Countdown","params":[{"start":2}]}]`)
+	var replies []message
+	if err := dec.Decode(&replies); err != nil || len(replies) != 1 {
+		t.Fatalf("expected the reply before the notifications, got %+v %v", replies, err)
+	}
+	notified(replies[0].Result)
+}
+
+func Test_SubscriptionUnsupported(t *testing.T) {
+	server, _ := NewHTTPServer(nil, nil)
+	server.GetServer().RegisterName("ticker", newTickerService())
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	client := NewHTTPClient(ts.URL, nil)
+	defer client.Close()
+
+	var id string
+	if err := client.Call("ticker.Ticks", &TickArgs{}, &id); err == nil || ServerError(err).Message != ErrNotificationsUnsupported.Error() {
+		t.Fatalf("expected notifications not supported, got %v", err)
+	}
+}
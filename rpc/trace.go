@@ -0,0 +1,77 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package rpc
+
+import (
+	"context"
+	"net/rpc"
+
+	"github.com/justoxh/go-toolkit/trace"
+)
+
+// callMeta is the optional "meta" member of a request envelope. It carries
+// the request ID and the W3C traceparent of the call across the wire.
+type callMeta struct {
+	RequestID   string `json:"requestId,omitempty"`
+	TraceParent string `json:"traceparent,omitempty"`
+}
+
+// metaCodec is implemented by server codecs whose envelope carries callMeta.
+type metaCodec interface {
+	// requestMeta returns the metadata of the request read by the last
+	// ReadRequestHeader, or nil.
+	requestMeta() *callMeta
+}
+
+// contextArgs wraps the params of an outgoing call with the metadata taken
+// from its context. The client codecs of this package unwrap it in
+// WriteRequest; the params of the other codecs are never wrapped.
+type contextArgs struct {
+	meta *callMeta
+	args interface{}
+}
+
+// metaClientCodec is implemented by the client codecs which unwrap
+// contextArgs.
+type metaClientCodec interface {
+	unwrapsContextArgs()
+}
+
+func (c *clientCodec) unwrapsContextArgs()        {}
+func (c *httpClientCodec) unwrapsContextArgs()    {}
+func (c *msgpackClientCodec) unwrapsContextArgs() {}
+
+// wrapArgs returns args wrapped with the metadata of ctx, if codec can
+// unwrap them.
+func wrapArgs(ctx context.Context, codec rpc.ClientCodec, args interface{}) interface{} {
+	if _, ok := codec.(metaClientCodec); !ok {
+		return args
+	}
+	return &contextArgs{meta: outgoingMeta(ctx), args: args}
+}
+
+// outgoingMeta returns the metadata to send for a call made with ctx: the
+// same request ID and a child of its traceparent. It is nil when ctx
+// carries neither.
+func outgoingMeta(ctx context.Context) *callMeta {
+	meta := &callMeta{
+		RequestID:   trace.RequestID(ctx),
+		TraceParent: trace.ChildTraceParent(trace.TraceParent(ctx)),
+	}
+	if meta.RequestID == "" && meta.TraceParent == "" {
+		return nil
+	}
+	return meta
+}
+
+// unwrapParam splits the param given to a client codec into its metadata
+// and the actual params.
+func unwrapParam(param interface{}) (*callMeta, interface{}) {
+	if ca, ok := param.(*contextArgs); ok {
+		return ca.meta, ca.args
+	}
+	return nil, param
+}
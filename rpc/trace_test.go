@@ -0,0 +1,173 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/rpc/jsonrpc"
+	"strings"
+	"testing"
+
+	"github.com/justoxh/go-toolkit/trace"
+)
+
+const testTraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+type TraceService struct{}
+
+type TraceReply struct {
+	RequestID   string
+	TraceParent string
+}
+
+func (TraceService) Echo(ctx context.Context, args *Args, reply *TraceReply) error {
+	reply.RequestID = trace.RequestID(ctx)
+	reply.TraceParent = trace.TraceParent(ctx)
+	return nil
+}
+
+func checkTraceReply(t *testing.T, reply TraceReply, id string) {
+	t.Helper()
+	if reply.RequestID != id {
+		t.Fatalf("got request id %q expected %q", reply.RequestID, id)
+	}
+	if !strings.HasPrefix(reply.TraceParent, "00-4bf92f3577b34da6a3ce929d0e0e4736-") || reply.TraceParent == testTraceParent {
+		t.Fatalf("expected a child traceparent, got %q", reply.TraceParent)
+	}
+}
+
+func Test_Trace_Client(t *testing.T) {
+	server := NewServer()
+	server.Register(TraceService{})
+	ctx := trace.WithTraceParent(trace.WithRequestID(context.Background(), "req-1"), testTraceParent)
+
+	for name, newClient := range map[string]func(net.Conn) *Client{
+		"json":    func(c net.Conn) *Client { return NewClient(c) },
+		"msgpack": func(c net.Conn) *Client { return NewMsgpackClient(c) },
+	} {
+		cli, srv := net.Pipe()
+		if name == "json" {
+			go server.ServeCodec(NewServerCodec(srv, server))
+		} else {
+			go server.ServeCodec(NewMsgpackServerCodec(srv, server))
+		}
+		client := newClient(cli)
+
+		var reply TraceReply
+		if err := client.CallContext(ctx, "TraceService.Echo", &Args{}, &reply); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		checkTraceReply(t, reply, "req-1")
+
+		// Without a context each call gets a new request ID.
+		var first, second TraceReply
+		client.Call("TraceService.Echo", &Args{}, &first)
+		client.Call("TraceService.Echo", &Args{}, &second)
+		if first.RequestID == "" || first.RequestID == second.RequestID || first.TraceParent != "" {
+			t.Fatalf("%s: bad generated ids %v %v", name, first, second)
+		}
+		client.Close()
+	}
+}
+
+func Test_Trace_ForeignCodec(t *testing.T) {
+	server := NewServer()
+	server.EnableJSONRPC1()
+	server.Register(new(Arith))
+	cli, srv := net.Pipe()
+	go server.ServeCodec(NewServerCodec(srv, server))
+	// a codec of another package can not unwrap the metadata of the context
+	client := NewClientWithCodec(jsonrpc.NewClientCodec(cli))
+	defer client.Close()
+
+	ctx := trace.WithRequestID(context.Background(), "req-1")
+	var reply Reply
+	if err := client.CallContext(ctx, "Arith.Add", &Args{1, 2}, &reply); err != nil || reply.C != 3 {
+		t.Fatalf("expected 3, got %d %v", reply.C, err)
+	}
+	if err := client.Call("Arith.Add", &Args{2, 2}, &reply); err != nil || reply.C != 4 {
+		t.Fatalf("expected 4, got %d %v", reply.C, err)
+	}
+}
+
+func Test_Trace_CallContextDone(t *testing.T) {
+	cli, srv := net.Pipe()
+	defer srv.Close()
+	client := NewClient(cli)
+	defer client.Close()
+	go func() {
+		// read the request and never reply
+		json.NewDecoder(srv).Decode(new(json.RawMessage))
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var reply Reply
+	if err := client.CallContext(ctx, "Arith.Add", &Args{1, 2}, &reply); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func Test_Trace_HTTP(t *testing.T) {
+	server, _ := NewHTTPServer(nil, nil)
+	server.GetServer().Register(TraceService{})
+
+	body := `[{"jsonrpc":"2.0","method":"TraceService.Echo","id":1,"params":[{}]},` +
+		`{"jsonrpc":"2.0","method":"TraceService.Echo","id":2,"params":[{}],"meta":{"requestId":"req-own"}}]`
+	req := httptest.NewRequest(http.MethodPost, "http://url.com", bytes.NewBufferString(body))
+	req.Header.Set(trace.RequestIDHeader, "req-http")
+	req.Header.Set(trace.TraceParentHeader, testTraceParent)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	if id := w.Header().Get(trace.RequestIDHeader); id != "req-http" {
+		t.Fatalf("bad %s header %q", trace.RequestIDHeader, id)
+	}
+	var resp []struct {
+		ID     int
+		Result TraceReply
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || len(resp) != 2 {
+		t.Fatalf("bad response %s: %v", w.Body, err)
+	}
+	for _, r := range resp {
+		expected := map[int]string{1: "req-http", 2: "req-own"}[r.ID]
+		if r.Result.RequestID != expected || r.Result.TraceParent != testTraceParent {
+			t.Fatalf("bad reply for id %d: %v", r.ID, r.Result)
+		}
+	}
+
+	// A request ID is generated and returned when the header is missing.
+	req = httptest.NewRequest(http.MethodPost, "http://url.com",
+		bytes.NewBufferString(`{"jsonrpc":"2.0","method":"TraceService.Echo","id":1,"params":[{}]}`))
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	id := w.Header().Get(trace.RequestIDHeader)
+	if id == "" || !strings.Contains(w.Body.String(), fmt.Sprintf(`"RequestID":"%s"`, id)) {
+		t.Fatalf("request id %q not used: %s", id, w.Body)
+	}
+}
+
+func Test_Trace_BadMeta(t *testing.T) {
+	cli, srv := net.Pipe()
+	defer cli.Close()
+	go ServeConn(srv)
+
+	fmt.Fprintf(cli, `{"jsonrpc":"2.0","method":"Arith.Add","id":1,"params":[{}],"meta":"x"}`)
+	var resp map[string]*json.RawMessage
+	if err := json.NewDecoder(cli).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp["error"] == nil || !strings.Contains(string(*resp["error"]), "-32600") {
+		t.Fatalf("expected invalid request, got %v", resp)
+	}
+}
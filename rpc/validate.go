@@ -0,0 +1,434 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package rpc
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// The params of a method are validated against the "validate" tags of the
+// fields of its argument, nested structs included, before the method is
+// called. A tag is a comma separated list of rules:
+//
+//	required      the field is not a zero value, or not a nil pointer
+//	omitempty     skip the other rules when the field is a zero value
+//	min=N, max=N  bounds of a number, or of the length of a string, slice or map
+//	len=N         length of a string, slice or map
+//	oneof=a b c   the string or integer is one of the listed values
+//	hex           the string is hexadecimal, with an optional 0x prefix
+//	regexp=RE     the string matches RE, this rule must come last
+//
+// along with the rules registered by RegisterValidation. Other rules, such
+// as those of other validation packages, are skipped with a warning when the
+// service is registered. A nil pointer field is only checked by required.
+// Params which fail some rules are rejected with code -32602, and a data
+// member listing a FieldError per failed rule.
+//
+//	type TransferArgs struct {
+//		From   string `json:"from" validate:"required,hex,len=42"`
+//		Amount int64  `json:"amount" validate:"min=1"`
+//		Memo   string `json:"memo" validate:"omitempty,max=140"`
+//	}
+
+// FieldError describes a field of the params which failed a rule.
+type FieldError struct {
+	// Field is the path of the field by JSON member names, such as
+	// "items[0].sku".
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+// ValidationFunc reports whether the value of a field, with pointers
+// dereferenced, passes a rule given param, the text after "=" in the tag.
+type ValidationFunc func(v reflect.Value, param string) bool
+
+var (
+	validationMutex sync.RWMutex // protects validations
+	validations     = make(map[string]ValidationFunc)
+
+	// rules of the struct types, by reflect.Type
+	structRulesCache sync.Map
+)
+
+// errUnknownRule is the error of newCheck for a rule which is neither builtin
+// nor registered.
+var errUnknownRule = errors.New("unknown validation rule")
+
+var builtinRules = map[string]bool{
+	"required": true, "omitempty": true, "min": true, "max": true,
+	"len": true, "oneof": true, "hex": true, "regexp": true,
+}
+
+// RegisterValidation registers a custom rule, which fields then use by name
+// in their tag. Rules must be registered before the services using them,
+// which skip those unknown yet.
+func RegisterValidation(name string, fn ValidationFunc) error {
+	if name == "" || strings.ContainsAny(name, ",=") || builtinRules[name] {
+		return errors.New("rpc: invalid validation rule name " + name)
+	}
+	validationMutex.Lock()
+	defer validationMutex.Unlock()
+	if _, dup := validations[name]; dup {
+		return errors.New("rpc: validation rule already defined: " + name)
+	}
+	validations[name] = fn
+	return nil
+}
+
+// check is a rule of a field other than required and omitempty.
+type check struct {
+	rule, param, message string
+	ok                   func(v reflect.Value) bool
+}
+
+type fieldRules struct {
+	index     int
+	name      string // JSON member name
+	required  bool
+	omitempty bool
+	checks    []check
+	nested    bool // the field holds structs which may have rules
+}
+
+type structRules struct {
+	fields []*fieldRules
+}
+
+// typeRules returns the rules of the struct t, or of the struct it points
+// to. It returns nil if there is no rule to check.
+func typeRules(t reflect.Type) (*structRules, error) {
+	return buildRules(t, make(map[reflect.Type]bool))
+}
+
+// buildRules returns the rules of t, which it builds unless they are cached,
+// along with those of the structs t holds. The rules are cached once built,
+// so calls validated meanwhile never see them in part. A recursive type finds
+// itself in building and is checked at run time.
+func buildRules(t reflect.Type, building map[reflect.Type]bool) (*structRules, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, nil
+	}
+	if sr, ok := structRulesCache.Load(t); ok {
+		return sr.(*structRules), nil
+	}
+	if building[t] {
+		return &structRules{}, nil
+	}
+	building[t] = true
+	defer delete(building, t)
+
+	sr := &structRules{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		fr, err := parseFieldRules(f, func(string) {})
+		if err != nil {
+			return nil, fmt.Errorf("field %s of %s: %v", f.Name, t, err)
+		}
+		fr.index = i
+		if fr.nested, err = holdsRules(f.Type, building); err != nil {
+			return nil, err
+		}
+		if fr.required || len(fr.checks) > 0 || fr.nested {
+			sr.fields = append(sr.fields, fr)
+		}
+	}
+	if len(sr.fields) == 0 {
+		sr = nil
+	}
+	cached, _ := structRulesCache.LoadOrStore(t, sr)
+	return cached.(*structRules), nil
+}
+
+// holdsRules reports whether values of t hold structs with rules.
+func holdsRules(t reflect.Type, building map[reflect.Type]bool) (bool, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return holdsRules(t.Elem(), building)
+	case reflect.Struct:
+		sr, err := buildRules(t, building)
+		return sr != nil, err
+	}
+	return false, nil
+}
+
+// unknownRules returns the warnings of the unknown rules of the struct t,
+// and of the structs its fields hold, which are skipped. The types in seen
+// are not walked again.
+func unknownRules(t reflect.Type, seen map[reflect.Type]bool) []string {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || seen[t] {
+		return nil
+	}
+	seen[t] = true
+	var warnings []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		parseFieldRules(f, func(rule string) {
+			warnings = append(warnings, fmt.Sprintf("field %s of %s: unknown validation rule %s skipped", f.Name, t, rule))
+		})
+		warnings = append(warnings, unknownRules(f.Type, seen)...)
+	}
+	return warnings
+}
+
+// parseFieldRules returns the rules of the tag of f, but for the unknown ones
+// which it passes to unknown.
+func parseFieldRules(f reflect.StructField, unknown func(rule string)) (*fieldRules, error) {
+	fr := &fieldRules{name: f.Name}
+	if tag := strings.Split(f.Tag.Get("json"), ",")[0]; tag != "" && tag != "-" {
+		fr.name = tag
+	}
+	tag := f.Tag.Get("validate")
+	if tag == "" {
+		return fr, nil
+	}
+
+	t := f.Type
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	parts := strings.Split(tag, ",")
+	for i, part := range parts {
+		name, param := part, ""
+		if eq := strings.Index(part, "="); eq >= 0 {
+			name, param = part[:eq], part[eq+1:]
+		}
+		switch name {
+		case "required":
+			fr.required = true
+			continue
+		case "omitempty":
+			fr.omitempty = true
+			continue
+		case "regexp":
+			// the pattern may contain commas
+			param = strings.Join(append([]string{param}, parts[i+1:]...), ",")
+		}
+		c, err := newCheck(t, name, param)
+		if err == errUnknownRule {
+			unknown(name)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		fr.checks = append(fr.checks, c)
+		if name == "regexp" {
+			break
+		}
+	}
+	return fr, nil
+}
+
+// newCheck returns the check of the rule name for values of type t.
+func newCheck(t reflect.Type, name, param string) (check, error) {
+	c := check{rule: name, param: param}
+	bad := func() (check, error) {
+		return c, fmt.Errorf("invalid rule %s=%s for %s", name, param, t)
+	}
+	switch name {
+	case "min", "max", "len":
+		n, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return bad()
+		}
+		size, ok := sizeOf(t)
+		if !ok || name == "len" && !isLengthKind(t.Kind()) {
+			return bad()
+		}
+		what := "be"
+		if isLengthKind(t.Kind()) {
+			what = "have a length of"
+		}
+		switch name {
+		case "min":
+			c.message = fmt.Sprintf("must %s at least %s", what, param)
+			c.ok = func(v reflect.Value) bool { return size(v) >= n }
+		case "max":
+			c.message = fmt.Sprintf("must %s at most %s", what, param)
+			c.ok = func(v reflect.Value) bool { return size(v) <= n }
+		default:
+			c.message = "must have a length of " + param
+			c.ok = func(v reflect.Value) bool { return size(v) == n }
+		}
+	case "oneof":
+		values := strings.Fields(param)
+		switch t.Kind() {
+		case reflect.String, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		default:
+			return bad()
+		}
+		c.message = "must be one of " + strings.Join(values, ", ")
+		c.ok = func(v reflect.Value) bool {
+			s := fmt.Sprint(v.Interface())
+			for _, value := range values {
+				if s == value {
+					return true
+				}
+			}
+			return false
+		}
+	case "hex":
+		if t.Kind() != reflect.String {
+			return bad()
+		}
+		c.message = "must be hexadecimal"
+		c.ok = func(v reflect.Value) bool { return isHex(v.String()) }
+	case "regexp":
+		re, err := regexp.Compile(param)
+		if err != nil || t.Kind() != reflect.String {
+			return bad()
+		}
+		c.message = "must match " + param
+		c.ok = func(v reflect.Value) bool { return re.MatchString(v.String()) }
+	default:
+		validationMutex.RLock()
+		fn := validations[name]
+		validationMutex.RUnlock()
+		if fn == nil {
+			return c, errUnknownRule
+		}
+		c.message = "failed rule " + name
+		c.ok = func(v reflect.Value) bool { return fn(v, param) }
+	}
+	return c, nil
+}
+
+func isLengthKind(k reflect.Kind) bool {
+	return k == reflect.String || k == reflect.Slice || k == reflect.Array || k == reflect.Map
+}
+
+// sizeOf returns the function measuring values of t for min and max.
+func sizeOf(t reflect.Type) (func(v reflect.Value) float64, bool) {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(v reflect.Value) float64 { return float64(v.Int()) }, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return func(v reflect.Value) float64 { return float64(v.Uint()) }, true
+	case reflect.Float32, reflect.Float64:
+		return func(v reflect.Value) float64 { return v.Float() }, true
+	case reflect.String:
+		return func(v reflect.Value) float64 { return float64(utf8.RuneCountInString(v.String())) }, true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return func(v reflect.Value) float64 { return float64(v.Len()) }, true
+	}
+	return nil, false
+}
+
+func isHex(s string) bool {
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		s = s[2:]
+	}
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !('0' <= r && r <= '9' || 'a' <= r && r <= 'f' || 'A' <= r && r <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// validateParams returns the error message of the params which fail their
+// rules, or "" if they pass.
+func validateParams(argv reflect.Value) string {
+	var errs []FieldError
+	validateStruct(argv, "", &errs)
+	if len(errs) == 0 {
+		return ""
+	}
+	e := NewError(errParams.Code, errParams.Message)
+	e.Data = errs
+	return e.Error()
+}
+
+func validateStruct(v reflect.Value, path string, errs *[]FieldError) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	sr, _ := typeRules(v.Type())
+	if sr == nil {
+		return
+	}
+	for _, f := range sr.fields {
+		name := f.name
+		if path != "" {
+			name = path + "." + f.name
+		}
+		validateField(v.Field(f.index), f, name, errs)
+	}
+}
+
+func validateField(v reflect.Value, f *fieldRules, name string, errs *[]FieldError) {
+	pointer := false
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			if f.required {
+				*errs = append(*errs, FieldError{Field: name, Rule: "required", Message: "is required"})
+			}
+			return
+		}
+		v, pointer = v.Elem(), true
+	}
+	if !pointer && v.IsZero() {
+		if f.required {
+			*errs = append(*errs, FieldError{Field: name, Rule: "required", Message: "is required"})
+			return
+		}
+		if f.omitempty {
+			return
+		}
+	}
+	for _, c := range f.checks {
+		if !c.ok(v) {
+			*errs = append(*errs, FieldError{Field: name, Rule: c.rule, Param: c.param, Message: c.message})
+		}
+	}
+	if !f.nested {
+		return
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		validateStruct(v, name, errs)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			validateStruct(v.Index(i), fmt.Sprintf("%s[%d]", name, i), errs)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			validateStruct(iter.Value(), fmt.Sprintf("%s[%v]", name, iter.Key().Interface()), errs)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	stdlog "log"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type TransferItem struct {
+	SKU      string `json:"sku" validate:"required,regexp=^[A-Z]{2,3}-[0-9]+$"`
+	Quantity int    `json:"quantity" validate:"min=1,max=99"`
+}
+
+type TransferArgs struct {
+	From     string          `json:"from" validate:"required,hex,len=42"`
+	Amount   int64           `json:"amount" validate:"min=1"`
+	Currency string          `json:"currency" validate:"oneof=USD EUR"`
+	Memo     string          `json:"memo" validate:"omitempty,max=5"`
+	Account  string          `json:"account" validate:"omitempty,even"`
+	Limit    *int            `json:"limit" validate:"max=10"`
+	Items    []TransferItem  `json:"items" validate:"max=2"`
+	Refund   *TransferItem   `json:"refund"`
+	Notes    map[string]bool `json:"notes"`
+}
+
+type TransferService struct{}
+
+func (TransferService) Send(args *TransferArgs, reply *int64) error {
+	*reply = args.Amount
+	return nil
+}
+
+type BadRuleArgs struct {
+	Name string `validate:"min=x"`
+}
+
+type BadRuleService struct{}
+
+func (BadRuleService) Get(args *BadRuleArgs, reply *bool) error { return nil }
+
+type UnknownRuleService struct{}
+
+func (UnknownRuleService) Get(args *struct {
+	Name string `validate:"unknown"`
+}, reply *bool) error {
+	return nil
+}
+
+func init() {
+	RegisterValidation("even", func(v reflect.Value, param string) bool {
+		return len(v.String())%2 == 0
+	})
+}
+
+func Test_Validate(t *testing.T) {
+	server := NewServer()
+	if err := server.RegisterName("transfer", TransferService{}); err != nil {
+		t.Fatal(err)
+	}
+	cli, srv := net.Pipe()
+	defer cli.Close()
+	go server.ServeCodec(NewServerCodec(srv, server))
+	dec := json.NewDecoder(cli)
+
+	call := func(params string) (json.RawMessage, *Error) {
+		t.Helper()
+		fmt.Fprintf(cli, `{"jsonrpc":"2.0","method":"transfer.Send","params":[%s],"id":1}`, params)
+		var resp struct {
+			Result json.RawMessage `json:"result"`
+			Error  *Error          `json:"error"`
+		}
+		if err := dec.Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Result, resp.Error
+	}
+	from := `"0x` + strings.Repeat("ab", 20) + `"`
+
+	result, e := call(`{"from":` + from + `,"amount":5,"currency":"EUR","items":[{"sku":"AB-1","quantity":2}]}`)
+	if e != nil || string(result) != "5" {
+		t.Fatalf("expected 5, got %s %v", result, e)
+	}
+
+	_, e = call(`{"from":"0xzz","amount":0,"currency":"GBP","memo":"too long","account":"odd","limit":11,` +
+		`"items":[{"sku":"AB-1,","quantity":100},{"quantity":1},{"sku":"ABC-2","quantity":1}],` +
+		`"refund":{"sku":"x","quantity":1},"notes":{"a":true}}`)
+	if e == nil || e.Code != -32602 || e.Message != "Invalid params" {
+		t.Fatalf("expected invalid params, got %v", e)
+	}
+	var got []FieldError
+	b, _ := json.Marshal(e.Data)
+	json.Unmarshal(b, &got)
+	expected := []FieldError{
+		{"from", "hex", "", "must be hexadecimal"},
+		{"from", "len", "42", "must have a length of 42"},
+		{"amount", "min", "1", "must be at least 1"},
+		{"currency", "oneof", "USD EUR", "must be one of USD, EUR"},
+		{"memo", "max", "5", "must have a length of at most 5"},
+		{"account", "even", "", "failed rule even"},
+		{"limit", "max", "10", "must be at most 10"},
+		{"items", "max", "2", "must have a length of at most 2"},
+		{"items[0].sku", "regexp", "^[A-Z]{2,3}-[0-9]+$", "must match ^[A-Z]{2,3}-[0-9]+$"},
+		{"items[0].quantity", "max", "99", "must be at most 99"},
+		{"items[1].sku", "required", "", "is required"},
+		{"refund.sku", "regexp", "^[A-Z]{2,3}-[0-9]+$", "must match ^[A-Z]{2,3}-[0-9]+$"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, got)
+	}
+
+	_, e = call(`{"amount":1,"currency":"USD"}`)
+	if e == nil || !strings.Contains(e.Error(), `"data":[{"field":"from","message":"is required","rule":"required"}]`) {
+		t.Fatalf("expected from required, got %v", e)
+	}
+}
+
+func Test_ValidateRegister(t *testing.T) {
+	server := NewServer()
+	if err := server.RegisterName("bad", BadRuleService{}); err == nil || !strings.Contains(err.Error(), "invalid rule min=x") {
+		t.Fatalf("expected invalid rule error, got %v", err)
+	}
+
+	// unknown rules, such as those of other validation packages, are skipped
+	var logged bytes.Buffer
+	stdlog.SetOutput(&logged)
+	defer stdlog.SetOutput(os.Stderr)
+	if err := server.RegisterName("unknown", UnknownRuleService{}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logged.String(), "unknown validation rule unknown skipped") {
+		t.Fatalf("expected unknown rule warning, got %q", logged.String())
+	}
+	if s, _ := server.serviceMap.Load("unknown"); s.(*service).method["Get"].validated {
+		t.Fatal("expected no rule to validate")
+	}
+	if err := RegisterValidation("min", nil); err == nil {
+		t.Fatal("expected error redefining a builtin rule")
+	}
+	if err := RegisterValidation("even", nil); err == nil {
+		t.Fatal("expected error redefining a rule")
+	}
+}
+
+type TreeArgs struct {
+	Name     string      `validate:"required"`
+	Children []*TreeArgs `json:"children"`
+}
+
+func Test_ValidateRulesBuilt(t *testing.T) {
+	// a recursive type
+	sr, err := typeRules(reflect.TypeOf(&TreeArgs{}))
+	if err != nil || sr == nil || len(sr.fields) != 2 || !sr.fields[1].nested {
+		t.Fatalf("bad rules %+v: %v", sr, err)
+	}
+	var errs []FieldError
+	validateStruct(reflect.ValueOf(&TreeArgs{Name: "root", Children: []*TreeArgs{{}}}), "", &errs)
+	if len(errs) != 1 || errs[0].Field != "children[0].Name" {
+		t.Fatalf("bad errors %v", errs)
+	}
+
+	// the rules of a type are seen whole while they are built
+	for i := 0; i < 50; i++ {
+		typ := reflect.StructOf([]reflect.StructField{
+			{Name: "A", Type: reflect.TypeOf(""), Tag: `validate:"required"`},
+			{Name: fmt.Sprintf("B%d", i), Type: reflect.TypeOf(0), Tag: `validate:"min=1"`},
+		})
+		var wg sync.WaitGroup
+		for j := 0; j < 2; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if sr, err := typeRules(typ); err != nil || sr == nil || len(sr.fields) != 2 {
+					t.Errorf("bad rules %+v: %v", sr, err)
+				}
+			}()
+		}
+		wg.Wait()
+	}
+}
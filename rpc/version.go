@@ -0,0 +1,245 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package rpc
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/justoxh/go-toolkit/trace"
+)
+
+// Several versions of a namespace are registered side by side with
+// RegisterAPI, each under its API.Version:
+//
+//	server.RegisterAPI(API{Namespace: "order", Version: "v1", Service: new(OrderV1)})
+//	server.RegisterAPI(API{Namespace: "order", Version: "v2", Service: new(OrderV2)})
+//
+// A call selects a version with the method suffix "order.Get@v2", or for
+// all its methods with the VersionHeader or, on HTTPServer, the path
+// prefix "/v2". The suffix wins over the path, which wins over the header.
+// The calls which select no version get the default version of the
+// namespace, the first one registered unless SetDefaultVersion changes it.
+// The methods of the namespaces registered without version ignore the
+// version of the transport.
+//
+// A versioned method is reported, cached, limited and recorded under its
+// name with the version suffix, so that a limit of "order.Get@v1" does not
+// apply to "order.Get@v2"; a limit of "order.Get" applies to both.
+
+// VersionHeader is the HTTP header selecting the API version of the calls
+// of a request, or of a WebSocket connection.
+const VersionHeader = "X-API-Version"
+
+// versionSep separates a method from its version.
+const versionSep = "@"
+
+// Deprecated is optionally implemented by a registered service to annotate
+// the methods, by name, which are deprecated, with a note such as the
+// method replacing them. A call of a deprecated method is counted in the
+// "deprecated_calls" metric, by method, and the client is warned by the
+// "warning" member of the JSON-RPC response and, over HTTP, by the
+// Deprecation and Warning headers.
+type Deprecated interface {
+	DeprecatedMethods() map[string]string
+}
+
+// deprecatedCalls counts the calls of deprecated methods, by method.
+var deprecatedCalls = new(expvar.Map).Init()
+
+func init() {
+	Metrics.Set(metricDeprecatedCalls, deprecatedCalls)
+}
+
+// versions are the versions registered on a server, by namespace.
+type versions struct {
+	mutex sync.RWMutex
+	byNS  map[string][]string
+}
+
+// RegisterAPI registers api.Service under api.Namespace, for api.Version
+// if it is not empty. A version can not contain '.', '@' or '/'.
+func (server *Server) RegisterAPI(api API) error {
+	if api.Version == "" {
+		return server.RegisterName(api.Namespace, api.Service)
+	}
+	if strings.ContainsAny(api.Version, "."+versionSep+"/") {
+		return errors.New("rpc.Register: bad version " + strconv.Quote(api.Version) + " of " + api.Namespace)
+	}
+	return server.register(api.Service, api.Namespace, api.Version, true)
+}
+
+// registerVersion makes s, the service of a version, the default version of
+// its namespace if it is the first one.
+func (server *Server) registerVersion(s *service) error {
+	server.versions.mutex.Lock()
+	defer server.versions.mutex.Unlock()
+	if svci, ok := server.serviceMap.Load(s.name); ok && svci.(*service).version == "" {
+		server.serviceMap.Delete(s.name + versionSep + s.version)
+		return errors.New("rpc: service " + s.name + " already defined without version")
+	}
+	server.serviceMap.LoadOrStore(s.name, s)
+	if server.versions.byNS == nil {
+		server.versions.byNS = make(map[string][]string)
+	}
+	server.versions.byNS[s.name] = append(server.versions.byNS[s.name], s.version)
+	return nil
+}
+
+// SetDefaultVersion sets the version of namespace served to the calls
+// which select none.
+func (server *Server) SetDefaultVersion(namespace, version string) error {
+	svci, ok := server.serviceMap.Load(namespace + versionSep + version)
+	if !ok {
+		return errors.New("rpc: can't find version " + version + " of " + namespace)
+	}
+	server.serviceMap.Store(namespace, svci)
+	return nil
+}
+
+// hasVersion reports whether version is registered for any namespace.
+func (server *Server) hasVersion(version string) bool {
+	server.versions.mutex.RLock()
+	defer server.versions.mutex.RUnlock()
+	for _, vs := range server.versions.byNS {
+		for _, v := range vs {
+			if v == version {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// resolveMethod returns the service and the method called as serviceMethod,
+// with version selected by the transport, and the name of the method with
+// its version suffix if it is versioned.
+func (server *Server) resolveMethod(serviceMethod, version string) (string, *service, *methodType, error) {
+	dot := strings.LastIndex(serviceMethod, ".")
+	if dot < 0 {
+		return "", nil, nil, errors.New("rpc: service/method request ill-formed: " + serviceMethod)
+	}
+	serviceName := serviceMethod[:dot]
+	methodName := serviceMethod[dot+1:]
+	explicit := false
+	if at := strings.Index(methodName, versionSep); at >= 0 {
+		version = methodName[at+len(versionSep):]
+		methodName = methodName[:at]
+		explicit = true
+	}
+
+	var svci interface{}
+	ok := false
+	if version != "" {
+		svci, ok = server.serviceMap.Load(serviceName + versionSep + version)
+	}
+	if !ok && !explicit {
+		// the version of the transport does not apply to unversioned namespaces
+		if svci, ok = server.serviceMap.Load(serviceName); ok && version != "" && svci.(*service).version != "" {
+			ok = false
+		}
+	}
+	if !ok {
+		if version != "" {
+			serviceMethod = serviceName + "." + methodName + versionSep + version
+		}
+		return "", nil, nil, errors.New("rpc: can't find service " + serviceMethod)
+	}
+	svc := svci.(*service)
+	mtype := svc.method[methodName]
+	if mtype == nil {
+		return "", nil, nil, errors.New("rpc: can't find method " + serviceMethod)
+	}
+	if svc.version != "" {
+		serviceMethod = serviceName + "." + methodName + versionSep + svc.version
+	}
+	return serviceMethod, svc, mtype, nil
+}
+
+// unversioned returns serviceMethod without its version suffix.
+func unversioned(serviceMethod string) string {
+	if at := strings.LastIndex(serviceMethod, versionSep); at > strings.LastIndex(serviceMethod, ".") {
+		return serviceMethod[:at]
+	}
+	return serviceMethod
+}
+
+// versionKey is the context key of the version selected by the transport.
+type versionKey struct{}
+
+func withVersion(ctx context.Context, version string) context.Context {
+	if version == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, versionKey{}, version)
+}
+
+func versionFromContext(ctx context.Context) string {
+	v, _ := ctx.Value(versionKey{}).(string)
+	return v
+}
+
+// pathVersion splits the version prefix of an HTTP path, "/v2/order/get"
+// or "/v2", if it names a registered version.
+func (server *Server) pathVersion(path string) (string, string) {
+	rest := strings.TrimPrefix(path, "/")
+	version := rest
+	if slash := strings.Index(rest, "/"); slash >= 0 {
+		version, rest = rest[:slash], rest[slash:]
+	} else {
+		rest = "/"
+	}
+	if version == "" || !server.hasVersion(version) {
+		return "", path
+	}
+	return version, rest
+}
+
+// responseHeader is the header of the HTTP response of the calls of a
+// request, which warns of deprecated methods.
+type responseHeader struct {
+	mutex  sync.Mutex // protects header, calls of a batch run concurrently
+	header http.Header
+}
+
+// responseHeaderKey is the context key of the responseHeader of a call.
+type responseHeaderKey struct{}
+
+func withResponseHeader(ctx context.Context, header http.Header) context.Context {
+	return context.WithValue(ctx, responseHeaderKey{}, &responseHeader{header: header})
+}
+
+// warner is implemented by the codecs which can add a warning to a response.
+type warner interface {
+	warn(seq uint64, warning string)
+}
+
+// warnDeprecated counts a call of the deprecated method serviceMethod, and
+// warns its client.
+func (server *Server) warnDeprecated(ctx context.Context, codec interface{}, seq uint64, serviceMethod, note string) {
+	deprecatedCalls.Add(serviceMethod, 1)
+	warning := "rpc: " + serviceMethod + " is deprecated"
+	if note != "" {
+		warning += ", " + note
+	}
+	if w, ok := codec.(warner); ok {
+		w.warn(seq, warning)
+	}
+	if h, ok := ctx.Value(responseHeaderKey{}).(*responseHeader); ok {
+		h.mutex.Lock()
+		h.header.Set("Deprecation", "true")
+		h.header.Add("Warning", "299 - "+strconv.Quote(warning))
+		h.mutex.Unlock()
+	}
+	if server.log != nil {
+		server.log.Warn("rpc deprecated call", "method", serviceMethod, "request_id", trace.RequestID(ctx))
+	}
+}
@@ -0,0 +1,202 @@
+/**
+*  @file
+*  @copyright defined in go-toolkit/LICENSE
+ */
+
+package rpc
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type ShopArgs struct {
+	ID int `json:"id"`
+}
+
+type ShopV1 struct{}
+
+func (ShopV1) DeprecatedMethods() map[string]string {
+	return map[string]string{"Get": "use shop.Get@v2"}
+}
+
+func (ShopV1) ReadOnlyMethods() []string {
+	return []string{"Get"}
+}
+
+func (ShopV1) Get(args *ShopArgs, reply *string) error {
+	*reply = "v1"
+	return nil
+}
+
+type ShopV2 struct{}
+
+func (ShopV2) ReadOnlyMethods() []string {
+	return []string{"Get"}
+}
+
+func (ShopV2) Get(args *ShopArgs, reply *string) error {
+	*reply = "v2"
+	return nil
+}
+
+func registerShop(t *testing.T, server *Server) {
+	for _, api := range []API{
+		{Namespace: "shop", Version: "v1", Service: ShopV1{}},
+		{Namespace: "shop", Version: "v2", Service: ShopV2{}},
+	} {
+		if err := server.RegisterAPI(api); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func Test_VersionSuffix(t *testing.T) {
+	server := NewServer()
+	registerShop(t, server)
+	cli, srv := net.Pipe()
+	go server.ServeCodec(NewServerCodec(srv, server))
+	client := NewClient(cli)
+	defer client.Close()
+
+	for _, test := range []struct{ method, expected string }{
+		{"shop.Get", "v1"},
+		{"shop.Get@v1", "v1"},
+		{"shop.Get@v2", "v2"},
+	} {
+		var reply string
+		if err := client.Call(test.method, &ShopArgs{}, &reply); err != nil || reply != test.expected {
+			t.Fatalf("%s: expected %s, got %s %v", test.method, test.expected, reply, err)
+		}
+	}
+	var reply string
+	if err := client.Call("shop.Get@v3", &ShopArgs{}, &reply); err == nil || !strings.Contains(err.Error(), "can't find service shop.Get@v3") {
+		t.Fatalf("expected unknown version error, got %v", err)
+	}
+
+	if err := server.SetDefaultVersion("shop", "v2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Call("shop.Get", &ShopArgs{}, &reply); err != nil || reply != "v2" {
+		t.Fatalf("expected the new default v2, got %s %v", reply, err)
+	}
+	if err := server.SetDefaultVersion("shop", "v3"); err == nil {
+		t.Fatalf("expected error for unknown version")
+	}
+
+	var methods []MethodInfo
+	if err := client.Call("rpc.Methods", &struct{}{}, &methods); err != nil {
+		t.Fatal(err)
+	}
+	var shop []string
+	for _, m := range methods {
+		if strings.HasPrefix(m.Name, "shop.") {
+			shop = append(shop, m.Name+" "+m.Version)
+			if m.Deprecated != (m.Version == "v1") {
+				t.Fatalf("bad deprecation of %+v", m)
+			}
+		}
+	}
+	if strings.Join(shop, ",") != "shop.Get@v1 v1,shop.Get@v2 v2" {
+		t.Fatalf("bad methods %v", shop)
+	}
+}
+
+func Test_VersionRegister(t *testing.T) {
+	server := NewServer()
+	registerShop(t, server)
+	if err := server.RegisterName("shop", ShopV2{}); err == nil {
+		t.Fatalf("expected error for unversioned shop")
+	}
+	if err := server.RegisterAPI(API{Namespace: "shop", Version: "v2", Service: ShopV2{}}); err == nil {
+		t.Fatalf("expected error for duplicate version")
+	}
+	if err := server.RegisterAPI(API{Namespace: "shop", Version: "v2.1", Service: ShopV2{}}); err == nil {
+		t.Fatalf("expected error for bad version")
+	}
+	if err := server.RegisterName("plain", ShopV2{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.RegisterAPI(API{Namespace: "plain", Version: "v1", Service: ShopV1{}}); err == nil {
+		t.Fatalf("expected error for versioned plain")
+	}
+	if _, err := server.lookupMethod("plain.Get@v1"); err == nil {
+		t.Fatalf("expected the failed version to be unregistered")
+	}
+}
+
+func Test_VersionHTTP(t *testing.T) {
+	server, _ := NewHTTPServer(nil, nil)
+	server.EnableREST()
+	registerShop(t, server.GetServer())
+	server.GetServer().RegisterName("plain", ShopV2{})
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	do := func(method, path, version, body string) (*http.Response, string) {
+		req, _ := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		if version != "" {
+			req.Header.Set(VersionHeader, version)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var buf bytes.Buffer
+		buf.ReadFrom(resp.Body)
+		return resp, strings.TrimSpace(buf.String())
+	}
+	call := func(method string) string {
+		return `{"jsonrpc":"2.0","id":1,"method":"` + method + `","params":[{"id":1}]}`
+	}
+
+	for _, test := range []struct {
+		method, path, version, body string
+		expected                    string
+	}{
+		{http.MethodPost, "/", "", call("shop.Get@v2"), `"result":"v2"`},
+		{http.MethodPost, "/v2", "", call("shop.Get"), `"result":"v2"`},
+		{http.MethodPost, "/", "v2", call("shop.Get"), `"result":"v2"`},
+		{http.MethodPost, "/v2", "v1", call("shop.Get"), `"result":"v2"`},
+		{http.MethodPost, "/v2", "", call("shop.Get@v1"), `"result":"v1"`},
+		{http.MethodPost, "/v2", "", call("plain.Get"), `"result":"v2"`},
+		{http.MethodGet, "/v2/shop/get?id=1", "", "", `"v2"`},
+		{http.MethodGet, "/shop/get?id=1", "v2", "", `"v2"`},
+		{http.MethodGet, "/shop/get?id=1", "", "", `"v1"`},
+	} {
+		if _, body := do(test.method, test.path, test.version, test.body); !strings.Contains(body, test.expected) {
+			t.Fatalf("%s %s %s %s: expected %s, got %s", test.method, test.path, test.version, test.body, test.expected, body)
+		}
+	}
+
+	// deprecated methods warn the client and are counted
+	before := deprecatedCallCount("shop.Get@v1")
+	resp, body := do(http.MethodPost, "/", "", call("shop.Get"))
+	if !strings.Contains(body, `"warning":"rpc: shop.Get@v1 is deprecated, use shop.Get@v2"`) {
+		t.Fatalf("expected a warning member, got %s", body)
+	}
+	if resp.Header.Get("Deprecation") != "true" || !strings.Contains(resp.Header.Get("Warning"), "shop.Get@v1 is deprecated") {
+		t.Fatalf("expected deprecation headers, got %v", resp.Header)
+	}
+	if resp, _ := do(http.MethodGet, "/shop/get?id=1", "", ""); resp.Header.Get("Deprecation") != "true" {
+		t.Fatalf("expected deprecation headers on REST, got %v", resp.Header)
+	}
+	if resp, _ := do(http.MethodPost, "/", "", call("shop.Get@v2")); resp.Header.Get("Deprecation") != "" {
+		t.Fatalf("unexpected deprecation headers %v", resp.Header)
+	}
+	if count := deprecatedCallCount("shop.Get@v1"); count != before+2 {
+		t.Fatalf("expected %d deprecated calls, got %d", before+2, count)
+	}
+}
+
+func deprecatedCallCount(serviceMethod string) int64 {
+	if v, ok := deprecatedCalls.Get(serviceMethod).(interface{ Value() int64 }); ok {
+		return v.Value()
+	}
+	return 0
+}
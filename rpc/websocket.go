@@ -8,11 +8,11 @@ package rpc
 import (
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"net/rpc"
 
 	"github.com/gorilla/websocket"
+	"github.com/justoxh/go-toolkit/trace"
 )
 
 var upgrader = websocket.Upgrader{
@@ -22,7 +22,7 @@ var upgrader = websocket.Upgrader{
 
 // WsRPCServer represents a Websocket RPC server
 type WsRPCServer struct {
-	rpc *rpc.Server
+	rpc *Server
 }
 
 // WebsocketServerConn represents a websocket server connection
@@ -35,28 +35,73 @@ type WebsocketServerConn struct {
 // NewWsRPCServer return a Websocket RPC server
 func NewWsRPCServer() *WsRPCServer {
 	server := &WsRPCServer{
-		rpc: &rpc.Server{},
+		rpc: NewServer(),
 	}
+	server.rpc.netrpc = new(rpc.Server)
 
 	return server
 }
 
-// GetWsRPCServer return rpc server of the WsRPCServer
-func (server *WsRPCServer) GetWsRPCServer() *rpc.Server {
+// GetServer returns the rpc server of the WsRPCServer
+func (server *WsRPCServer) GetServer() *Server {
 	return server.rpc
 }
 
-// ServeWS runs the JSON-RPC server on a single websocket connection.
+// GetWsRPCServer returns the net/rpc server of the WsRPCServer, whose
+// services are served when GetServer has none of the name. Its calls are
+// served without the limits, cache and idempotency of Server.
+//
+// Deprecated: register the services on GetServer.
+func (server *WsRPCServer) GetWsRPCServer() *rpc.Server {
+	return server.rpc.netrpc
+}
+
+// ServeWS runs the JSON-RPC server on a single websocket connection. The
+// connection is bidirectional: the methods called on it can call back the
+// methods registered by a client of DialWebsocketPeer through Peer(ctx).
 func (server *WsRPCServer) ServeWS(w http.ResponseWriter, r *http.Request) {
 	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader has already replied with an HTTP error
+		server.rpc.logError("rpc websocket upgrade", "remote", r.RemoteAddr, "error", err.Error())
+		return
+	}
 	defer ws.Close()
 
+	// Calls without a request ID of their own get a new one each, the
+	// trace context and the API version of the upgrade request apply to
+	// all of them.
+	ctx := WithTransport(r.Context(), TransportWebsocket, r.RemoteAddr)
+	ctx = withVersion(ctx, r.Header.Get(VersionHeader))
+	if tp := r.Header.Get(trace.TraceParentHeader); trace.ValidTraceParent(tp) {
+		ctx = trace.WithTraceParent(ctx, tp)
+	}
+	server.rpc.ServePeer(ctx, ws.UnderlyingConn())
+}
+
+// DialWebsocket connects to a WsRPCServer at url, such as
+// "ws://127.0.0.1:8080/ws".
+func DialWebsocket(url string, header http.Header) (*Client, error) {
+	ws, _, err := websocket.DefaultDialer.Dial(url, header)
 	if err != nil {
-		log.Println(err)
-		return
+		return nil, err
 	}
+	// ServeWS speaks JSON-RPC on the underlying connection, not in frames.
+	client := NewClient(ws.UnderlyingConn())
+	client.endpoint = url
+	return client, nil
+}
 
-	server.rpc.ServeCodec(NewJSONCodec(ws.UnderlyingConn(), nil))
+// DialWebsocketPeer is like DialWebsocket but serves the requests sent by the
+// server with handlers, see NewPeerClient.
+func DialWebsocketPeer(url string, header http.Header, handlers *Server) (*Client, error) {
+	ws, _, err := websocket.DefaultDialer.Dial(url, header)
+	if err != nil {
+		return nil, err
+	}
+	client := NewPeerClient(ws.UnderlyingConn(), handlers)
+	client.endpoint = url
+	return client, nil
 }
 
 // Read represents read data from websocket connection.
@@ -6,7 +6,12 @@
 package rpc
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 type WSTest struct{}
@@ -23,3 +28,33 @@ func Test_Websocket(t *testing.T) {
 		t.Fatalf("Websocket register test failed")
 	}
 }
+
+func Test_Websocket_NetRPCConcurrent(t *testing.T) {
+	handler := NewWsRPCServer()
+	handler.GetWsRPCServer().RegisterName("Slow", &NameService{name: "slow", delay: 200 * time.Millisecond})
+	ts := httptest.NewServer(http.HandlerFunc(handler.ServeWS))
+	defer ts.Close()
+	client, err := DialWebsocket("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// the calls of the net/rpc server run side by side too
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var name string
+			if err := client.Call("Slow.Name", &Args{}, &name); err != nil || name != "slow" {
+				t.Errorf("bad name %q: %v", name, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed > 600*time.Millisecond {
+		t.Fatalf("calls served one at a time: %v", elapsed)
+	}
+}
@@ -0,0 +1,106 @@
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// Header names which carry the request ID and the W3C trace context over HTTP.
+const (
+	RequestIDHeader   = "X-Request-ID"
+	TraceParentHeader = "traceparent"
+)
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	traceParentKey
+)
+
+// WithRequestID returns a copy of ctx carrying the request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the request ID carried by ctx, or "" if there is none.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// WithTraceParent returns a copy of ctx carrying the traceparent.
+func WithTraceParent(ctx context.Context, traceParent string) context.Context {
+	return context.WithValue(ctx, traceParentKey, traceParent)
+}
+
+// TraceParent returns the traceparent carried by ctx, or "" if there is none.
+func TraceParent(ctx context.Context) string {
+	tp, _ := ctx.Value(traceParentKey).(string)
+	return tp
+}
+
+// NewRequestID returns a random request ID.
+func NewRequestID() string {
+	return randomHex(16)
+}
+
+// FromHeader returns a copy of ctx carrying the request ID and the traceparent
+// found in the HTTP header. An invalid traceparent is ignored.
+func FromHeader(ctx context.Context, header http.Header) context.Context {
+	if id := header.Get(RequestIDHeader); id != "" {
+		ctx = WithRequestID(ctx, id)
+	}
+	if tp := header.Get(TraceParentHeader); ValidTraceParent(tp) {
+		ctx = WithTraceParent(ctx, tp)
+	}
+	return ctx
+}
+
+// ValidTraceParent reports whether tp is a well-formed traceparent,
+// "version-traceid-parentid-flags" with hex fields of 2, 32, 16 and 2 digits.
+func ValidTraceParent(tp string) bool {
+	parts := strings.Split(tp, "-")
+	if len(parts) < 4 || parts[0] == "ff" {
+		return false
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return false
+	}
+	for i, size := range []int{2, 32, 16, 2} {
+		if len(parts[i]) != size || !isLowerHex(parts[i]) {
+			return false
+		}
+	}
+	// all zero trace-id and parent-id are invalid
+	return strings.Trim(parts[1], "0") != "" && strings.Trim(parts[2], "0") != ""
+}
+
+// ChildTraceParent returns the traceparent to send on an outgoing call made
+// on behalf of tp: same trace-id and flags with a new parent-id.
+// It returns "" if tp is not valid.
+func ChildTraceParent(tp string) string {
+	if !ValidTraceParent(tp) {
+		return ""
+	}
+	parts := strings.Split(tp, "-")
+	return strings.Join([]string{"00", parts[1], randomHex(8), parts[3]}, "-")
+}
+
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
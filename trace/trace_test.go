@@ -0,0 +1,70 @@
+package trace
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const testTraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func Test_ValidTraceParent(t *testing.T) {
+	valid := []string{
+		testTraceParent,
+		"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra",
+	}
+	for _, tp := range valid {
+		if !ValidTraceParent(tp) {
+			t.Errorf("expected valid traceparent %q", tp)
+		}
+	}
+	invalid := []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	}
+	for _, tp := range invalid {
+		if ValidTraceParent(tp) {
+			t.Errorf("expected invalid traceparent %q", tp)
+		}
+	}
+}
+
+func Test_ChildTraceParent(t *testing.T) {
+	child := ChildTraceParent(testTraceParent)
+	if !ValidTraceParent(child) {
+		t.Fatalf("invalid child %q", child)
+	}
+	if !strings.HasPrefix(child, "00-4bf92f3577b34da6a3ce929d0e0e4736-") || !strings.HasSuffix(child, "-01") {
+		t.Fatalf("child %q does not keep trace-id and flags", child)
+	}
+	if child == testTraceParent {
+		t.Fatalf("child keeps the parent-id")
+	}
+	if ChildTraceParent("bad") != "" {
+		t.Fatalf("expected empty child for invalid traceparent")
+	}
+}
+
+func Test_FromHeader(t *testing.T) {
+	header := http.Header{}
+	header.Set(RequestIDHeader, "req-1")
+	header.Set(TraceParentHeader, testTraceParent)
+	ctx := FromHeader(context.Background(), header)
+	if RequestID(ctx) != "req-1" || TraceParent(ctx) != testTraceParent {
+		t.Fatalf("bad context %q %q", RequestID(ctx), TraceParent(ctx))
+	}
+
+	header.Set(TraceParentHeader, "garbage")
+	if TraceParent(FromHeader(context.Background(), header)) != "" {
+		t.Fatalf("invalid traceparent accepted")
+	}
+	if len(NewRequestID()) != 32 {
+		t.Fatalf("bad request id length")
+	}
+}